@@ -20,9 +20,20 @@ import (
 
 // CrawlOptions holds the command-line options for the crawl command
 type CrawlOptions struct {
-	url   string
-	depth int
-	debug bool
+	url          string
+	job          string
+	depth        int
+	depthSet     bool // --depth was given and overrides the job's max_depth
+	debug        bool
+	resume       string
+	sitemapOnly  bool
+	full         bool
+	ignoreRobots bool
+	timeout      time.Duration
+	timeoutSet   bool // --timeout was given and overrides the job's timeout
+
+	duplicates        string
+	duplicateDistance int
 }
 
 // NewCrawlCmd creates the 'crawl' command.
@@ -32,27 +43,131 @@ func NewCrawlCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "crawl",
 		Short: "Crawl a website",
+		Long: `Crawl a website and index its pages. Crawl progress is persisted under
+data/crawls, so an interrupted crawl, or one stopped by --timeout, can be
+resumed by its ID.
+
+Pages listed in the site's sitemaps (from the Sitemap: lines of robots.txt,
+or /sitemap.xml) are added as seeds, so orphaned and deep pages are indexed
+too. With --sitemap-only, only those pages are fetched and no links are
+followed.
+
+Recrawls keep the existing index: pages crawled before are requested with
+If-None-Match/If-Modified-Since, pages whose content is unchanged are not
+re-indexed, and pages that now return 404 or 410 are deleted. Use --full to
+re-fetch and re-index everything.
+
+Only the main content of a page is indexed. Blocks are scored by how much
+prose they hold against how much of it is links, so navigation menus,
+footers, cookie banners and scripts are left out; headings and paragraph
+breaks are kept, and the headings are also stored in a field of their own.
+Pages indexed with the whole page text are re-extracted by a --full recrawl.
+
+The structured data a page declares is indexed with it: its meta description,
+keywords and author, OpenGraph and Twitter card tags, language, publication
+and modification times, and schema.org Article, Product and BreadcrumbList
+items from JSON-LD or microdata. These fields can be searched and filtered
+on, and the description is the snippet of results matching nothing in the
+content.
+
+robots.txt is read for the crawler's user agent: disallowed URLs are skipped
+and recorded with the rule that excludes them, and a Crawl-delay spaces out
+requests to that host. Pages marked noindex, by a robots meta tag or an
+X-Robots-Tag header, are not indexed; nofollow pages have their links ignored.
+Use --ignore-robots only for sites you operate.
+
+A job file (YAML or JSON) crawls several seeds in one crawl with a shared
+visited set. It names the job, which is stored on every indexed document and
+can be used as a search filter, and limits where the crawl goes:
+
+  name: docs
+  seeds:
+    - https://docs.example.com/
+    - https://blog.example.com/
+  allowed_domains: [docs.example.com, "*.blog.example.com"]
+  include: ['^https://docs\.example\.com/guide/']
+  exclude: ['\?page=\d+$']
+  max_depth: 3
+  max_pages: 5000
+  timeout: 2h
+
+Without allowed_domains, the hosts of the seeds are allowed. --depth
+overrides max_depth, and --timeout the job's timeout.
+
+URLs are canonicalized before they are queued or indexed: scheme and host
+are lowercased, default ports, fragments, trailing slashes and tracking
+parameters such as utm_* are removed, and query parameters are sorted. A page
+declaring a <link rel="canonical"> within the crawl is indexed under that URL.
+The other URLs a page was found as are kept in its url_variants metadata.
+
+Near-duplicate pages are found by comparing SimHash fingerprints of their
+content. By default a page within --duplicate-distance bits of an indexed page
+is indexed under the same cluster ID, so searches can collapse them; with
+--duplicates skip it is not indexed at all.
+
+Requests are paced per host: each host gets at most two concurrent requests
+at least 200ms apart, and at most eight requests are in flight in total. A
+host answering 429 or 503 is paused for its Retry-After, or an increasing
+backoff, and the page is retried up to four times.
+
+Examples:
+  goprowl crawl --url https://example.com --depth 2
+  goprowl crawl --url https://example.com --sitemap-only
+  goprowl crawl --url https://example.com --full
+  goprowl crawl --url https://example.com --depth 5 --timeout 30m
+  goprowl crawl --url http://localhost:8080 --ignore-robots
+  goprowl crawl --job jobs/docs.yaml
+  goprowl crawl --url https://example.com --duplicates skip
+  goprowl crawl --resume crawler-1730000000000000000`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.depthSet = cmd.Flags().Changed("depth")
+			opts.timeoutSet = cmd.Flags().Changed("timeout")
 			return runCrawl(cmd.Context(), opts)
 		},
 	}
 
-	cmd.Flags().StringVarP(&opts.url, "url", "u", "", "Starting URL for crawling (required)")
+	cmd.Flags().StringVarP(&opts.url, "url", "u", "", "Starting URL for crawling (required unless --job or --resume is set)")
+	cmd.Flags().StringVarP(&opts.job, "job", "j", "", "Crawl job file (YAML or JSON) listing seeds and crawl limits")
 	cmd.Flags().IntVarP(&opts.depth, "depth", "d", 1, "Maximum crawl depth")
 	cmd.Flags().BoolVarP(&opts.debug, "debug", "v", false, "Enable debug logging")
-	if err := cmd.MarkFlagRequired("url"); err != nil {
-		cmd.RunE = func(cmd *cobra.Command, args []string) error {
-			return fmt.Errorf("failed to mark flag as required: %w", err)
-		}
-	}
+	cmd.Flags().StringVarP(&opts.resume, "resume", "r", "", "Resume an interrupted crawl by its ID")
+	cmd.Flags().BoolVar(&opts.sitemapOnly, "sitemap-only", false, "Only index URLs listed in the site's sitemaps")
+	cmd.Flags().BoolVar(&opts.full, "full", false, "Re-fetch and re-index every page, ignoring stored change information")
+	cmd.Flags().BoolVar(&opts.ignoreRobots, "ignore-robots", false, "Disregard robots.txt and robots meta directives")
+	cmd.Flags().StringVar(&opts.duplicates, "duplicates", string(crawlers.DuplicatesCluster), "Near-duplicate pages: cluster, skip or off")
+	cmd.Flags().IntVar(&opts.duplicateDistance, "duplicate-distance", 3, "Maximum differing SimHash bits between near-duplicates")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 0, "Stop the crawl after this long, such as 30m, so it can be resumed later (0 for no limit)")
+	cmd.MarkFlagsOneRequired("url", "job", "resume")
+	cmd.MarkFlagsMutuallyExclusive("url", "job", "resume")
+	cmd.MarkFlagsMutuallyExclusive("sitemap-only", "resume")
 
 	return cmd
 }
 
 // runCrawl handles the main crawl command execution
 func runCrawl(ctx context.Context, opts *CrawlOptions) error {
-	app := createApp(opts)
+	mode, err := crawlers.ParseDuplicateMode(opts.duplicates)
+	if err != nil {
+		return err
+	}
+	opts.duplicates = string(mode)
 
+	var job *crawlers.CrawlJob
+	if opts.job != "" {
+		if job, err = crawlers.LoadJob(opts.job); err != nil {
+			return err
+		}
+		if opts.depthSet {
+			job.MaxDepth = opts.depth
+		}
+		if !opts.timeoutSet {
+			opts.timeout = job.TimeoutDuration()
+		}
+	}
+
+	app := createApp(ctx, opts, job)
+
+	// The deadline bounds starting the application, not the crawl
 	startCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
@@ -60,7 +175,17 @@ func runCrawl(ctx context.Context, opts *CrawlOptions) error {
 		return fmt.Errorf("failed to start application: %w", err)
 	}
 
-	<-app.Done()
+	select {
+	case <-ctx.Done():
+	case <-app.Done():
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := app.Stop(stopCtx); err != nil {
+		return fmt.Errorf("failed to stop application: %w", err)
+	}
 
 	if err := app.Err(); err != nil {
 		return fmt.Errorf("application error: %w", err)
@@ -70,7 +195,10 @@ func runCrawl(ctx context.Context, opts *CrawlOptions) error {
 }
 
 // createApp initializes the fx application with the necessary modules and config.
-func createApp(opts *CrawlOptions) *fx.App {
+// A non-nil job is crawled instead of opts.url. The crawl runs until ctx is
+// cancelled or the application stops, and is limited to opts.timeout by the
+// crawler when that is set
+func createApp(ctx context.Context, opts *CrawlOptions, job *crawlers.CrawlJob) *fx.App {
 	// Set logging level based on debug flag
 	logLevel := zap.WarnLevel
 	if opts.debug {
@@ -87,9 +215,17 @@ func createApp(opts *CrawlOptions) *fx.App {
 		fx.Provide(
 			func() *crawlers.ConfigOptions {
 				return &crawlers.ConfigOptions{
-					URL:      opts.url,
-					MaxDepth: opts.depth,
-					Debug:    opts.debug,
+					URL:          opts.url,
+					MaxDepth:     opts.depth,
+					Debug:        opts.debug,
+					ResumeID:     opts.resume,
+					SitemapOnly:  opts.sitemapOnly,
+					Full:         opts.full,
+					IgnoreRobots: opts.ignoreRobots,
+					Timeout:      opts.timeout,
+
+					Duplicates:        crawlers.DuplicateMode(opts.duplicates),
+					DuplicateDistance: opts.duplicateDistance,
 				}
 			},
 		),
@@ -105,12 +241,35 @@ func createApp(opts *CrawlOptions) *fx.App {
 			storageAdapter *storage.StorageAdapter,
 			logger *zap.Logger,
 		) error {
-			lifecycle.Append(fx.Hook{
-				OnStart: func(ctx context.Context) error {
-					logger.Info("starting crawler", zap.String("url", opts.url), zap.Int("depth", opts.depth))
+			// The hooks' contexts only bound starting and stopping, so the
+			// crawl gets its own
+			crawlCtx, cancelCrawl := context.WithCancel(ctx)
+			done := make(chan struct{})
 
+			lifecycle.Append(fx.Hook{
+				OnStart: func(context.Context) error {
+					crawler.SetPageStore(storageAdapter)
 					go func() {
-						if err := crawler.CrawlWithHandler(ctx, opts.url, opts.depth, storageAdapter.HandleCrawledPage); err != nil {
+						defer close(done)
+
+						var err error
+						if opts.resume != "" {
+							logger.Info("resuming crawler", zap.String("crawl_id", opts.resume))
+							err = crawler.ResumeWithHandler(crawlCtx, opts.resume, storageAdapter.HandleCrawledPage)
+						} else if job != nil {
+							logger.Info("starting crawl job",
+								zap.String("crawl_id", crawler.GetID()),
+								zap.String("job", job.Name),
+								zap.Strings("seeds", job.Seeds))
+							err = crawler.CrawlJobWithHandler(crawlCtx, job, storageAdapter.HandleCrawledPage)
+						} else {
+							logger.Info("starting crawler",
+								zap.String("crawl_id", crawler.GetID()),
+								zap.String("url", opts.url),
+								zap.Int("depth", opts.depth))
+							err = crawler.CrawlWithHandler(crawlCtx, opts.url, opts.depth, storageAdapter.HandleCrawledPage)
+						}
+						if err != nil {
 							logger.Error("crawler failed", zap.Error(err))
 						}
 
@@ -122,7 +281,13 @@ func createApp(opts *CrawlOptions) *fx.App {
 				},
 				OnStop: func(ctx context.Context) error {
 					logger.Info("stopping crawler")
-					return nil
+					cancelCrawl()
+					select {
+					case <-done:
+						return nil
+					case <-ctx.Done():
+						return fmt.Errorf("crawler did not stop: %w", ctx.Err())
+					}
 				},
 			})
 			return nil
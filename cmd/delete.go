@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jonesrussell/goprowl/internal/app"
+	"github.com/jonesrussell/goprowl/search/engine"
+	"github.com/jonesrussell/goprowl/search/storage"
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+)
+
+// NewDeleteCmd creates the 'delete' command
+func NewDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <url>...",
+		Short: "Delete documents from storage and the search index",
+		Long: `Remove documents by URL from storage and the search index together.
+If the index cannot be updated the document is restored in storage, so the
+two never disagree.
+
+Examples:
+  goprowl delete https://example.com/old-page
+  goprowl delete https://example.com/a https://example.com/b`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return fx.New(
+				app.Module,
+				fx.Invoke(func(searchEngine engine.SearchEngine) error {
+					return deleteDocuments(searchEngine, args)
+				}),
+				fx.NopLogger,
+			).Start(cmd.Context())
+		},
+	}
+
+	return cmd
+}
+
+// deleteDocuments deletes each URL, carrying on past missing documents
+func deleteDocuments(searchEngine engine.SearchEngine, urls []string) error {
+	var failed int
+	for _, url := range urls {
+		err := searchEngine.Delete(url)
+		switch {
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			fmt.Printf("Not found: %s\n", url)
+			failed++
+		case err != nil:
+			fmt.Printf("Failed: %s: %v\n", url, err)
+			failed++
+		default:
+			fmt.Printf("Deleted: %s\n", url)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d documents could not be deleted", failed, len(urls))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jonesrussell/goprowl/internal/app"
+	"github.com/jonesrussell/goprowl/search/engine"
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+)
+
+// errInconsistent is returned by 'reindex --check' when storage and the
+// index disagree, so scripts can act on the exit status
+var errInconsistent = errors.New("storage and search index are inconsistent")
+
+// ReindexOptions holds the flags of the reindex command
+type ReindexOptions struct {
+	check  bool
+	format string
+}
+
+// NewReindexCmd creates the 'reindex' command
+func NewReindexCmd() *cobra.Command {
+	opts := &ReindexOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild the search index from storage",
+		Long: `Rebuild the search index from stored documents using the current index
+mapping, then check that storage and the index hold the same documents.
+Searches keep being served from the old index until the new one is ready.
+
+With --check the index is left alone and only the consistency report is
+printed; the command fails if storage and the index disagree.
+
+Examples:
+  goprowl reindex
+  goprowl reindex --check
+  goprowl reindex --check --format json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return fx.New(
+				app.Module,
+				fx.Invoke(func(searchEngine engine.SearchEngine) error {
+					ctx := cmd.Context()
+
+					if !opts.check {
+						start := time.Now()
+						if err := searchEngine.Reindex(ctx); err != nil {
+							return fmt.Errorf("reindex failed: %w", err)
+						}
+						if opts.format != "json" {
+							fmt.Printf("Reindexed in %s\n", time.Since(start).Round(time.Millisecond))
+						}
+					}
+
+					report, err := searchEngine.CheckConsistency(ctx)
+					if err != nil {
+						return fmt.Errorf("consistency check failed: %w", err)
+					}
+					if err := displayConsistency(report, opts.format); err != nil {
+						return err
+					}
+
+					if !report.Consistent() {
+						return errInconsistent
+					}
+					return nil
+				}),
+				fx.NopLogger,
+			).Start(cmd.Context())
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.check, "check", false, "Only report documents missing from storage or the index")
+	cmd.Flags().StringVarP(&opts.format, "format", "f", "text", "Output format (text, json)")
+
+	return cmd
+}
+
+func displayConsistency(report *engine.ConsistencyReport, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "text":
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	fmt.Printf("Documents in storage: %d\n", report.StorageDocuments)
+	fmt.Printf("Documents in index:   %d\n", report.IndexDocuments)
+	if report.Consistent() {
+		fmt.Println("Storage and index are consistent")
+		return nil
+	}
+
+	for _, id := range report.MissingFromIndex {
+		fmt.Printf("Missing from index:   %s\n", id)
+	}
+	for _, id := range report.MissingFromStorage {
+		fmt.Printf("Missing from storage: %s\n", id)
+	}
+	return nil
+}
@@ -131,8 +131,8 @@ func Execute() error {
 		return fmt.Errorf("failed to start application: %w", err)
 	}
 
-	// Create a cancellable context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	// Create a cancellable context; commands bound their own run time
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Create buffered channel for signals
@@ -168,6 +168,10 @@ func Execute() error {
 		NewCrawlCmd(),
 		NewSearchCmd(),
 		NewListCmd(),
+		NewServeCmd(),
+		NewSuggestCmd(),
+		NewDeleteCmd(),
+		NewReindexCmd(),
 	)
 
 	// Execute with context and handle any errors
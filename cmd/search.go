@@ -5,24 +5,164 @@ package cmd
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/jonesrussell/goprowl/internal/app"
 	"github.com/jonesrussell/goprowl/search/engine"
+	"github.com/jonesrussell/goprowl/search/engine/highlight"
+	"github.com/jonesrussell/goprowl/search/engine/indexer"
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
+	"github.com/jonesrussell/goprowl/search/storage"
 	"github.com/spf13/cobra"
 	"go.uber.org/fx"
 )
 
 func NewSearchCmd() *cobra.Command {
-	var query string
+	var (
+		query        string
+		format       string
+		snippetSize  int
+		snippetCount int
+		facetNames   []string
+		filters      []string
+		collapse     bool
+		explain      bool
+		sortSpec     string
+		cursor       string
+		expansions   int
+		backend      string
+		scorer       string
+		fieldWeights map[string]string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "search",
 		Short: "Search indexed documents",
-		Long:  `Search through crawled and indexed documents using keywords.`,
+		Long: `Search through crawled and indexed documents using keywords.
+
+Each result shows snippets of the content around the matched terms, with the
+matches highlighted. Use --highlight to choose how matches are marked.
+
+Examples:
+  goprowl search -q "web crawler"
+  goprowl search -q golang --snippets 1 --snippet-size 80
+  goprowl search -q golang --highlight plain
+
+Facets count the matching documents by host, type, language, content type,
+crawl job, schema.org type, creation, modification and publication date, and
+content length. A value or
+bucket from the counts can be passed back with --filter to narrow the results.
+
+  goprowl search -q golang --facets
+  goprowl search -q golang --facets=host,created
+  goprowl search -q golang --filter host=go.dev --filter created=past_week
+
+Fields can also be filtered on in the query itself, or with --filter
+expressions in the same syntax: terms on host, type, content type and job,
+URL prefixes, numeric and date ranges, with dates absolute or relative to
+now. Ranges include bounds in square brackets and exclude them in curly ones,
+and * leaves a side open. In a query, field terms filter when required with +
+or joined by AND, each of them having to match, and negated ones always
+exclude. A query of field terms joined by OR matches any of them; next to
+other words they only rank the pages they match higher. Filters restrict the
+results without changing how they rank.
+
+  goprowl search -q "golang +host:docs.example.com +created:>2026-01-01"
+  goprowl search -q "golang +size:[1000 TO 50000] -type:pdf"
+  goprowl search -q golang --filter "created:>=now-7d OR modified:>=now-7d"
+  goprowl search -q golang --filter 'url:https://go.dev/doc/*'
+
+Pages whose content nearly matches another page, such as mirrors and
+printer-friendly copies, share a cluster ID. --collapse shows one result per
+cluster, noting how many similar pages it stands for.
+
+  goprowl search -q golang --collapse
+
+When a result ranks oddly, --explain shows how its score was computed: the
+score of each matching term and field, with its term frequency, inverse
+document frequency, length normalization and boosts.
+
+  goprowl search -q "web crawler" --explain
+
+--backend inverted searches the titles and content of the pages with the
+in-house inverted index, built in memory from the stored pages, instead of
+bleve. Its results can be explained in the same way, but not filtered,
+faceted, sorted, paged by cursor or collapsed.
+
+  goprowl search -q "web crawler" --backend inverted --explain
+
+The inverted index scores matches with BM25 unless --scorer selects another
+scorer: bm25f, which weighs the fields given by --field-weight, or tfidf.
+
+  goprowl search -q "web crawler" --backend inverted --scorer bm25f --field-weight title=3
+
+Results are ordered by relevance unless --sort names other keys: score,
+created, modified, title, url or a numeric field such as content_length,
+comma-separated with later keys breaking ties. A "-" prefix or ":desc" suffix
+reverses a key. A full page of results ends with a cursor that --cursor takes
+to fetch the page after it, as quickly however deep it is.
+
+  goprowl search -q golang --sort=-created,title
+  goprowl search -q golang --sort=-created,title --cursor <next cursor>
+
+Terms ending in * match every word starting with them, and * and ? elsewhere
+in a term stand for any number of characters and for exactly one. A regular
+expression between slashes matches the words it matches as a whole, and ~
+after a term matches words up to that many edits away, a swap of adjacent
+letters counting as one. A pattern matching more than --max-expansions words
+of a field fails rather than searching them all. A lone * matches every page,
+and field:* every page with a value for the field.
+
+  goprowl search -q "craw* c?awl*"
+  goprowl search -q "/crawl(er|ing)/ title:golnag~1"
+  goprowl search -q "c*" --max-expansions 5000
+  goprowl search -q "* -author:*"
+
+The language of every page is detected from its text, falling back to the
+language it declares. Titles, headings and content are also indexed with a
+stemming, stop word removing analyzer for that language, which a search
+restricted to one language uses, so "crawled +lang:en" matches "crawling". A
+lang: term restricts the results when required with + or joined by AND;
+otherwise it only ranks pages in that language higher. Indexes built before
+language analysis need a "goprowl reindex".
+
+  goprowl search -q "crawl +lang:en"
+  goprowl search -q "crawl AND lang:en"
+  goprowl search -q golang --filter language=fr`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return fx.New(
 				app.Module,
-				fx.Invoke(func(searchEngine engine.SearchEngine) error {
+				fx.Invoke(func(store storage.StorageAdapter) error {
+					// Patterns are limited by the inverted index as a whole
+					cfg := indexer.Config{}
+					if backend == engine.BackendInverted {
+						cfg.MaxExpansions, expansions = expansions, 0
+					} else if scorer != "" || len(fieldWeights) > 0 {
+						return fmt.Errorf("--scorer and --field-weight need --backend %s", engine.BackendInverted)
+					}
+					weights, err := parseFieldWeights(fieldWeights)
+					if err != nil {
+						return err
+					}
+					if cfg.Scorer, err = ranking.NewScorer(scorer, weights); err != nil {
+						return err
+					}
+					searchEngine, err := engine.NewBackend(backend, store, cfg)
+					if err != nil {
+						return err
+					}
+
+					formatter, err := highlight.Lookup(format)
+					if err != nil {
+						return err
+					}
+
+					facets, err := engine.LookupFacets(facetNames)
+					if err != nil {
+						return err
+					}
+
 					processor := engine.NewQueryProcessor()
 					searchQuery, err := processor.ParseQuery(query)
 					if err != nil {
@@ -31,6 +171,34 @@ func NewSearchCmd() *cobra.Command {
 
 					// Set pagination
 					searchQuery.SetPagination(1, 10)
+					searchQuery.SetHighlight(&engine.HighlightOptions{
+						Formatter:    formatter,
+						FragmentSize: snippetSize,
+						MaxFragments: snippetCount,
+					})
+					searchQuery.SetFacets(facets)
+					if collapse {
+						searchQuery.SetCollapse(engine.ClusterField)
+					}
+					searchQuery.SetExplain(explain)
+					keys, err := engine.ParseSort(sortSpec, "")
+					if err != nil {
+						return err
+					}
+					searchQuery.SetSort(keys)
+					searchQuery.SetCursor(cursor)
+					searchQuery.SetMaxExpansions(expansions)
+					facetFilters, expressions := parseFilters(filters)
+					for key, values := range facetFilters {
+						searchQuery.SetFilter(key, values)
+					}
+					for _, expr := range expressions {
+						filter, err := engine.ParseFilter(expr)
+						if err != nil {
+							return err
+						}
+						searchQuery.AddFilter(filter)
+					}
 
 					// Perform search
 					results, err := searchEngine.Search(searchQuery)
@@ -40,6 +208,10 @@ func NewSearchCmd() *cobra.Command {
 
 					// Display results
 					displaySearchResults(results)
+					displayFacets(facets, results.Facets)
+					if next, ok := results.Metadata["next_cursor"].(string); ok {
+						fmt.Printf("\nNext cursor: %s\n", next)
+					}
 					return nil
 				}),
 				fx.NopLogger,
@@ -48,6 +220,20 @@ func NewSearchCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&query, "query", "q", "", "Search query (required)")
+	cmd.Flags().StringVar(&format, "highlight", "ansi", "Highlight format: "+strings.Join(highlight.Names(), ", "))
+	cmd.Flags().IntVar(&snippetSize, "snippet-size", highlight.DefaultFragmentSize, "Approximate length of each snippet fragment")
+	cmd.Flags().IntVar(&snippetCount, "snippets", 2, "Maximum number of snippet fragments per result")
+	cmd.Flags().StringSliceVar(&facetNames, "facets", nil, "Facets to count, or all when given without a value")
+	cmd.Flags().Lookup("facets").NoOptDefVal = "all"
+	cmd.Flags().StringArrayVar(&filters, "filter", nil, "Restrict results to a facet value, as name=value, or to a filter expression (repeatable)")
+	cmd.Flags().BoolVar(&collapse, "collapse", false, "Show one result per cluster of near-duplicate pages")
+	cmd.Flags().BoolVar(&explain, "explain", false, "Show how the score of each result was computed")
+	cmd.Flags().StringVar(&sortSpec, "sort", "", "Keys to order results by, such as -created,title (default relevance)")
+	cmd.Flags().StringVar(&cursor, "cursor", "", "Cursor printed after the previous page, to fetch the next one")
+	cmd.Flags().IntVar(&expansions, "max-expansions", 0, "Words of a field a prefix, wildcard, regex or fuzzy term may match (0 for the default)")
+	cmd.Flags().StringVar(&backend, "backend", engine.BackendBleve, "Search backend: "+engine.BackendBleve+" or "+engine.BackendInverted)
+	cmd.Flags().StringVar(&scorer, "scorer", "", "Scorer of the inverted backend: "+ranking.ScorerBM25+" (default), "+ranking.ScorerBM25F+" or "+ranking.ScorerTFIDF)
+	cmd.Flags().StringToStringVar(&fieldWeights, "field-weight", nil, "BM25F weight of a field, as field=weight (repeatable)")
 	if err := cmd.MarkFlagRequired("query"); err != nil {
 		cmd.RunE = func(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to mark 'query' flag as required: %w", err)
@@ -59,15 +245,84 @@ func NewSearchCmd() *cobra.Command {
 
 func displaySearchResults(results *engine.SearchResults) {
 	total := results.Metadata["total"].(int64)
-	fmt.Printf("Found %d results:\n\n", total)
+	if approximate, _ := results.Metadata["total_approximate"].(bool); approximate {
+		fmt.Printf("Found at most %d results:\n\n", total)
+	} else {
+		fmt.Printf("Found %d results:\n\n", total)
+	}
 	for _, hit := range results.Hits {
 		content := hit.Content
-		fmt.Printf("Title: %s\n", content["title"])
+		title := content["title"]
+		if highlighted, ok := hit.Highlights["title"]; ok && len(highlighted) > 0 {
+			title = highlighted[0]
+		}
+		fmt.Printf("Title: %s\n", title)
 		fmt.Printf("URL: %s\n", content["url"])
+		if duplicates, ok := hit.Metadata["duplicates"].(int); ok {
+			fmt.Printf("Similar pages: %d\n", duplicates)
+		}
 		if snippet, ok := content["snippet"].(string); ok {
 			fmt.Printf("Snippet: %s\n", snippet)
 		}
 		fmt.Printf("Score: %.2f\n", hit.Score)
+		if hit.Explanation != nil {
+			fmt.Printf("Explanation:\n%s", indent(hit.Explanation.Tree(), "  "))
+		}
 		fmt.Println("---")
 	}
 }
+
+// indent prefixes every line of text
+func indent(text, prefix string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// parseFilters groups name=value flags by name, so repeating a name selects
+// any of its values, and returns the other flags as filter expressions
+func parseFilters(flags []string) (map[string][]string, []string) {
+	filters := make(map[string][]string)
+	var expressions []string
+	for _, flag := range flags {
+		name, value, ok := strings.Cut(flag, "=")
+		if !ok || strings.ContainsAny(name, ":<>[]{} ") {
+			expressions = append(expressions, flag)
+			continue
+		}
+		name = strings.TrimSpace(name)
+		filters[name] = append(filters[name], strings.TrimSpace(value))
+	}
+	return filters, expressions
+}
+
+// parseFieldWeights parses the field=weight flags of the BM25F scorer
+func parseFieldWeights(flags map[string]string) (map[string]float64, error) {
+	weights := make(map[string]float64, len(flags))
+	for field, value := range flags {
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for field %s", value, field)
+		}
+		weights[strings.TrimSpace(field)] = weight
+	}
+	return weights, nil
+}
+
+func displayFacets(facets []engine.FacetConfig, counts map[string][]engine.Facet) {
+	for _, facet := range facets {
+		values := counts[facet.Name]
+		if len(values) == 0 {
+			continue
+		}
+
+		fmt.Printf("\n%s:\n", facet.Name)
+		for _, value := range values {
+			fmt.Printf("  %-24s %d\n", value.Value, value.Count)
+		}
+	}
+}
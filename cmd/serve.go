@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jonesrussell/goprowl/internal/api"
+	"github.com/jonesrussell/goprowl/internal/app"
+	"github.com/jonesrussell/goprowl/metrics"
+	"github.com/jonesrussell/goprowl/search/adapters/storage"
+	"github.com/jonesrussell/goprowl/search/crawlers"
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"go.uber.org/zap"
+)
+
+// ServeOptions holds the command-line options for the serve command
+type ServeOptions struct {
+	addr          string
+	depth         int
+	maxExpansions int
+	token         string
+	debug         bool
+}
+
+// NewServeCmd creates the 'serve' command
+func NewServeCmd() *cobra.Command {
+	opts := &ServeOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the search engine over HTTP",
+		Long: `Start an HTTP server exposing a JSON API for searching, suggestions,
+document management, index statistics and starting crawls.
+
+Endpoints:
+  GET    /api/health
+  GET    /api/search?q=<query>&page=1&page_size=10&filter.<field>=<value>&facets=host,type&highlight=html&collapse=true
+  POST   /api/search          {"query": "...", "filters": {...}, "page": 1, "page_size": 10, "facets": ["all"]}
+  GET    /api/suggest?prefix=<prefix>&limit=10&popularity=true
+  GET    /api/stats
+  GET    /api/documents?limit=100&cursor=<next_cursor>
+  GET    /api/document?id=<url>
+  DELETE /api/document?id=<url>
+  POST   /api/crawls          {"url": "https://example.com", "depth": 2}
+  GET    /api/crawls
+  GET    /api/crawls/<id>
+
+The server listens on localhost unless --addr says otherwise. Deleting
+documents and starting crawls are disabled unless it is given an API token,
+with --api-token or the GOPROWL_API_TOKEN environment variable, which those
+requests must then send as "Authorization: Bearer <token>".
+
+Examples:
+  goprowl serve
+  goprowl serve --addr 127.0.0.1:9000
+  GOPROWL_API_TOKEN=secret goprowl serve --addr :8080`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(cmd.Context(), opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.addr, "addr", "a", "127.0.0.1:8080", "Address to listen on")
+	cmd.Flags().IntVarP(&opts.depth, "depth", "d", 1, "Default maximum depth for crawls started through the API")
+	cmd.Flags().IntVar(&opts.maxExpansions, "max-expansions", 0, "Terms of a field a prefix, wildcard, regex or fuzzy term may match (0 for the default)")
+	cmd.Flags().StringVar(&opts.token, "api-token", os.Getenv("GOPROWL_API_TOKEN"), "Bearer token enabling the endpoints that delete documents and start crawls")
+	cmd.Flags().BoolVarP(&opts.debug, "debug", "v", false, "Enable debug logging")
+
+	return cmd
+}
+
+// runServe runs the API server until the command context is cancelled
+func runServe(ctx context.Context, opts *ServeOptions) error {
+	app := createServeApp(opts)
+
+	startCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	if err := app.Start(startCtx); err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-app.Done():
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := app.Stop(stopCtx); err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+
+	return nil
+}
+
+// createServeApp initializes the fx application for the API server
+func createServeApp(opts *ServeOptions) *fx.App {
+	logLevel := zap.WarnLevel
+	if opts.debug {
+		logLevel = zap.DebugLevel
+	}
+
+	options := []fx.Option{
+		fx.WithLogger(func(log *zap.Logger) fxevent.Logger {
+			return &fxevent.ZapLogger{
+				Logger: log.WithOptions(zap.IncreaseLevel(logLevel)),
+			}
+		}),
+		NewLoggerModule(),
+		fx.Provide(
+			func() *crawlers.ConfigOptions {
+				return &crawlers.ConfigOptions{
+					MaxDepth: opts.depth,
+					Debug:    opts.debug,
+				}
+			},
+			func() *api.Config {
+				return &api.Config{
+					Addr:          opts.addr,
+					DefaultDepth:  opts.depth,
+					MaxExpansions: opts.maxExpansions,
+					Token:         opts.token,
+				}
+			},
+		),
+		metrics.Module,
+		app.Module,
+		crawlers.Module,
+		storage.Module,
+		api.Module,
+	}
+
+	if !opts.debug {
+		options = append(options, fx.NopLogger)
+	}
+
+	return fx.New(options...)
+}
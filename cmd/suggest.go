@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jonesrussell/goprowl/internal/app"
+	"github.com/jonesrussell/goprowl/search/engine"
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+)
+
+// NewSuggestCmd creates the 'suggest' command
+func NewSuggestCmd() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "suggest <prefix>",
+		Short: "Suggest completions for a search prefix",
+		Long: `Complete a search prefix from the terms and titles of indexed documents.
+
+A single word completes terms, most frequent first. Several words complete
+document titles, matching from the start of any word in the title.
+
+Examples:
+  goprowl suggest craw
+  goprowl suggest getting sta
+  goprowl suggest go --limit 5`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prefix := strings.Join(args, " ")
+
+			return fx.New(
+				app.Module,
+				fx.Invoke(func(searchEngine engine.SearchEngine) error {
+					suggestions, err := searchEngine.SuggestWithOptions(cmd.Context(), prefix, engine.SuggestOptions{
+						Limit:      limit,
+						Popularity: true,
+					})
+					if err != nil {
+						return fmt.Errorf("suggest failed: %w", err)
+					}
+
+					displaySuggestions(prefix, suggestions)
+					return nil
+				}),
+				fx.NopLogger,
+			).Start(cmd.Context())
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 10, "Maximum number of suggestions")
+
+	return cmd
+}
+
+func displaySuggestions(prefix string, suggestions []engine.Suggestion) {
+	if len(suggestions) == 0 {
+		fmt.Printf("No suggestions for %q\n", prefix)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SUGGESTION\tDOCUMENTS")
+	for _, suggestion := range suggestions {
+		fmt.Fprintf(w, "%s\t%d\n", suggestion.Text, suggestion.DocFrequency)
+	}
+	w.Flush()
+}
@@ -0,0 +1,572 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonesrussell/goprowl/search/engine"
+	"github.com/jonesrussell/goprowl/search/engine/expand"
+	"github.com/jonesrussell/goprowl/search/engine/highlight"
+	"github.com/jonesrussell/goprowl/search/engine/query"
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
+	"github.com/jonesrussell/goprowl/search/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// searchRequest is the JSON form of engine.SearchOptions
+type searchRequest struct {
+	Query     string                 `json:"query"`
+	Filters   map[string]interface{} `json:"filters,omitempty"`
+	Page      int                    `json:"page"`
+	PageSize  int                    `json:"page_size"`
+	SortBy    string                 `json:"sort_by,omitempty"`
+	SortOrder string                 `json:"sort_order,omitempty"`
+	// Cursor is the next_cursor of the previous page, in place of page
+	Cursor string `json:"cursor,omitempty"`
+	// Filter is a typed filter, or in a query string a filter expression
+	// such as "created:>now-7d size:[1000 TO 50000]"
+	Filter *engine.Filter `json:"filter,omitempty"`
+
+	// Highlight names the formatter for matched terms, "html" by default
+	Highlight   string `json:"highlight,omitempty"`
+	SnippetSize int    `json:"snippet_size,omitempty"`
+	Snippets    int    `json:"snippets,omitempty"`
+
+	// Facets names the facets to count, or "all"
+	Facets []string `json:"facets,omitempty"`
+	// Collapse returns one hit per cluster of near-duplicate pages
+	Collapse bool `json:"collapse,omitempty"`
+	// Explain adds the explanation of its score to every hit
+	Explain bool `json:"explain,omitempty"`
+}
+
+type searchHit struct {
+	Content    map[string]interface{} `json:"content"`
+	Score      float64                `json:"score"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Highlights map[string][]string    `json:"highlights,omitempty"`
+
+	Explanation *ranking.Explanation `json:"explanation,omitempty"`
+}
+
+type facetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type searchResponse struct {
+	Query    string                  `json:"query"`
+	Total    int64                   `json:"total"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"page_size"`
+	Hits     []searchHit             `json:"hits"`
+	Facets   map[string][]facetValue `json:"facets,omitempty"`
+	// TotalApproximate is set when collapsed results were counted from the
+	// top matches only, making Total an upper bound
+	TotalApproximate bool `json:"total_approximate,omitempty"`
+	// Collapsed counts the near-duplicate hits folded into others
+	Collapsed int `json:"collapsed,omitempty"`
+	// NextCursor fetches the page after this one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type documentResponse struct {
+	ID       string                 `json:"id"`
+	Type     string                 `json:"type"`
+	Content  map[string]interface{} `json:"content"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type statsResponse struct {
+	DocumentCount int64     `json:"document_count"`
+	LastIndexed   time.Time `json:"last_indexed"`
+	IndexSize     int64     `json:"index_size"`
+}
+
+type crawlRequest struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+type errorResponse struct {
+	Error    string `json:"error"`
+	Position *int   `json:"position,omitempty"`
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleSearch accepts either query parameters (q, page, page_size, sort,
+// order, filter.<field>, collapse, explain) or a JSON searchRequest body
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	req, err := parseSearchRequest(w, r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Without a query, the filters select the results
+	if strings.TrimSpace(req.Query) == "" && len(req.Filters) == 0 && req.Filter == nil {
+		s.writeError(w, http.StatusBadRequest, errors.New("query or filter is required"))
+		return
+	}
+
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = defaultPageSize
+	}
+	if req.PageSize > maxPageSize {
+		req.PageSize = maxPageSize
+	}
+
+	if req.Highlight == "" {
+		req.Highlight = "html"
+	}
+	formatter, err := highlight.Lookup(req.Highlight)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	facets, err := engine.LookupFacets(req.Facets)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts := engine.SearchOptions{
+		Query:     req.Query,
+		Filters:   req.Filters,
+		Filter:    req.Filter,
+		Page:      req.Page,
+		PageSize:  req.PageSize,
+		SortBy:    req.SortBy,
+		SortOrder: req.SortOrder,
+		Cursor:    req.Cursor,
+		Highlight: &engine.HighlightOptions{
+			Formatter:    formatter,
+			FragmentSize: req.SnippetSize,
+			MaxFragments: req.Snippets,
+		},
+		Facets:        facets,
+		Explain:       req.Explain,
+		MaxExpansions: s.config.MaxExpansions,
+	}
+	if req.Collapse {
+		opts.Collapse = engine.ClusterField
+	}
+
+	results, err := s.engine.SearchWithOptions(r.Context(), opts)
+	if err != nil {
+		var syntaxErr *query.SyntaxError
+		if errors.As(err, &syntaxErr) || errors.Is(err, engine.ErrInvalidFilter) ||
+			errors.Is(err, engine.ErrInvalidSort) || errors.Is(err, engine.ErrInvalidCursor) ||
+			errors.Is(err, expand.ErrTooManyTerms) {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.logger.Error("search failed", zap.String("query", req.Query), zap.Error(err))
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	total, _ := results.Metadata["total"].(int64)
+	collapsed, _ := results.Metadata["collapsed"].(int)
+	nextCursor, _ := results.Metadata["next_cursor"].(string)
+	approximate, _ := results.Metadata["total_approximate"].(bool)
+	resp := searchResponse{
+		Query:    req.Query,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+		Hits:     make([]searchHit, 0, len(results.Hits)),
+		Facets:   make(map[string][]facetValue, len(results.Facets)),
+
+		TotalApproximate: approximate,
+		Collapsed:        collapsed,
+		NextCursor:       nextCursor,
+	}
+	for _, hit := range results.Hits {
+		resp.Hits = append(resp.Hits, searchHit{
+			Content:    hit.Content,
+			Score:      hit.Score,
+			Metadata:   hit.Metadata,
+			Highlights: hit.Highlights,
+
+			Explanation: hit.Explanation,
+		})
+	}
+	for name, facets := range results.Facets {
+		values := make([]facetValue, 0, len(facets))
+		for _, facet := range facets {
+			values = append(values, facetValue{Value: facet.Value, Count: facet.Count})
+		}
+		resp.Facets[name] = values
+	}
+
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func parseSearchRequest(w http.ResponseWriter, r *http.Request) (*searchRequest, error) {
+	req := &searchRequest{}
+
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(req); err != nil {
+			return nil, errors.New("invalid JSON body: " + err.Error())
+		}
+		return req, nil
+	}
+
+	params := r.URL.Query()
+	req.Query = params.Get("q")
+	req.SortBy = params.Get("sort")
+	req.SortOrder = params.Get("order")
+	req.Cursor = params.Get("cursor")
+	if expr := params.Get("filter"); expr != "" {
+		var err error
+		if req.Filter, err = engine.ParseFilter(expr); err != nil {
+			return nil, err
+		}
+	}
+	req.Highlight = params.Get("highlight")
+	if facets := params.Get("facets"); facets != "" {
+		req.Facets = strings.Split(facets, ",")
+	}
+	if collapse := params.Get("collapse"); collapse != "" {
+		var err error
+		if req.Collapse, err = strconv.ParseBool(collapse); err != nil {
+			return nil, errors.New("invalid collapse: " + err.Error())
+		}
+	}
+	if explain := params.Get("explain"); explain != "" {
+		var err error
+		if req.Explain, err = strconv.ParseBool(explain); err != nil {
+			return nil, errors.New("invalid explain: " + err.Error())
+		}
+	}
+
+	var err error
+	if req.Page, err = intParam(params.Get("page")); err != nil {
+		return nil, errors.New("invalid page: " + err.Error())
+	}
+	if req.PageSize, err = intParam(params.Get("page_size")); err != nil {
+		return nil, errors.New("invalid page_size: " + err.Error())
+	}
+	if req.SnippetSize, err = intParam(params.Get("snippet_size")); err != nil {
+		return nil, errors.New("invalid snippet_size: " + err.Error())
+	}
+	if req.Snippets, err = intParam(params.Get("snippets")); err != nil {
+		return nil, errors.New("invalid snippets: " + err.Error())
+	}
+
+	for key, values := range params {
+		if field, ok := strings.CutPrefix(key, "filter."); ok && len(values) > 0 {
+			if req.Filters == nil {
+				req.Filters = make(map[string]interface{})
+			}
+			// Repeating a filter selects any of its values
+			if len(values) == 1 {
+				req.Filters[field] = values[0]
+			} else {
+				req.Filters[field] = values
+			}
+		}
+	}
+
+	return req, nil
+}
+
+func intParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func (s *Server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	prefix := params.Get("prefix")
+	if strings.TrimSpace(prefix) == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("prefix is required"))
+		return
+	}
+
+	limit, err := intParam(params.Get("limit"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.New("invalid limit: "+err.Error()))
+		return
+	}
+
+	suggestions, err := s.engine.SuggestWithOptions(r.Context(), prefix, engine.SuggestOptions{
+		Limit:      limit,
+		Popularity: params.Get("popularity") != "false",
+	})
+	if err != nil {
+		s.logger.Error("suggest failed", zap.String("prefix", prefix), zap.Error(err))
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if suggestions == nil {
+		suggestions = []engine.Suggestion{}
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"prefix":      prefix,
+		"suggestions": suggestions,
+	})
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats := s.engine.Stats()
+	s.writeJSON(w, http.StatusOK, statsResponse{
+		DocumentCount: stats.DocumentCount,
+		LastIndexed:   stats.LastIndexed,
+		IndexSize:     stats.IndexSize,
+	})
+}
+
+// handleListDocuments returns a page of documents ordered by ID, without
+// their content. limit sets the page size and cursor, the next_cursor of the
+// previous page, where it starts
+func (s *Server) handleListDocuments(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit, err := intParam(params.Get("limit"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.New("invalid limit: "+err.Error()))
+		return
+	}
+	if limit < 1 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	page, err := s.engine.ListPage(r.Context(), params.Get("cursor"), limit)
+	if err != nil {
+		s.logger.Error("failed to list documents", zap.Error(err))
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := make([]documentResponse, 0, len(page.Documents))
+	for _, doc := range page.Documents {
+		resp = append(resp, toDocumentResponse(doc))
+	}
+
+	body := map[string]interface{}{
+		"total":     page.Total,
+		"documents": resp,
+	}
+	if page.Next != "" {
+		body["next_cursor"] = page.Next
+	}
+	s.writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	doc, err := s.engine.Get(id)
+	if err != nil {
+		s.writeDocumentError(w, id, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, toDocumentResponse(doc))
+}
+
+func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	if err := s.engine.Delete(id); err != nil {
+		s.writeDocumentError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writeDocumentError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, storage.ErrDocumentNotFound) {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	s.logger.Error("document request failed", zap.String("id", id), zap.Error(err))
+	s.writeError(w, http.StatusInternalServerError, err)
+}
+
+func toDocumentResponse(doc engine.Document) documentResponse {
+	return documentResponse{
+		ID:       doc.ID(),
+		Type:     doc.Type(),
+		Content:  doc.Content(),
+		Metadata: doc.Metadata(),
+	}
+}
+
+// handleStartCrawl starts a crawl in the background and returns its ID
+func (s *Server) handleStartCrawl(w http.ResponseWriter, r *http.Request) {
+	req := &crawlRequest{Depth: s.config.DefaultDepth}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(req); err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.New("invalid JSON body: "+err.Error()))
+		return
+	}
+	if req.URL == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("url is required"))
+		return
+	}
+	if req.Depth < 1 {
+		s.writeError(w, http.StatusBadRequest, errors.New("depth must be at least 1"))
+		return
+	}
+
+	crawler, err := s.crawlers()
+	if err != nil {
+		s.logger.Error("failed to create crawler", zap.Error(err))
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	crawler.SetPageStore(s.pages)
+
+	status := &crawlStatus{
+		ID:        crawler.GetID(),
+		URL:       req.URL,
+		Depth:     req.Depth,
+		State:     "running",
+		StartedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.evictCrawls(time.Now())
+	s.crawls[status.ID] = status
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		err := crawler.CrawlWithHandler(s.ctx, req.URL, req.Depth, s.pages.HandleCrawledPage)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		endedAt := time.Now()
+		status.EndedAt = &endedAt
+		if err != nil {
+			s.logger.Error("crawl failed", zap.String("crawl_id", status.ID), zap.Error(err))
+			status.State = "failed"
+			status.Error = err.Error()
+		} else {
+			status.State = "completed"
+		}
+		s.evictCrawls(endedAt)
+	}()
+
+	s.writeJSON(w, http.StatusAccepted, s.crawlSnapshot(status))
+}
+
+// evictCrawls drops the crawls that finished more than crawlRetention
+// before now, then the oldest finished ones past maxFinishedCrawls. Running
+// crawls are kept. The caller holds the write lock
+func (s *Server) evictCrawls(now time.Time) {
+	var finished []*crawlStatus
+	for id, status := range s.crawls {
+		if status.EndedAt == nil {
+			continue
+		}
+		if now.Sub(*status.EndedAt) > crawlRetention {
+			delete(s.crawls, id)
+			continue
+		}
+		finished = append(finished, status)
+	}
+
+	if len(finished) <= maxFinishedCrawls {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].EndedAt.Before(*finished[j].EndedAt)
+	})
+	for _, status := range finished[:len(finished)-maxFinishedCrawls] {
+		delete(s.crawls, status.ID)
+	}
+}
+
+func (s *Server) handleListCrawls(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	crawls := make([]crawlStatus, 0, len(s.crawls))
+	for _, status := range s.crawls {
+		crawls = append(crawls, *status)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(crawls, func(i, j int) bool {
+		return crawls[i].StartedAt.After(crawls[j].StartedAt)
+	})
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"crawls": crawls})
+}
+
+func (s *Server) handleGetCrawl(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	status, ok := s.crawls[r.PathValue("id")]
+	s.mu.RUnlock()
+
+	if !ok {
+		s.writeError(w, http.StatusNotFound, errors.New("crawl not found"))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.crawlSnapshot(status))
+}
+
+// crawlSnapshot copies a crawl status under the lock for encoding
+func (s *Server) crawlSnapshot(status *crawlStatus) crawlStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return *status
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, code int, err error) {
+	resp := errorResponse{Error: err.Error()}
+
+	var syntaxErr *query.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		resp.Position = &syntaxErr.Pos
+	}
+
+	s.writeJSON(w, code, resp)
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"context"
+
+	"go.uber.org/fx"
+)
+
+// Module provides the HTTP API server and ties it to the fx lifecycle
+var Module = fx.Module("api",
+	fx.Provide(NewServer),
+	fx.Invoke(func(lifecycle fx.Lifecycle, server *Server) {
+		lifecycle.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				return server.Start()
+			},
+			OnStop: func(ctx context.Context) error {
+				return server.Stop(ctx)
+			},
+		})
+	}),
+)
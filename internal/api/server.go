@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonesrussell/goprowl/search/adapters/storage"
+	"github.com/jonesrussell/goprowl/search/crawlers"
+	"github.com/jonesrussell/goprowl/search/engine"
+	"go.uber.org/zap"
+)
+
+// Config holds HTTP server configuration
+type Config struct {
+	Addr         string
+	DefaultDepth int // Crawl depth used when a crawl request omits it
+	// MaxExpansions is how many terms of a field a prefix, wildcard,
+	// regular expression or fuzzy term may match, 0 for the engine default
+	MaxExpansions int
+	// Token is the bearer token required by the endpoints that delete
+	// documents or start crawls. They are disabled when it is empty
+	Token string
+}
+
+const (
+	// maxBodyBytes caps the size of JSON request bodies
+	maxBodyBytes = 1 << 20
+	// crawlRetention is how long a finished crawl stays listed
+	crawlRetention = time.Hour
+	// maxFinishedCrawls caps the finished crawls kept, the oldest going first
+	maxFinishedCrawls = 100
+)
+
+// crawlStatus tracks a crawl started through the API
+type crawlStatus struct {
+	ID        string     `json:"id"`
+	URL       string     `json:"url"`
+	Depth     int        `json:"depth"`
+	State     string     `json:"state"` // "running", "completed", "failed"
+	Error     string     `json:"error,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// Server exposes the search engine over a JSON HTTP API
+type Server struct {
+	engine   engine.SearchEngine
+	crawlers crawlers.CrawlerFactory
+	pages    *storage.StorageAdapter
+	logger   *zap.Logger
+	server   *http.Server
+	config   *Config
+
+	// ctx bounds background crawls to the server's lifetime
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	crawls map[string]*crawlStatus
+	wg     sync.WaitGroup
+}
+
+// NewServer creates a new API server
+func NewServer(
+	config *Config,
+	searchEngine engine.SearchEngine,
+	crawlerFactory crawlers.CrawlerFactory,
+	pages *storage.StorageAdapter,
+	logger *zap.Logger,
+) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Server{
+		engine:   searchEngine,
+		crawlers: crawlerFactory,
+		pages:    pages,
+		logger:   logger,
+		config:   config,
+		ctx:      ctx,
+		cancel:   cancel,
+		crawls:   make(map[string]*crawlStatus),
+	}
+
+	s.server = &http.Server{
+		Addr:              config.Addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// routes registers the API endpoints
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/health", s.handleHealth)
+	mux.HandleFunc("GET /api/search", s.handleSearch)
+	mux.HandleFunc("POST /api/search", s.handleSearch)
+	mux.HandleFunc("GET /api/suggest", s.handleSuggest)
+	mux.HandleFunc("GET /api/stats", s.handleStats)
+	mux.HandleFunc("GET /api/documents", s.handleListDocuments)
+	// Document IDs are URLs, so they are passed as a query parameter
+	mux.HandleFunc("GET /api/document", s.handleGetDocument)
+	mux.HandleFunc("DELETE /api/document", s.requireToken(s.handleDeleteDocument))
+	mux.HandleFunc("POST /api/crawls", s.requireToken(s.handleStartCrawl))
+	mux.HandleFunc("GET /api/crawls", s.handleListCrawls)
+	mux.HandleFunc("GET /api/crawls/{id}", s.handleGetCrawl)
+
+	return s.logRequests(mux)
+}
+
+// requireToken guards an endpoint that changes the index or starts crawls:
+// it is disabled unless the server has a token, which the request must then
+// present as "Authorization: Bearer <token>"
+func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.config.Token == "" {
+			s.writeError(w, http.StatusForbidden, errors.New("endpoint disabled: start the server with an API token to enable it"))
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.writeError(w, http.StatusUnauthorized, errors.New("invalid or missing API token"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// logRequests logs each request with its duration
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		s.logger.Debug("handled request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Duration("duration", time.Since(start)))
+	})
+}
+
+// Start begins serving in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+
+	s.logger.Info("starting api server", zap.String("addr", listener.Addr().String()))
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("api server failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Stop gracefully shuts down the server and cancels running crawls
+func (s *Server) Stop(ctx context.Context) error {
+	s.logger.Info("stopping api server")
+
+	err := s.server.Shutdown(ctx)
+	s.cancel()
+	s.wg.Wait()
+
+	if err != nil {
+		return fmt.Errorf("failed to shut down api server: %w", err)
+	}
+	return nil
+}
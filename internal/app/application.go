@@ -111,11 +111,8 @@ func (app *Application) Run(ctx context.Context) error {
 	crawlCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	if err := app.engine.Clear(); err != nil {
-		app.logger.Error("failed to clear existing data", zap.Error(err))
-		return fmt.Errorf("failed to clear existing data: %w", err)
-	}
-
+	// The existing index is kept; the crawler only re-indexes changed pages
+	// and removes pages that are gone
 	if err := app.crawler.Crawl(crawlCtx, app.config.StartURL, app.config.MaxDepth); err != nil {
 		app.logger.Error("crawl failed", zap.Error(err))
 		return fmt.Errorf("crawl failed: %w", err)
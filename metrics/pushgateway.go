@@ -89,7 +89,11 @@ func NewPushGatewayClient(lc fx.Lifecycle, logger *zap.Logger) (*PushGatewayClie
 	// Add lifecycle hooks
 	lc.Append(fx.Hook{
 		OnStop: func(ctx context.Context) error {
-			return client.pusher.Push()
+			// An unreachable pushgateway should not fail shutdown
+			if err := client.pusher.Push(); err != nil {
+				logger.Error("failed to push final metrics", zap.Error(err))
+			}
+			return nil
 		},
 	})
 
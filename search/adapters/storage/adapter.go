@@ -2,34 +2,52 @@ package storage
 
 import (
 	"context"
-	"path/filepath"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jonesrussell/goprowl/search/crawlers"
+	"github.com/jonesrussell/goprowl/search/dedup"
 	"github.com/jonesrussell/goprowl/search/storage"
-	"github.com/jonesrussell/goprowl/search/storage/bleve"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
 // StorageAdapter wraps the storage implementation
 type StorageAdapter struct {
-	storage storage.StorageAdapter
-	logger  *zap.Logger
-}
+	storage   storage.StorageAdapter
+	canonical *crawlers.Canonicalizer
+	cfg       *crawlers.Config
+	logger    *zap.Logger
 
-// NewStorageAdapter creates a new storage adapter
-func NewStorageAdapter(logger *zap.Logger) (*StorageAdapter, error) {
-	storagePath := filepath.Join("data", "search.bleve")
-	storage, err := bleve.New(storagePath)
-	if err != nil {
-		return nil, err
-	}
+	// duplicates holds the fingerprints of stored pages, loaded from storage
+	// the first time a page is checked. dupMu serializes the check and store
+	// of a page, so near-duplicates crawled together join one cluster
+	dupMu      sync.Mutex
+	duplicates *dedup.Index
+	dupLoaded  bool
+}
 
-	logger.Info("initialized storage adapter", zap.String("path", storagePath))
+// NewStorageAdapter creates a new storage adapter over the application's
+// storage backend, so crawled pages land in the same index the engine reads.
+// Pages are keyed by their canonical URL
+func NewStorageAdapter(
+	storage storage.StorageAdapter,
+	canonicalizer *crawlers.Canonicalizer,
+	cfg *crawlers.Config,
+	logger *zap.Logger,
+) (*StorageAdapter, error) {
+	logger.Info("initialized storage adapter")
 	return &StorageAdapter{
-		storage: storage,
-		logger:  logger,
+		storage:    storage,
+		canonical:  canonicalizer,
+		cfg:        cfg,
+		logger:     logger,
+		duplicates: dedup.NewIndex(cfg.DuplicateDistance),
 	}, nil
 }
 
@@ -38,25 +56,62 @@ var Module = fx.Module("storage",
 	fx.Provide(NewStorageAdapter),
 )
 
-// HandleCrawledPage stores a crawled page in the storage
+// HandleCrawledPage stores a crawled page in the storage. Depending on the
+// configured duplicate mode, a page nearly matching a stored page is either
+// stored under the same cluster ID or not stored, returning an error
+// wrapping crawlers.ErrNearDuplicate
 func (a *StorageAdapter) HandleCrawledPage(ctx context.Context, result *crawlers.CrawlResult) error {
 	a.logger.Debug("handling crawled page",
 		zap.String("url", result.URL),
 		zap.String("title", result.Title),
 		zap.Int("content_length", len(result.Content)))
 
+	pageURL := a.canonicalURL(result.URL)
 	doc := &storage.Document{
-		URL:       result.URL,
+		URL:       pageURL,
 		Title:     result.Title,
 		Content:   result.Content,
 		Type:      "webpage",
 		CreatedAt: time.Now(),
 		Metadata: map[string]interface{}{
-			"links":      result.Links,
-			"created_at": result.CreatedAt,
+			"links":        result.Links,
+			"created_at":   result.CreatedAt,
+			"content_hash": result.ContentHash,
 		},
 	}
+	if len(result.Headings) > 0 {
+		doc.Metadata["headings"] = result.Headings
+	}
+	if variants := urlVariants(pageURL, result); len(variants) > 0 {
+		doc.Metadata["url_variants"] = variants
+	}
+	if result.ETag != "" {
+		doc.Metadata["etag"] = result.ETag
+	}
+	if result.LastModified != "" {
+		doc.Metadata["last_modified"] = result.LastModified
+		if modified, err := http.ParseTime(result.LastModified); err == nil {
+			doc.Metadata["modified_at"] = modified
+		}
+	}
+	for key, value := range facetMetadata(result) {
+		doc.Metadata[key] = value
+	}
+	for key, value := range structuredMetadata(result.Structured) {
+		doc.Metadata[key] = value
+	}
+	for key, value := range result.Metadata {
+		doc.Metadata[key] = value
+	}
 
+	if a.cfg.Duplicates != crawlers.DuplicatesOff {
+		return a.storeUnlessDuplicate(ctx, doc, result)
+	}
+	return a.store(ctx, doc, result)
+}
+
+// store saves a document built from a crawled page
+func (a *StorageAdapter) store(ctx context.Context, doc *storage.Document, result *crawlers.CrawlResult) error {
 	if err := a.storage.Store(ctx, doc); err != nil {
 		a.logger.Error("failed to store document",
 			zap.String("url", result.URL),
@@ -70,3 +125,104 @@ func (a *StorageAdapter) HandleCrawledPage(ctx context.Context, result *crawlers
 		zap.Int("links_count", len(result.Links)))
 	return nil
 }
+
+// LookupPage implements crawlers.PageStore, returning the change detection
+// state stored with a previously crawled page
+func (a *StorageAdapter) LookupPage(ctx context.Context, url string) (*crawlers.PageContent, error) {
+	url = a.canonicalURL(url)
+	doc, err := a.storage.Get(ctx, url)
+	if errors.Is(err, storage.ErrDocumentNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up page %s: %w", url, err)
+	}
+
+	return &crawlers.PageContent{
+		URL:          doc.URL,
+		Content:      doc.Content,
+		ContentHash:  stringMetadata(doc.Metadata, "content_hash"),
+		LastUpdated:  doc.CreatedAt,
+		ETag:         stringMetadata(doc.Metadata, "etag"),
+		LastModified: stringMetadata(doc.Metadata, "last_modified"),
+		Links:        stringsMetadata(doc.Metadata, "links"),
+	}, nil
+}
+
+// DeletePage implements crawlers.PageStore
+func (a *StorageAdapter) DeletePage(ctx context.Context, url string) error {
+	url = a.canonicalURL(url)
+	if err := a.storage.Delete(ctx, url); err != nil {
+		return fmt.Errorf("failed to delete page %s: %w", url, err)
+	}
+	a.duplicates.Remove(url)
+	return nil
+}
+
+// canonicalURL returns the canonical form of a page URL, or the URL itself
+// when it cannot be parsed
+func (a *StorageAdapter) canonicalURL(pageURL string) string {
+	if canonical, err := a.canonical.Canonicalize(pageURL); err == nil {
+		return canonical
+	}
+	return pageURL
+}
+
+// urlVariants lists the URLs a page was found as other than its canonical URL
+func urlVariants(pageURL string, result *crawlers.CrawlResult) []string {
+	var variants []string
+	seen := map[string]bool{pageURL: true}
+	for _, variant := range append([]string{result.URL}, result.Variants...) {
+		if !seen[variant] {
+			seen[variant] = true
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+// facetMetadata returns the attributes of a page that search results are
+// faceted on
+func facetMetadata(result *crawlers.CrawlResult) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"content_length": result.ContentLength,
+	}
+	if u, err := url.Parse(result.URL); err == nil && u.Hostname() != "" {
+		metadata["host"] = strings.ToLower(u.Hostname())
+	}
+	if result.ContentType != "" {
+		metadata["content_type"] = result.ContentType
+	}
+	if result.Language != "" {
+		metadata["language"] = result.Language
+	}
+	if result.Job != "" {
+		metadata["job"] = result.Job
+	}
+	return metadata
+}
+
+func stringMetadata(metadata map[string]interface{}, key string) string {
+	value, _ := metadata[key].(string)
+	return value
+}
+
+// stringsMetadata reads a list field, which storage returns as a single
+// string when the list had one element
+func stringsMetadata(metadata map[string]interface{}, key string) []string {
+	switch value := metadata[key].(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if str, ok := v.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jonesrussell/goprowl/search/crawlers"
+	"github.com/jonesrussell/goprowl/search/dedup"
+	"github.com/jonesrussell/goprowl/search/storage"
+	"go.uber.org/zap"
+)
+
+// storeUnlessDuplicate fingerprints a page and looks for a stored page
+// within the configured distance before storing it. In cluster mode the
+// page joins that page's cluster, otherwise it starts its own; in skip mode
+// it is not stored at all
+func (a *StorageAdapter) storeUnlessDuplicate(ctx context.Context, doc *storage.Document, result *crawlers.CrawlResult) error {
+	fp := result.Fingerprint
+	if fp == 0 {
+		fp = dedup.NewFingerprint(doc.Content)
+	}
+
+	a.dupMu.Lock()
+	defer a.dupMu.Unlock()
+
+	if err := a.loadDuplicates(ctx); err != nil {
+		return err
+	}
+
+	cluster := fp.String()
+	if match, ok := a.duplicates.Nearest(fp, a.cfg.DuplicateDistance, doc.URL); ok {
+		if a.cfg.Duplicates == crawlers.DuplicatesSkip {
+			// A page that has become a copy of another is no longer indexed
+			if a.duplicates.Has(doc.URL) {
+				if err := a.DeletePage(ctx, doc.URL); err != nil {
+					return err
+				}
+			}
+			return fmt.Errorf("%w of %s (%d bits apart)", crawlers.ErrNearDuplicate, match.ID, match.Distance)
+		}
+
+		a.logger.Debug("near-duplicate page joins cluster",
+			zap.String("url", doc.URL),
+			zap.String("duplicate_of", match.ID),
+			zap.String("cluster_id", match.Cluster),
+			zap.Int("distance", match.Distance))
+		cluster = match.Cluster
+	}
+
+	doc.Metadata["simhash"] = fp.String()
+	doc.Metadata["cluster_id"] = cluster
+	if err := a.store(ctx, doc, result); err != nil {
+		return err
+	}
+	a.duplicates.Add(doc.URL, fp, cluster)
+	return nil
+}
+
+// loadDuplicates fills the fingerprint index from the stored pages the first
+// time it is needed, loading only their fingerprint and cluster when the
+// storage can list some fields alone. Callers hold dupMu
+func (a *StorageAdapter) loadDuplicates(ctx context.Context) error {
+	if a.dupLoaded {
+		return nil
+	}
+
+	var err error
+	if lister, ok := a.storage.(storage.FieldLister); ok {
+		err = a.loadFingerprints(ctx, lister)
+	} else {
+		err = a.loadDocumentFingerprints(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load page fingerprints: %w", err)
+	}
+
+	a.logger.Debug("loaded page fingerprints", zap.Int("pages", a.duplicates.Len()))
+	a.dupLoaded = true
+	return nil
+}
+
+// loadFingerprints adds the stored pages to the fingerprint index from
+// their simhash and cluster_id fields. Callers hold dupMu
+func (a *StorageAdapter) loadFingerprints(ctx context.Context, lister storage.FieldLister) error {
+	// Pages stored before fingerprinting are fingerprinted from their
+	// content, read once the listing is done
+	var unfingerprinted []string
+	err := lister.ListFields(ctx, []string{"simhash", "cluster_id"}, func(id string, fields map[string]interface{}) error {
+		fp, err := dedup.ParseFingerprint(stringMetadata(fields, "simhash"))
+		if err != nil {
+			unfingerprinted = append(unfingerprinted, id)
+			return nil
+		}
+		a.addDuplicate(id, fp, stringMetadata(fields, "cluster_id"))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range unfingerprinted {
+		doc, err := a.storage.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		a.addDuplicate(id, dedup.NewFingerprint(doc.Content), stringMetadata(doc.Metadata, "cluster_id"))
+	}
+	return nil
+}
+
+// loadDocumentFingerprints adds every stored document to the fingerprint
+// index, for storage that cannot list some fields alone. Callers hold dupMu
+func (a *StorageAdapter) loadDocumentFingerprints(ctx context.Context) error {
+	docs, err := a.storage.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		fp, err := dedup.ParseFingerprint(stringMetadata(doc.Metadata, "simhash"))
+		if err != nil {
+			// Pages stored before fingerprinting are fingerprinted now
+			fp = dedup.NewFingerprint(doc.Content)
+		}
+		a.addDuplicate(doc.URL, fp, stringMetadata(doc.Metadata, "cluster_id"))
+	}
+	return nil
+}
+
+// addDuplicate adds a stored page to the fingerprint index, in the cluster
+// of its own fingerprint when it has none. Callers hold dupMu
+func (a *StorageAdapter) addDuplicate(id string, fp dedup.Fingerprint, cluster string) {
+	if cluster == "" {
+		cluster = fp.String()
+	}
+	a.duplicates.Add(id, fp, cluster)
+}
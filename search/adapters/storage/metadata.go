@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"github.com/jonesrussell/goprowl/search/extract"
+)
+
+// structuredMetadata flattens the structured data a page declares into
+// document fields. Only values the page gives are set; a publication or
+// modification time the page declares takes precedence over response headers
+func structuredMetadata(meta *extract.Metadata) map[string]interface{} {
+	metadata := make(map[string]interface{})
+	if meta == nil {
+		return metadata
+	}
+
+	setString := func(key, value string) {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	setStrings := func(key string, values []string) {
+		if len(values) > 0 {
+			metadata[key] = values
+		}
+	}
+
+	setString("description", meta.Description)
+	setStrings("keywords", meta.Keywords)
+	setString("author", meta.Author)
+	if !meta.Published.IsZero() {
+		metadata["published_at"] = meta.Published
+	}
+	if !meta.Modified.IsZero() {
+		metadata["modified_at"] = meta.Modified
+	}
+
+	setString("og_title", meta.OpenGraph.Title)
+	setString("og_description", meta.OpenGraph.Description)
+	setString("og_type", meta.OpenGraph.Type)
+	setString("og_url", meta.OpenGraph.URL)
+	setString("og_image", meta.OpenGraph.Image)
+	setString("og_site_name", meta.OpenGraph.SiteName)
+
+	setString("twitter_card", meta.Twitter.Card)
+	setString("twitter_title", meta.Twitter.Title)
+	setString("twitter_description", meta.Twitter.Description)
+	setString("twitter_image", meta.Twitter.Image)
+	setString("twitter_site", meta.Twitter.Site)
+	setString("twitter_creator", meta.Twitter.Creator)
+
+	setStrings("schema_types", meta.Types())
+
+	var headlines []string
+	for _, article := range meta.Articles {
+		if article.Headline != "" {
+			headlines = append(headlines, article.Headline)
+		}
+	}
+	setStrings("headline", headlines)
+
+	var names, brands, skus, currencies, availability []string
+	var prices []float64
+	for _, product := range meta.Products {
+		if product.Name != "" {
+			names = append(names, product.Name)
+		}
+		if product.Brand != "" {
+			brands = append(brands, product.Brand)
+		}
+		if product.SKU != "" {
+			skus = append(skus, product.SKU)
+		}
+		// A product is found at its lowest price
+		if offer, ok := lowestOffer(product.Offers); ok {
+			prices = append(prices, offer.Price)
+			if offer.Currency != "" {
+				currencies = append(currencies, offer.Currency)
+			}
+		}
+		for _, offer := range product.Offers {
+			if offer.Availability != "" {
+				availability = append(availability, offer.Availability)
+			}
+		}
+	}
+	setStrings("product_name", names)
+	setStrings("product_brand", brands)
+	setStrings("product_sku", skus)
+	setStrings("product_availability", availability)
+	setStrings("product_currency", currencies)
+	if len(prices) > 0 {
+		metadata["product_price"] = prices
+	}
+
+	var trail []string
+	for _, list := range meta.Breadcrumbs {
+		for _, crumb := range list.Items {
+			if crumb.Name != "" {
+				trail = append(trail, crumb.Name)
+			}
+		}
+	}
+	setStrings("breadcrumbs", trail)
+
+	return metadata
+}
+
+func lowestOffer(offers []extract.Offer) (extract.Offer, bool) {
+	if len(offers) == 0 {
+		return extract.Offer{}, false
+	}
+	lowest := offers[0]
+	for _, offer := range offers[1:] {
+		if offer.Price < lowest.Price {
+			lowest = offer
+		}
+	}
+	return lowest, true
+}
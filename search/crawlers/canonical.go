@@ -0,0 +1,217 @@
+package crawlers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// maxURLVariants caps how many alternative spellings are kept for a URL
+const maxURLVariants = 20
+
+// DefaultTrackingParams are query parameters that only carry campaign or
+// click tracking and are stripped from canonical URLs. A trailing "*"
+// matches any parameter with that prefix
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"dclid",
+	"fbclid",
+	"msclkid",
+	"yclid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_gl",
+	"_hsenc",
+	"_hsmi",
+	"igshid",
+}
+
+// Canonicalizer reduces the spellings of a URL to one canonical form, so a
+// page reached as "HTTP://Example.com:80/docs/?utm_source=x#intro" and as
+// "http://example.com/docs" is crawled and indexed once
+type Canonicalizer struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+// NewCanonicalizer creates a canonicalizer stripping the configured
+// tracking parameters
+func NewCanonicalizer(cfg *Config) *Canonicalizer {
+	c := &Canonicalizer{exact: make(map[string]bool)}
+	for _, param := range cfg.TrackingParams {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			c.prefixes = append(c.prefixes, prefix)
+		} else if param != "" {
+			c.exact[param] = true
+		}
+	}
+	return c
+}
+
+// Canonicalize returns the canonical form of an absolute http(s) URL:
+//   - scheme and host are lowercased and default ports removed
+//   - dot segments and trailing slashes are removed from the path, which is
+//     "/" for the site root, and its percent-escapes uppercased
+//   - the fragment and tracking parameters are dropped and the remaining
+//     query parameters sorted by name
+//
+// Other URLs are returned unchanged
+func (c *Canonicalizer) Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %s: %w", rawURL, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return u.String(), nil
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !isDefaultPort(u.Scheme, port) {
+		host += ":" + port
+	} else if strings.Contains(host, ":") {
+		// IPv6 literals keep their brackets without a port
+		host = "[" + host + "]"
+	}
+	u.Host = host
+
+	u.Fragment, u.RawFragment = "", ""
+	// The path is cleaned in its escaped form, so an escaped "/" such as
+	// "%2F" stays part of its segment
+	escaped := upperEscapes(canonicalPath(u.EscapedPath()))
+	if u.Path, err = url.PathUnescape(escaped); err != nil {
+		return "", fmt.Errorf("invalid URL %s: %w", rawURL, err)
+	}
+	u.RawPath = ""
+	if u.EscapedPath() != escaped {
+		u.RawPath = escaped
+	}
+	u.RawQuery = c.canonicalQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func isDefaultPort(scheme, port string) bool {
+	return (scheme == "http" && port == "80") || (scheme == "https" && port == "443")
+}
+
+// canonicalPath resolves dot segments and drops a trailing slash
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	segments := strings.Split(p, "/")
+	resolved := make([]string, 0, len(segments))
+	for _, segment := range segments[1:] {
+		switch segment {
+		case ".":
+		case "..":
+			if len(resolved) > 0 {
+				resolved = resolved[:len(resolved)-1]
+			}
+		default:
+			resolved = append(resolved, segment)
+		}
+	}
+
+	p = "/" + strings.Join(resolved, "/")
+	if len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+// upperEscapes uppercases the hex digits of the percent-escapes in s, so
+// "%2f" and "%2F" spell the same URL
+func upperEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	b := []byte(s)
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] == '%' {
+			b[i+1] = upperHex(b[i+1])
+			b[i+2] = upperHex(b[i+2])
+			i += 2
+		}
+	}
+	return string(b)
+}
+
+func upperHex(c byte) byte {
+	if 'a' <= c && c <= 'f' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// canonicalQuery drops tracking parameters and sorts the rest by name,
+// keeping the order of repeated parameters
+func (c *Canonicalizer) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct{ key, pair string }
+	var params []param
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+		if c.isTracking(key) {
+			continue
+		}
+		params = append(params, param{key: key, pair: pair})
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].key < params[j].key
+	})
+
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.pair
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (c *Canonicalizer) isTracking(key string) bool {
+	key = strings.ToLower(key)
+	if c.exact[key] {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addVariant adds a URL spelling to a list of variants unless it is the
+// canonical URL itself, already listed, or the list is full
+func addVariant(variants []string, canonical, variant string) []string {
+	if variant == "" || variant == canonical || len(variants) >= maxURLVariants {
+		return variants
+	}
+	for _, v := range variants {
+		if v == variant {
+			return variants
+		}
+	}
+	return append(variants, variant)
+}
@@ -0,0 +1,39 @@
+package crawlers
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	c := NewCanonicalizer(&Config{TrackingParams: DefaultTrackingParams})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"HTTP://Example.com:80/docs/?utm_source=x#intro", "http://example.com/docs"},
+		{"https://example.com:443", "https://example.com/"},
+		{"https://example.com:8443/", "https://example.com:8443/"},
+		{"http://[::1]:80/a", "http://[::1]/a"},
+		{"http://example.com/a/./b/../c/", "http://example.com/a/c"},
+		{"http://example.com/../a", "http://example.com/a"},
+		{"http://example.com/?b=2&a=1&a=0&gclid=x", "http://example.com/?a=1&a=0&b=2"},
+		{"http://example.com/?", "http://example.com/"},
+		{"http://example.com/a%2Fb", "http://example.com/a%2Fb"},
+		{"http://example.com/a%2fb", "http://example.com/a%2Fb"},
+		{"http://example.com/a%2Fb/../c", "http://example.com/c"},
+		{"http://example.com/caf%c3%a9", "http://example.com/caf%C3%A9"},
+		{"http://example.com/a%20b", "http://example.com/a%20b"},
+		{"mailto:Someone@Example.com", "mailto:Someone@Example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := c.Canonicalize(tt.url)
+			if err != nil {
+				t.Fatalf("Canonicalize(%q) error: %v", tt.url, err)
+			}
+			if got != tt.want {
+				t.Errorf("Canonicalize(%q) = %s, want %s", tt.url, got, tt.want)
+			}
+		})
+	}
+}
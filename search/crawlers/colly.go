@@ -2,12 +2,21 @@ package crawlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"mime"
+	"net/http"
 	"net/url"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gocolly/colly/v2"
 	"github.com/jonesrussell/goprowl/metrics"
+	"github.com/jonesrussell/goprowl/search/dedup"
+	"github.com/jonesrussell/goprowl/search/extract"
 	"go.uber.org/zap"
 )
 
@@ -18,8 +27,25 @@ type CollyCrawler struct {
 	id           string
 	logger       *zap.Logger
 	cfg          *Config
+	pages        PageStore
+	robots       *RobotsPolicy
+	scheduler    *Scheduler
+	canonical    *Canonicalizer
+	scope        *crawlScope // URLs the current crawl follows
 	startTime    time.Time
-	pagesVisited int
+	pagesVisited int64
+
+	// Incremental recrawl counters
+	pagesUnchanged   int64
+	pagesNotModified int64
+	pagesRemoved     int64
+
+	// Pages excluded by robots.txt or robots directives
+	pagesDisallowed int64
+	pagesNoIndex    int64
+
+	// Pages not indexed as near-duplicates of indexed pages
+	pagesDuplicate int64
 }
 
 func NewCollyCrawler(
@@ -27,6 +53,8 @@ func NewCollyCrawler(
 	collector *colly.Collector,
 	metrics *metrics.ComponentMetrics,
 	pushgateway *metrics.PushGatewayClient,
+	scheduler *Scheduler,
+	canonicalizer *Canonicalizer,
 	cfg *Config,
 ) (Crawler, error) {
 	if logger == nil {
@@ -35,6 +63,12 @@ func NewCollyCrawler(
 	if cfg == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
+	if scheduler == nil {
+		return nil, fmt.Errorf("scheduler cannot be nil")
+	}
+	if canonicalizer == nil {
+		return nil, fmt.Errorf("canonicalizer cannot be nil")
+	}
 
 	uniqueID := fmt.Sprintf("crawler-%d", time.Now().UnixNano())
 
@@ -45,6 +79,9 @@ func NewCollyCrawler(
 		id:           uniqueID,
 		logger:       logger,
 		cfg:          cfg,
+		robots:       NewRobotsPolicy(cfg, logger),
+		scheduler:    scheduler,
+		canonical:    canonicalizer,
 		pagesVisited: 0,
 	}
 
@@ -63,6 +100,12 @@ func setupCallbacks(c *colly.Collector, m *metrics.ComponentMetrics, logger *zap
 
 	c.OnError(func(r *colly.Response, err error) {
 		m.DecrementActiveRequests()
+		if r.StatusCode == http.StatusNotModified {
+			logger.Debug("page not modified",
+				zap.String("url", r.Request.URL.String()),
+			)
+			return
+		}
 		m.IncrementErrorCount()
 		logger.Error("error visiting url",
 			zap.String("url", r.Request.URL.String()),
@@ -80,23 +123,6 @@ func setupCallbacks(c *colly.Collector, m *metrics.ComponentMetrics, logger *zap
 			zap.Int("status", r.StatusCode),
 		)
 	})
-
-	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
-		link := e.Attr("href")
-		absLink := e.Request.AbsoluteURL(link)
-		if absLink != "" {
-			logger.Debug("found link",
-				zap.String("source_url", e.Request.URL.String()),
-				zap.String("link", absLink),
-			)
-			if err := e.Request.Visit(absLink); err != nil {
-				logger.Debug("failed to visit link",
-					zap.String("link", absLink),
-					zap.Error(err),
-				)
-			}
-		}
-	})
 }
 
 // GetID returns the crawler's unique identifier
@@ -104,6 +130,11 @@ func (c *CollyCrawler) GetID() string {
 	return c.id
 }
 
+// SetPageStore implements the Crawler interface
+func (c *CollyCrawler) SetPageStore(store PageStore) {
+	c.pages = store
+}
+
 // Crawl implements the Crawler interface
 func (c *CollyCrawler) Crawl(ctx context.Context, startURL string, depth int) error {
 	// Create a default handler that just logs
@@ -117,21 +148,197 @@ func (c *CollyCrawler) Crawl(ctx context.Context, startURL string, depth int) er
 	return c.CrawlWithHandler(ctx, startURL, depth, defaultHandler)
 }
 
-// CrawlWithHandler implements the Crawler interface
+// CrawlWithHandler implements the Crawler interface, crawling a single seed
+// restricted to its own host
 func (c *CollyCrawler) CrawlWithHandler(ctx context.Context, startURL string, depth int, handler PageHandler) error {
+	// Verify URL is valid
+	if _, err := url.Parse(startURL); err != nil {
+		c.logger.Error("invalid url",
+			zap.String("url", startURL),
+			zap.Error(err),
+		)
+		return fmt.Errorf("invalid URL %s: %w", startURL, err)
+	}
+
+	return c.CrawlJobWithHandler(ctx, &CrawlJob{
+		Seeds:    []string{startURL},
+		MaxDepth: depth,
+	}, handler)
+}
+
+// CrawlJobWithHandler implements the Crawler interface. All seeds share one
+// frontier, so a URL reachable from several seeds is fetched once
+func (c *CollyCrawler) CrawlJobWithHandler(ctx context.Context, job *CrawlJob, handler PageHandler) error {
+	if err := job.Validate(); err != nil {
+		return err
+	}
+
+	info := job.info(c.id)
+	info.SitemapOnly = info.SitemapOnly || c.cfg.SitemapOnly
+	info.State = "running"
+	info.StartedAt = time.Now()
+
+	scope, err := scopeOf(info)
+	if err != nil {
+		return err
+	}
+	c.scope = scope
+
+	frontier, err := OpenFrontier(c.cfg.FrontierDir, c.id)
+	if err != nil {
+		return fmt.Errorf("failed to open crawl frontier: %w", err)
+	}
+	defer frontier.Close()
+
+	if err := frontier.SetLimit(info.MaxPages); err != nil {
+		return fmt.Errorf("failed to limit crawl frontier: %w", err)
+	}
+	if err := frontier.SaveInfo(info); err != nil {
+		return fmt.Errorf("failed to save crawl info: %w", err)
+	}
+
+	// Sitemap URLs are seeded first so a seed listed in a sitemap keeps its
+	// sitemap attributes. Each site's sitemaps are read once
+	seeded := 0
+	sites := make(map[string]bool)
+	for _, seed := range info.Seeds {
+		site := seed
+		if u, err := url.Parse(seed); err == nil {
+			site = strings.ToLower(u.Scheme + "://" + u.Host)
+		}
+		if sites[site] {
+			continue
+		}
+		sites[site] = true
+
+		n, err := c.seedFromSitemaps(ctx, frontier, seed)
+		if err != nil {
+			return err
+		}
+		seeded += n
+	}
+
+	if info.SitemapOnly {
+		if seeded == 0 {
+			return fmt.Errorf("no sitemap URLs found for %s", strings.Join(info.Seeds, ", "))
+		}
+	} else {
+		for _, seed := range info.Seeds {
+			canonical, err := c.canonical.Canonicalize(seed)
+			if err != nil {
+				return err
+			}
+			if _, err := frontier.AddVariant(canonical, seed, 1); err != nil {
+				return fmt.Errorf("failed to seed crawl frontier: %w", err)
+			}
+		}
+	}
+
+	return c.run(ctx, frontier, info, handler)
+}
+
+// seedFromSitemaps enqueues the pages listed in the sitemaps of seedURL's
+// site as crawl seeds, returning how many were added
+func (c *CollyCrawler) seedFromSitemaps(ctx context.Context, frontier *Frontier, seedURL string) (int, error) {
+	urls, err := NewSitemapDiscoverer(c.cfg, c.robots, c.logger).Discover(ctx, seedURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to discover sitemaps: %w", err)
+	}
+
+	seeded, outside := 0, 0
+	for _, sitemapURL := range urls {
+		if loc, err := c.canonical.Canonicalize(sitemapURL.Loc); err == nil {
+			sitemapURL.Loc = loc
+		}
+		if !c.scope.Allows(sitemapURL.Loc) {
+			outside++
+			continue
+		}
+		added, err := frontier.AddFromSitemap(sitemapURL, 1)
+		if err != nil {
+			return seeded, fmt.Errorf("failed to seed crawl frontier: %w", err)
+		}
+		if added {
+			seeded++
+		}
+	}
+
+	c.logger.Info("seeded crawl from sitemaps",
+		zap.String("url", seedURL),
+		zap.Int("urls", seeded),
+		zap.Int("outside_scope", outside))
+
+	return seeded, nil
+}
+
+// ResumeWithHandler implements the Crawler interface
+func (c *CollyCrawler) ResumeWithHandler(ctx context.Context, crawlID string, handler PageHandler) error {
+	frontier, err := OpenExistingFrontier(c.cfg.FrontierDir, crawlID)
+	if err != nil {
+		return fmt.Errorf("failed to open crawl frontier: %w", err)
+	}
+	defer frontier.Close()
+
+	info, err := frontier.Info()
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return fmt.Errorf("%w: %s has no crawl info", ErrCrawlNotFound, crawlID)
+	}
+	if info.State == "completed" {
+		c.logger.Info("crawl already completed", zap.String("crawl_id", crawlID))
+		return nil
+	}
+
+	scope, err := scopeOf(info)
+	if err != nil {
+		return err
+	}
+	c.scope = scope
+
+	if err := frontier.SetLimit(info.MaxPages); err != nil {
+		return fmt.Errorf("failed to limit crawl frontier: %w", err)
+	}
+
+	requeued, err := frontier.Requeue()
+	if err != nil {
+		return err
+	}
+
+	c.id = crawlID
+	c.logger.Info("resuming crawl",
+		zap.String("crawl_id", crawlID),
+		zap.String("url", info.StartURL),
+		zap.Int("requeued", requeued))
+
+	return c.run(ctx, frontier, info, handler)
+}
+
+// run drains the frontier, fetching pages as the scheduler allows and
+// enqueueing discovered links, until nothing is pending or ctx is done
+func (c *CollyCrawler) run(ctx context.Context, frontier *Frontier, info *CrawlInfo, handler PageHandler) error {
 	c.startTime = time.Now()
 
 	// Add structured crawl status logging
 	statusLogger := c.logger.With(
 		zap.String("crawler_id", c.id),
-		zap.String("url", startURL),
-		zap.Int("depth", depth),
+		zap.String("job", info.Job),
+		zap.String("url", info.StartURL),
+		zap.Int("depth", info.MaxDepth),
 	)
 
 	// Log initial crawl status
 	statusLogger.Info("crawl started",
 		zap.Time("start_time", c.startTime),
-		zap.Int("target_depth", depth))
+		zap.Int("target_depth", info.MaxDepth))
+
+	crawlCtx := ctx
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		crawlCtx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
 
 	// Add periodic status updates
 	ticker := time.NewTicker(30 * time.Second)
@@ -141,10 +348,17 @@ func (c *CollyCrawler) CrawlWithHandler(ctx context.Context, startURL string, de
 		for {
 			select {
 			case <-ticker.C:
+				stats, err := frontier.Stats()
+				if err != nil {
+					statusLogger.Error("failed to read frontier stats", zap.Error(err))
+					continue
+				}
 				statusLogger.Info("crawl status update",
-					zap.Int("pages_visited", c.pagesVisited),
+					zap.Int64("pages_visited", atomic.LoadInt64(&c.pagesVisited)),
+					zap.Int("pending", stats[URLPending]),
+					zap.Int("failed", stats[URLFailed]),
 					zap.Duration("elapsed_time", time.Since(c.startTime)))
-			case <-ctx.Done():
+			case <-crawlCtx.Done():
 				return
 			}
 		}
@@ -160,29 +374,77 @@ func (c *CollyCrawler) CrawlWithHandler(ctx context.Context, startURL string, de
 		}
 	}()
 
-	// Verify URL is valid
-	parsedURL, err := url.Parse(startURL)
-	if err != nil {
-		c.logger.Error("invalid url",
-			zap.String("url", startURL),
-			zap.Error(err),
-		)
-		return fmt.Errorf("invalid URL %s: %w", startURL, err)
-	}
-
-	// Allow the domain we're crawling
-	c.collector.AllowedDomains = []string{parsedURL.Host}
+	// The frontier schedules requests, so the collector runs synchronously
+	// inside each worker and follows no links on its own
+	c.collector.Async = false
+	// Domains are checked by the crawl scope, which understands patterns
+	c.collector.AllowedDomains = nil
 
 	// Configure collector callbacks for handling pages
+	// Keep the status of failed responses so fetch can tell a 304 or a
+	// removed page from other errors
+	c.collector.OnError(func(r *colly.Response, err error) {
+		r.Ctx.Put("status", r.StatusCode)
+		if r.Headers != nil {
+			r.Ctx.Put("retry_after", r.Headers.Get("Retry-After"))
+		}
+	})
+
 	c.collector.OnHTML("html", func(e *colly.HTMLElement) {
-		c.pagesVisited++
+		atomic.AddInt64(&c.pagesVisited, 1)
+
+		directives := c.pageDirectives(e)
+		if directives.NoFollow {
+			e.Request.Ctx.Put("nofollow", true)
+		}
+		if directives.NoIndex {
+			atomic.AddInt64(&c.pagesNoIndex, 1)
+			e.Request.Ctx.Put("skip", "noindex")
+			c.logger.Info("skipping noindex page",
+				zap.String("url", e.Request.URL.String()))
+			if _, ok := e.Request.Ctx.GetAny("stored").(*PageContent); ok {
+				c.removePage(ctx, e.Request.URL.String(), e.Response.StatusCode)
+			}
+			return
+		}
+
+		hash := contentHash(e.Response.Body)
+		if stored, ok := e.Request.Ctx.GetAny("stored").(*PageContent); ok && stored.ContentHash == hash {
+			atomic.AddInt64(&c.pagesUnchanged, 1)
+			c.logger.Debug("page unchanged, skipping",
+				zap.String("url", e.Request.URL.String()))
+			return
+		}
+
+		pageURL, variants := c.pageURL(e)
+		main := extract.Main(e.DOM)
+		meta := extract.ParseMetadata(e.DOM)
 		result := &CrawlResult{
-			URL:   e.Request.URL.String(),
+			URL:   pageURL,
 			Title: e.ChildText("title"),
 
-			Content:   e.Text,
-			Links:     e.ChildAttrs("a[href]", "href"),
-			CreatedAt: time.Now().Format(time.RFC3339),
+			Content:      main.Text,
+			Headings:     main.Headings,
+			Links:        e.ChildAttrs("a[href]", "href"),
+			CreatedAt:    time.Now().Format(time.RFC3339),
+			ContentHash:  hash,
+			ETag:         e.Response.Headers.Get("ETag"),
+			LastModified: e.Response.Headers.Get("Last-Modified"),
+
+			ContentType:   mediaType(e.Response.Headers.Get("Content-Type")),
+			ContentLength: len(e.Response.Body),
+			Language:      primaryLanguage(meta.Language),
+			Job:           info.Job,
+			Variants:      variants,
+			Structured:    meta,
+		}
+		result.Fingerprint = dedup.NewFingerprint(result.Content)
+		if sitemapURL, ok := e.Request.Ctx.GetAny("sitemap").(*SitemapURL); ok {
+			result.Metadata = sitemapURL.Metadata()
+		}
+		if directives.NoFollow {
+			// Links are kept for following on 304s, which nofollow rules out
+			result.Links = nil
 		}
 
 		c.logger.Debug("processing page",
@@ -190,71 +452,515 @@ func (c *CollyCrawler) CrawlWithHandler(ctx context.Context, startURL string, de
 			zap.String("title", result.Title),
 			zap.Int("links_count", len(result.Links)))
 
-		if err := handler(ctx, result); err != nil {
+		if err := handler(ctx, result); errors.Is(err, ErrNearDuplicate) {
+			atomic.AddInt64(&c.pagesDuplicate, 1)
+			e.Request.Ctx.Put("skip", err.Error())
+			c.logger.Info("skipping near-duplicate page",
+				zap.String("url", result.URL),
+				zap.Error(err))
+		} else if err != nil {
 			c.logger.Error("handler failed",
 				zap.String("url", result.URL),
 				zap.Error(err))
 		}
 	})
 
-	// Configure parallel requests using config values
-	if err := c.collector.Limit(&colly.LimitRule{
-		DomainGlob:  "*",
-		Parallelism: c.cfg.Parallelism,
-		RandomDelay: c.cfg.RequestDelay,
-	}); err != nil {
-		return fmt.Errorf("failed to set crawler limits: %w", err)
+	c.collector.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		if nofollow, _ := e.Request.Ctx.GetAny("nofollow").(bool); nofollow {
+			return
+		}
+		depth, _ := e.Request.Ctx.GetAny("depth").(int)
+		c.enqueueLink(frontier, info, e.Request.URL.String(), e.Request.AbsoluteURL(e.Attr("href")), depth)
+	})
+
+	runErr := c.dispatch(crawlCtx, frontier, info)
+
+	duration := time.Since(c.startTime)
+	status := "completed"
+	if runErr == nil && crawlCtx.Err() != nil {
+		status = "interrupted"
+	}
+	if runErr != nil {
+		status = "failed"
 	}
 
-	if err = c.collector.Visit(startURL); err != nil {
-		c.logger.Error("failed to start crawl",
-			zap.String("url", startURL),
-			zap.Error(err),
+	info.State = status
+	if err := frontier.SaveInfo(info); err != nil {
+		c.logger.Error("failed to save crawl state", zap.Error(err))
+	}
+
+	err := c.pushgateway.RecordCrawlMetrics(
+		ctx,
+		c.id,
+		info.StartURL,
+		status,
+		duration,
+		int(atomic.LoadInt64(&c.pagesVisited)),
+	)
+	if err != nil {
+		c.logger.Error("failed to push metrics", zap.Error(err))
+	}
+
+	switch {
+	case runErr != nil:
+		return fmt.Errorf("crawl failed: %w", runErr)
+	case ctx.Err() != nil:
+		c.logger.Warn("crawl cancelled",
+			zap.String("url", info.StartURL),
+			zap.String("crawl_id", c.id),
+			zap.String("resume_with", "goprowl crawl --resume "+c.id),
+			zap.Error(ctx.Err()),
+		)
+		return ctx.Err()
+	case crawlCtx.Err() != nil:
+		c.logger.Error("crawl timed out",
+			zap.String("url", info.StartURL),
+			zap.String("crawl_id", c.id),
+			zap.String("resume_with", "goprowl crawl --resume "+c.id),
+			zap.Duration("timeout", c.cfg.Timeout),
 		)
-		return fmt.Errorf("failed to start crawl of %s: %w", startURL, err)
+		return fmt.Errorf("crawl timed out after %s", c.cfg.Timeout)
 	}
 
-	// Add timeout for Wait()
-	done := make(chan bool)
-	go func() {
-		c.collector.Wait()
-		done <- true
+	c.logger.Info("crawl completed successfully",
+		zap.String("job", info.Job),
+		zap.String("url", info.StartURL),
+		zap.Int("depth", info.MaxDepth),
+		zap.Duration("duration", duration),
+		zap.Int64("pages_visited", atomic.LoadInt64(&c.pagesVisited)),
+		zap.Int64("pages_unchanged", atomic.LoadInt64(&c.pagesUnchanged)),
+		zap.Int64("pages_not_modified", atomic.LoadInt64(&c.pagesNotModified)),
+		zap.Int64("pages_removed", atomic.LoadInt64(&c.pagesRemoved)),
+		zap.Int64("pages_disallowed", atomic.LoadInt64(&c.pagesDisallowed)),
+		zap.Int64("pages_noindex", atomic.LoadInt64(&c.pagesNoIndex)),
+		zap.Int64("pages_duplicate", atomic.LoadInt64(&c.pagesDuplicate)),
+		zap.Bool("page_limit_reached", frontier.LimitReached()),
+	)
+
+	return nil
+}
+
+// fetchResult is the outcome of a fetch that matters to the scheduler
+type fetchResult struct {
+	entry      *FrontierEntry
+	host       string
+	status     int
+	retryAfter time.Duration
+	retry      bool // The host asked to be retried later
+}
+
+// dispatch drains the frontier through per-host queues, starting each fetch
+// once the scheduler grants its host a slot, until nothing is pending or ctx
+// is done. Entries buffered in the queues are in progress in the frontier,
+// so an interrupted crawl requeues them on resume
+func (c *CollyCrawler) dispatch(ctx context.Context, frontier *Frontier, info *CrawlInfo) error {
+	// Enough entries are buffered that hosts further down the frontier are
+	// seen while the first ones are paced
+	const maxBuffered = 1000
+
+	queues := newHostQueues()
+	results := make(chan fetchResult)
+	active := 0
+
+	defer func() {
+		// Let in-flight requests finish so their state is recorded
+		for ; active > 0; active-- {
+			result := <-results
+			c.scheduler.Release(result.host, result.status, result.retryAfter)
+		}
 	}()
 
-	select {
-	case <-done:
-		duration := time.Since(c.startTime)
-		err := c.pushgateway.RecordCrawlMetrics(
-			ctx,
-			c.id,
-			startURL,
-			"completed",
-			duration,
-			c.pagesVisited,
+	for ctx.Err() == nil {
+		drained := false
+		for queues.Len() < maxBuffered {
+			entry, err := frontier.Next()
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				drained = true
+				break
+			}
+			queues.push(hostOf(entry.URL), entry)
+		}
+
+		// Start whatever the scheduler allows, noting the soonest a
+		// paced host becomes available
+		var wait time.Duration
+		for _, host := range queues.hosts() {
+			ok, hostWait := c.scheduler.TryAcquire(host)
+			if !ok {
+				if hostWait > 0 && (wait == 0 || hostWait < wait) {
+					wait = hostWait
+				}
+				continue
+			}
+
+			entry := queues.pop(host)
+			active++
+			go func() {
+				result := c.fetch(ctx, frontier, info, entry)
+				result.entry, result.host = entry, host
+				results <- result
+			}()
+		}
+
+		if drained && queues.Len() == 0 && active == 0 {
+			return nil
+		}
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+
+		select {
+		case result := <-results:
+			active--
+			c.scheduler.Release(result.host, result.status, result.retryAfter)
+			c.retry(frontier, queues, result)
+		case <-c.scheduler.Changed():
+		case <-timer:
+		case <-ctx.Done():
+		}
+	}
+
+	return nil
+}
+
+// retry queues an entry again after its host asked for a pause, or records
+// it as failed once it has been tried maxFetchAttempts times
+func (c *CollyCrawler) retry(frontier *Frontier, queues *hostQueues, result fetchResult) {
+	if !result.retry {
+		return
+	}
+
+	if result.entry.Attempts >= maxFetchAttempts {
+		err := fmt.Errorf("gave up after %d attempts: %d %s",
+			result.entry.Attempts, result.status, http.StatusText(result.status))
+		c.recordState(result.entry.URL, frontier.MarkFailed(result.entry.URL, err))
+		return
+	}
+
+	result.entry.Attempts++
+	c.logger.Info("host asked to slow down, retrying later",
+		zap.String("url", result.entry.URL),
+		zap.Int("status", result.status),
+		zap.Duration("retry_after", result.retryAfter),
+	)
+	queues.pushFront(result.host, result.entry)
+}
+
+// hostOf returns the lowercased host and port of a URL, the unit the
+// scheduler paces requests by
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return strings.ToLower(u.Host)
+	}
+	return rawURL
+}
+
+// fetch requests a single frontier entry and records the outcome. URLs
+// disallowed by robots.txt are skipped, pages indexed before are requested
+// conditionally, and pages that are gone are removed from the index
+func (c *CollyCrawler) fetch(ctx context.Context, frontier *Frontier, info *CrawlInfo, entry *FrontierEntry) fetchResult {
+	if !c.cfg.IgnoreRobots && !c.checkRobots(ctx, frontier, entry) {
+		return fetchResult{}
+	}
+
+	reqCtx := colly.NewContext()
+	reqCtx.Put("url", entry.URL)
+	reqCtx.Put("variants", entry.Variants)
+	reqCtx.Put("depth", entry.Depth)
+	if entry.Sitemap != nil {
+		reqCtx.Put("sitemap", entry.Sitemap)
+	}
+
+	var headers http.Header
+	stored := c.lookupPage(ctx, entry.URL)
+	if stored != nil {
+		reqCtx.Put("stored", stored)
+		headers = http.Header{}
+		if stored.ETag != "" {
+			headers.Set("If-None-Match", stored.ETag)
+		}
+		if stored.LastModified != "" {
+			headers.Set("If-Modified-Since", stored.LastModified)
+		}
+	}
+
+	err := c.collector.Request("GET", entry.URL, nil, reqCtx, headers)
+	status, _ := reqCtx.GetAny("status").(int)
+	result := fetchResult{status: status}
+
+	switch {
+	case err == nil:
+		if reason, ok := reqCtx.GetAny("skip").(string); ok {
+			err = frontier.MarkSkipped(entry.URL, reason)
+		} else {
+			err = frontier.MarkDone(entry.URL)
+		}
+	case status == http.StatusNotModified && stored != nil:
+		// The page was not downloaded, so follow the links stored for it
+		atomic.AddInt64(&c.pagesNotModified, 1)
+		for _, link := range resolveLinks(entry.URL, stored.Links) {
+			c.enqueueLink(frontier, info, entry.URL, link, entry.Depth)
+		}
+		err = frontier.MarkDone(entry.URL)
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		// The entry stays in progress; dispatch pauses the host and retries it
+		result.retry = true
+		result.retryAfter = parseRetryAfter(reqCtx.Get("retry_after"))
+		return result
+	case status == http.StatusNotFound || status == http.StatusGone:
+		c.removePage(ctx, entry.URL, status)
+		err = frontier.MarkSkipped(entry.URL, fmt.Sprintf("removed: %d %s", status, http.StatusText(status)))
+	case isSkipError(err):
+		err = frontier.MarkSkipped(entry.URL, err.Error())
+	default:
+		err = frontier.MarkFailed(entry.URL, err)
+	}
+	c.recordState(entry.URL, err)
+	return result
+}
+
+// recordState logs a failure to update an entry's state in the frontier
+func (c *CollyCrawler) recordState(pageURL string, err error) {
+	if err != nil {
+		c.logger.Error("failed to record url state",
+			zap.String("url", pageURL),
+			zap.Error(err),
 		)
-		if err != nil {
-			c.logger.Error("failed to push metrics", zap.Error(err))
+	}
+}
+
+// checkRobots applies the host's robots.txt to an entry, reporting whether it
+// may be fetched, and passes the host's Crawl-delay on to the scheduler.
+// Disallowed entries are recorded as skipped with the rule that forbids them
+func (c *CollyCrawler) checkRobots(ctx context.Context, frontier *Frontier, entry *FrontierEntry) bool {
+	rules, err := c.robots.Rules(ctx, entry.URL)
+	if err != nil {
+		// A cancelled entry stays in progress and is requeued on resume
+		if ctx.Err() == nil {
+			c.recordState(entry.URL, frontier.MarkFailed(entry.URL, err))
 		}
+		return false
+	}
 
-		c.logger.Info("crawl completed successfully",
-			zap.String("url", startURL),
-			zap.Int("depth", depth),
-			zap.Duration("duration", duration),
-			zap.Int("pages_visited", c.pagesVisited),
+	if allowed, reason := rules.Allowed(entry.URL); !allowed {
+		atomic.AddInt64(&c.pagesDisallowed, 1)
+		c.logger.Info("skipping url disallowed by robots.txt",
+			zap.String("url", entry.URL),
+			zap.String("reason", reason),
 		)
-	case <-time.After(2 * time.Minute):
-		c.logger.Error("crawl timed out",
-			zap.String("url", startURL),
-			zap.Duration("timeout", 2*time.Minute),
+		c.recordState(entry.URL, frontier.MarkSkipped(entry.URL, reason))
+		return false
+	}
+
+	c.scheduler.SetCrawlDelay(hostOf(entry.URL), rules.CrawlDelay)
+	return true
+}
+
+// pageURL returns the URL a fetched page is indexed under, along with the
+// other URLs it was found as. That is the canonical form of the URL the
+// page was served from, or of its <link rel="canonical"> when that stays
+// within the crawl's scope
+func (c *CollyCrawler) pageURL(e *colly.HTMLElement) (string, []string) {
+	requested, _ := e.Request.Ctx.GetAny("url").(string)
+	variants, _ := e.Request.Ctx.GetAny("variants").([]string)
+	variants = append([]string(nil), variants...)
+
+	served := e.Request.URL.String()
+	pageURL, err := c.canonical.Canonicalize(served)
+	if err != nil {
+		pageURL = served
+	}
+
+	if href := strings.TrimSpace(e.ChildAttr(`link[rel~="canonical"]`, "href")); href != "" {
+		canonical, err := c.canonical.Canonicalize(e.Request.AbsoluteURL(href))
+		if err == nil && canonical != pageURL && c.scope.Allows(canonical) {
+			c.logger.Debug("page declares a canonical URL",
+				zap.String("url", pageURL),
+				zap.String("canonical", canonical))
+			variants = addVariant(variants, canonical, pageURL)
+			pageURL = canonical
+		}
+	}
+
+	for _, variant := range []string{requested, served} {
+		variants = addVariant(variants, pageURL, variant)
+	}
+	return pageURL, variants
+}
+
+// pageDirectives reads the robots directives of a fetched page, unless
+// robots handling is turned off
+func (c *CollyCrawler) pageDirectives(e *colly.HTMLElement) RobotsDirectives {
+	if c.cfg.IgnoreRobots {
+		return RobotsDirectives{}
+	}
+
+	metas := make(map[string][]string)
+	e.ForEach("meta[name]", func(_ int, meta *colly.HTMLElement) {
+		name := meta.Attr("name")
+		metas[name] = append(metas[name], meta.Attr("content"))
+	})
+	return c.robots.Directives(*e.Response.Headers, metas)
+}
+
+// lookupPage returns the stored state of a page, or nil when the page is new,
+// no page store is set or a full recrawl was requested
+func (c *CollyCrawler) lookupPage(ctx context.Context, pageURL string) *PageContent {
+	if c.pages == nil || c.cfg.Full {
+		return nil
+	}
+
+	stored, err := c.pages.LookupPage(ctx, pageURL)
+	if err != nil {
+		c.logger.Warn("failed to look up stored page",
+			zap.String("url", pageURL),
+			zap.Error(err),
 		)
-		return fmt.Errorf("crawl timed out after 2 minutes")
-	case <-ctx.Done():
-		c.logger.Warn("crawl cancelled",
-			zap.String("url", startURL),
-			zap.Error(ctx.Err()),
+		return nil
+	}
+	return stored
+}
+
+// removePage deletes a page that the server reports as gone
+func (c *CollyCrawler) removePage(ctx context.Context, pageURL string, status int) {
+	if c.pages == nil {
+		return
+	}
+
+	if err := c.pages.DeletePage(ctx, pageURL); err != nil {
+		c.logger.Error("failed to delete removed page",
+			zap.String("url", pageURL),
+			zap.Error(err),
 		)
-		return ctx.Err()
+		return
 	}
 
-	return nil
+	atomic.AddInt64(&c.pagesRemoved, 1)
+	c.logger.Info("deleted removed page",
+		zap.String("url", pageURL),
+		zap.Int("status", status),
+	)
+}
+
+// enqueueLink adds an absolute link found at the given depth to the frontier,
+// unless it is beyond the crawl's depth or outside its scope
+func (c *CollyCrawler) enqueueLink(frontier *Frontier, info *CrawlInfo, sourceURL, link string, depth int) {
+	if info.SitemapOnly {
+		return
+	}
+	if info.MaxDepth > 0 && depth >= info.MaxDepth {
+		return
+	}
+	if link == "" {
+		return
+	}
+	canonical, err := c.canonical.Canonicalize(link)
+	if err != nil || !c.scope.Allows(canonical) {
+		return
+	}
+
+	added, err := frontier.AddVariant(canonical, link, depth+1)
+	if err != nil {
+		c.logger.Error("failed to enqueue link",
+			zap.String("link", link),
+			zap.Error(err),
+		)
+		return
+	}
+	if added {
+		c.logger.Debug("found link",
+			zap.String("source_url", sourceURL),
+			zap.String("link", link),
+		)
+	}
+}
+
+// resolveLinks makes stored hrefs absolute against the page they came from
+func resolveLinks(pageURL string, hrefs []string) []string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	links := make([]string, 0, len(hrefs))
+	for _, href := range hrefs {
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			continue
+		}
+		link := base.ResolveReference(ref)
+		link.Fragment = ""
+		links = append(links, link.String())
+	}
+	return links
+}
+
+// mediaType strips parameters such as the charset from a Content-Type header
+func mediaType(contentType string) string {
+	if parsed, _, err := mime.ParseMediaType(contentType); err == nil {
+		return parsed
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// primaryLanguage reduces a language tag such as "en-US" to "en"
+func primaryLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if primary, _, ok := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-"); ok {
+		return primary
+	}
+	return tag
+}
+
+// contentHash returns the hex SHA-256 of a response body
+func contentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// isSkipError reports whether a collector error means the request was never
+// sent, as opposed to a failed fetch
+func isSkipError(err error) bool {
+	for _, skip := range []error{
+		colly.ErrForbiddenDomain,
+		colly.ErrForbiddenURL,
+		colly.ErrNoURLFiltersMatch,
+		colly.ErrMaxDepth,
+		colly.ErrAlreadyVisited,
+		colly.ErrRobotsTxtBlocked,
+		colly.ErrMissingURL,
+	} {
+		if errors.Is(err, skip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowedDomain reports whether rawURL belongs to one of the allowed hosts.
+// A "*.example.com" entry allows any subdomain of example.com
+func isAllowedDomain(rawURL string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	hostname := strings.ToLower(parsed.Hostname())
+	for _, host := range allowed {
+		if suffix, ok := strings.CutPrefix(host, "*"); ok {
+			if strings.HasSuffix(hostname, suffix) && len(hostname) > len(suffix) {
+				return true
+			}
+		} else if hostname == host {
+			return true
+		}
+	}
+	return false
 }
@@ -3,6 +3,8 @@ package crawlers
 import (
 	"fmt"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gocolly/colly/v2"
@@ -12,18 +14,59 @@ import (
 
 // ConfigOptions holds command-line parameters for the crawler
 type ConfigOptions struct {
-	URL      string
-	MaxDepth int
-	Debug    bool
+	URL         string
+	MaxDepth    int
+	Debug       bool
+	ResumeID    string // Crawl ID to resume instead of starting a new crawl
+	SitemapOnly bool   // Index the URLs listed in sitemaps without following links
+	Full        bool   // Re-fetch and re-index every page, ignoring stored validators
+	// IgnoreRobots disregards robots.txt and robots directives, for sites
+	// the operator controls
+	IgnoreRobots bool
+	Duplicates   DuplicateMode // Handling of near-duplicate pages, empty for DuplicatesCluster
+	// DuplicateDistance is the largest number of differing SimHash bits
+	// between near-duplicates, 0 for the default
+	DuplicateDistance int
+	// Timeout is the maximum duration of a single crawl run, after which
+	// the crawl stops and can be resumed. 0 means no limit
+	Timeout time.Duration
+}
+
+// DuplicateMode selects what happens to a page whose content nearly matches
+// an indexed page
+type DuplicateMode string
+
+const (
+	DuplicatesCluster DuplicateMode = "cluster" // Index it under the other page's cluster ID
+	DuplicatesSkip    DuplicateMode = "skip"    // Do not index it
+	DuplicatesOff     DuplicateMode = "off"     // Index it without looking for duplicates
+)
+
+// defaultDuplicateDistance suits whole-page SimHashes, where unrelated
+// pages rarely come closer than ten bits
+const defaultDuplicateDistance = 3
+
+// ParseDuplicateMode validates a duplicate mode given on the command line
+func ParseDuplicateMode(mode string) (DuplicateMode, error) {
+	switch m := DuplicateMode(strings.ToLower(strings.TrimSpace(mode))); m {
+	case DuplicatesCluster, DuplicatesSkip, DuplicatesOff:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown duplicate mode %q (use cluster, skip or off)", mode)
+	}
 }
 
 // Config holds crawler configuration
 type Config struct {
-	ConfigOptions  // Embed the options
-	AllowedDomains []string
-	UserAgent      string
-	Parallelism    int
-	RequestDelay   time.Duration
+	ConfigOptions   // Embed the options
+	AllowedDomains  []string
+	UserAgent       string
+	Parallelism     int           // Maximum requests in flight across all hosts
+	HostParallelism int           // Maximum requests in flight to one host
+	RequestDelay    time.Duration // Minimum time between requests to one host
+	FrontierDir     string        // Directory holding persisted crawl frontiers
+	MaxSitemapURLs  int           // Maximum number of URLs taken from sitemaps, 0 for no limit
+	TrackingParams  []string      // Query parameters stripped from canonical URLs, "*" suffix for prefixes
 }
 
 // ProvideDefaultConfigOptions creates default options
@@ -36,10 +79,23 @@ func ProvideDefaultConfigOptions() *ConfigOptions {
 
 // NewConfig creates a crawler configuration from options
 func NewConfig(opts *ConfigOptions) *Config {
+	if opts.Duplicates == "" {
+		opts.Duplicates = DuplicatesCluster
+	}
+	if opts.DuplicateDistance <= 0 {
+		opts.DuplicateDistance = defaultDuplicateDistance
+	}
+
 	return &Config{
-		ConfigOptions:  *opts,
-		AllowedDomains: []string{},
-		UserAgent:      "GoProwl Bot",
+		ConfigOptions:   *opts,
+		AllowedDomains:  []string{},
+		UserAgent:       "GoProwl Bot",
+		Parallelism:     8,
+		HostParallelism: 2,
+		RequestDelay:    200 * time.Millisecond,
+		FrontierDir:     filepath.Join("data", "crawls"),
+		MaxSitemapURLs:  50000,
+		TrackingParams:  DefaultTrackingParams,
 	}
 }
 
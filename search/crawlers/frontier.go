@@ -0,0 +1,391 @@
+package crawlers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	infoBucket  = []byte("info")
+	urlsBucket  = []byte("urls")
+	queueBucket = []byte("queue")
+	infoKey     = []byte("crawl")
+)
+
+// ErrCrawlNotFound is returned when resuming a crawl without a persisted frontier
+var ErrCrawlNotFound = errors.New("crawl not found")
+
+// Frontier is a disk-backed crawl queue. It keeps the pending URLs in FIFO
+// order, the set of every URL seen so far and the state of each URL, so an
+// interrupted crawl can pick up where it stopped
+type Frontier struct {
+	mu sync.RWMutex
+	db *bbolt.DB
+
+	limit   int  // Maximum number of URLs, 0 for no limit
+	size    int  // URLs seen, tracked while a limit is set
+	limited bool // A URL was dropped because of the limit
+}
+
+// frontierPath returns the location of the frontier file for a crawl
+func frontierPath(dir, crawlID string) string {
+	return filepath.Join(dir, crawlID+".db")
+}
+
+// OpenFrontier opens the frontier for crawlID in dir, creating it if needed
+func OpenFrontier(dir, crawlID string) (*Frontier, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create frontier directory: %w", err)
+	}
+
+	db, err := bbolt.Open(frontierPath(dir, crawlID), 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open frontier: %w", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{infoBucket, urlsBucket, queueBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize frontier: %w", err)
+	}
+
+	return &Frontier{db: db}, nil
+}
+
+// OpenExistingFrontier opens a previously created frontier, returning
+// ErrCrawlNotFound if no crawl with that ID was persisted
+func OpenExistingFrontier(dir, crawlID string) (*Frontier, error) {
+	if _, err := os.Stat(frontierPath(dir, crawlID)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrCrawlNotFound, crawlID)
+		}
+		return nil, fmt.Errorf("failed to stat frontier: %w", err)
+	}
+	return OpenFrontier(dir, crawlID)
+}
+
+// Info returns the persisted crawl description, or nil if none was saved
+func (f *Frontier) Info() (*CrawlInfo, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var info *CrawlInfo
+	err := f.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(infoBucket).Get(infoKey)
+		if data == nil {
+			return nil
+		}
+		info = &CrawlInfo{}
+		return json.Unmarshal(data, info)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crawl info: %w", err)
+	}
+	return info, nil
+}
+
+// SaveInfo persists the crawl description
+func (f *Frontier) SaveInfo(info *CrawlInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info.UpdatedAt = time.Now()
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal crawl info: %w", err)
+	}
+
+	return f.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(infoBucket).Put(infoKey, data)
+	})
+}
+
+// Add enqueues a URL at the given depth. It returns false without error if
+// the URL has already been seen by this crawl
+func (f *Frontier) Add(url string, depth int) (bool, error) {
+	return f.add(&FrontierEntry{URL: url, Depth: depth})
+}
+
+// AddVariant enqueues a canonical URL that was found spelled as variant. If
+// the URL has been seen already, the variant is recorded with it
+func (f *Frontier) AddVariant(url, variant string, depth int) (bool, error) {
+	return f.add(&FrontierEntry{URL: url, Depth: depth, Variants: addVariant(nil, url, variant)})
+}
+
+// AddFromSitemap enqueues a sitemap URL at the given depth, keeping its
+// sitemap attributes for the indexed document
+func (f *Frontier) AddFromSitemap(sitemapURL *SitemapURL, depth int) (bool, error) {
+	return f.add(&FrontierEntry{URL: sitemapURL.Loc, Depth: depth, Sitemap: sitemapURL})
+}
+
+func (f *Frontier) add(entry *FrontierEntry) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	added := false
+	err := f.db.Update(func(tx *bbolt.Tx) error {
+		urls := tx.Bucket(urlsBucket)
+		seen, err := getEntry(urls, []byte(entry.URL))
+		if err != nil {
+			return err
+		}
+		if seen != nil {
+			return mergeVariants(urls, seen, entry.Variants)
+		}
+		if f.limit > 0 && f.size >= f.limit {
+			f.limited = true
+			return nil
+		}
+
+		entry.State = URLPending
+		entry.UpdatedAt = time.Now()
+		if err := putEntry(urls, entry); err != nil {
+			return err
+		}
+		if err := enqueue(tx.Bucket(queueBucket), entry.URL); err != nil {
+			return err
+		}
+		added = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to add %s to frontier: %w", entry.URL, err)
+	}
+	if added {
+		f.size++
+	}
+	return added, nil
+}
+
+// SetLimit caps the number of URLs the frontier takes in, counting those
+// seen before, so a resumed crawl keeps its limit. Once it is reached, Add
+// drops new URLs as if they had been seen. A limit of 0 removes the cap
+func (f *Frontier) SetLimit(limit int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.limit = limit
+	return f.db.View(func(tx *bbolt.Tx) error {
+		f.size = tx.Bucket(urlsBucket).Stats().KeyN
+		return nil
+	})
+}
+
+// LimitReached reports whether a URL was dropped because of the limit
+func (f *Frontier) LimitReached() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.limited
+}
+
+// Next pops the oldest pending URL and marks it in progress. It returns nil
+// when nothing is pending
+func (f *Frontier) Next() (*FrontierEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var entry *FrontierEntry
+	err := f.db.Update(func(tx *bbolt.Tx) error {
+		queue := tx.Bucket(queueBucket)
+		urls := tx.Bucket(urlsBucket)
+
+		cursor := queue.Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.First() {
+			url := append([]byte(nil), value...)
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+
+			current, err := getEntry(urls, url)
+			if err != nil {
+				return err
+			}
+			if current == nil || current.State != URLPending {
+				continue
+			}
+
+			current.State = URLInProgress
+			current.Attempts++
+			current.UpdatedAt = time.Now()
+			if err := putEntry(urls, current); err != nil {
+				return err
+			}
+			entry = current
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop from frontier: %w", err)
+	}
+	return entry, nil
+}
+
+// MarkDone records that a URL was fetched successfully
+func (f *Frontier) MarkDone(url string) error {
+	return f.setState(url, URLDone, "")
+}
+
+// MarkFailed records that fetching a URL failed
+func (f *Frontier) MarkFailed(url string, cause error) error {
+	return f.setState(url, URLFailed, cause.Error())
+}
+
+// MarkSkipped records that a URL was not fetched and why
+func (f *Frontier) MarkSkipped(url string, reason string) error {
+	return f.setState(url, URLSkipped, reason)
+}
+
+func (f *Frontier) setState(url string, state URLState, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.db.Update(func(tx *bbolt.Tx) error {
+		urls := tx.Bucket(urlsBucket)
+		entry, err := getEntry(urls, []byte(url))
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return fmt.Errorf("url not in frontier: %s", url)
+		}
+
+		entry.State = state
+		entry.Reason = reason
+		entry.UpdatedAt = time.Now()
+		return putEntry(urls, entry)
+	})
+}
+
+// Requeue returns every in-progress URL to the pending queue. It is used when
+// resuming, since those requests were cut off by the interruption
+func (f *Frontier) Requeue() (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	requeued := 0
+	err := f.db.Update(func(tx *bbolt.Tx) error {
+		urls := tx.Bucket(urlsBucket)
+		queue := tx.Bucket(queueBucket)
+
+		var interrupted []*FrontierEntry
+		err := urls.ForEach(func(_, value []byte) error {
+			entry := &FrontierEntry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				return err
+			}
+			if entry.State == URLInProgress {
+				interrupted = append(interrupted, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range interrupted {
+			entry.State = URLPending
+			entry.UpdatedAt = time.Now()
+			if err := putEntry(urls, entry); err != nil {
+				return err
+			}
+			if err := enqueue(queue, entry.URL); err != nil {
+				return err
+			}
+		}
+		requeued = len(interrupted)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue interrupted urls: %w", err)
+	}
+	return requeued, nil
+}
+
+// Stats returns the number of URLs in each state
+func (f *Frontier) Stats() (map[URLState]int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	stats := make(map[URLState]int)
+	err := f.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(urlsBucket).ForEach(func(_, value []byte) error {
+			entry := &FrontierEntry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				return err
+			}
+			stats[entry.State]++
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frontier stats: %w", err)
+	}
+	return stats, nil
+}
+
+// Close releases the underlying database
+func (f *Frontier) Close() error {
+	return f.db.Close()
+}
+
+func getEntry(urls *bbolt.Bucket, url []byte) (*FrontierEntry, error) {
+	data := urls.Get(url)
+	if data == nil {
+		return nil, nil
+	}
+	entry := &FrontierEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode frontier entry: %w", err)
+	}
+	return entry, nil
+}
+
+// mergeVariants records new spellings of a seen URL
+func mergeVariants(urls *bbolt.Bucket, entry *FrontierEntry, variants []string) error {
+	merged := entry.Variants
+	for _, variant := range variants {
+		merged = addVariant(merged, entry.URL, variant)
+	}
+	if len(merged) == len(entry.Variants) {
+		return nil
+	}
+	entry.Variants = merged
+	return putEntry(urls, entry)
+}
+
+func putEntry(urls *bbolt.Bucket, entry *FrontierEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode frontier entry: %w", err)
+	}
+	return urls.Put([]byte(entry.URL), data)
+}
+
+// enqueue appends a URL to the queue bucket under a big-endian sequence key,
+// which keeps cursor iteration in insertion order
+func enqueue(queue *bbolt.Bucket, url string) error {
+	seq, err := queue.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return queue.Put(key, []byte(url))
+}
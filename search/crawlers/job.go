@@ -0,0 +1,193 @@
+package crawlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidJob is returned when a crawl job definition cannot be run
+var ErrInvalidJob = errors.New("invalid crawl job")
+
+// CrawlJob describes a crawl over one or more seeds sharing a single
+// frontier, so a page linked from several seeds is fetched once
+type CrawlJob struct {
+	// Name is stored on every document the job indexes
+	Name  string   `json:"name" yaml:"name"`
+	Seeds []string `json:"seeds" yaml:"seeds"`
+	// AllowedDomains lists the hosts links are followed to. "example.com"
+	// matches that host only and "*.example.com" matches its subdomains.
+	// When empty, the hosts of the seeds are allowed
+	AllowedDomains []string `json:"allowed_domains,omitempty" yaml:"allowed_domains,omitempty"`
+	// Include and Exclude are regular expressions matched against
+	// discovered URLs: a URL is followed when it matches any Include
+	// pattern, or there are none, and no Exclude pattern
+	Include     []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Exclude     []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	MaxDepth    int      `json:"max_depth,omitempty" yaml:"max_depth,omitempty"`
+	MaxPages    int      `json:"max_pages,omitempty" yaml:"max_pages,omitempty"` // URLs fetched at most, 0 for no limit
+	SitemapOnly bool     `json:"sitemap_only,omitempty" yaml:"sitemap_only,omitempty"`
+	// Timeout is the maximum duration of a single run of the job, such as
+	// "30m" or "2h". Empty means no limit
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// LoadJob reads a crawl job from a YAML or JSON file, chosen by extension
+func LoadJob(path string) (*CrawlJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crawl job: %w", err)
+	}
+
+	job := &CrawlJob{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, job)
+	case ".json":
+		err = json.Unmarshal(data, job)
+	default:
+		return nil, fmt.Errorf("%w: unsupported file type %q, use .yaml, .yml or .json", ErrInvalidJob, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s: %v", ErrInvalidJob, path, err)
+	}
+
+	if job.Name == "" {
+		job.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := job.Validate(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Validate checks the seeds, domain patterns and URL expressions of a job
+func (j *CrawlJob) Validate() error {
+	if len(j.Seeds) == 0 {
+		return fmt.Errorf("%w: no seeds", ErrInvalidJob)
+	}
+	for _, seed := range j.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: seed %q is not an http(s) URL", ErrInvalidJob, seed)
+		}
+	}
+	for _, domain := range j.AllowedDomains {
+		if strings.TrimPrefix(domain, "*.") == "" || strings.Contains(strings.TrimPrefix(domain, "*."), "*") {
+			return fmt.Errorf("%w: allowed domain %q must be a host or *.host", ErrInvalidJob, domain)
+		}
+	}
+	if j.MaxDepth < 0 || j.MaxPages < 0 {
+		return fmt.Errorf("%w: max_depth and max_pages cannot be negative", ErrInvalidJob)
+	}
+	if j.Timeout != "" {
+		if timeout, err := time.ParseDuration(j.Timeout); err != nil || timeout < 0 {
+			return fmt.Errorf("%w: timeout %q is not a duration such as 30m", ErrInvalidJob, j.Timeout)
+		}
+	}
+	if _, err := newCrawlScope(j.AllowedDomains, j.Include, j.Exclude); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TimeoutDuration returns the job's Timeout, 0 when it has none
+func (j *CrawlJob) TimeoutDuration() time.Duration {
+	timeout, _ := time.ParseDuration(j.Timeout)
+	return timeout
+}
+
+// info describes the job as a new crawl with the given ID
+func (j *CrawlJob) info(id string) *CrawlInfo {
+	domains := j.AllowedDomains
+	if len(domains) == 0 {
+		for _, seed := range j.Seeds {
+			if u, err := url.Parse(seed); err == nil {
+				domains = append(domains, strings.ToLower(u.Hostname()))
+			}
+		}
+	}
+
+	return &CrawlInfo{
+		ID:             id,
+		Job:            j.Name,
+		StartURL:       j.Seeds[0],
+		Seeds:          j.Seeds,
+		MaxDepth:       j.MaxDepth,
+		MaxPages:       j.MaxPages,
+		AllowedDomains: domains,
+		Include:        j.Include,
+		Exclude:        j.Exclude,
+		SitemapOnly:    j.SitemapOnly,
+	}
+}
+
+// crawlScope decides which discovered URLs a crawl follows
+type crawlScope struct {
+	domains []string
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newCrawlScope(domains, include, exclude []string) (*crawlScope, error) {
+	scope := &crawlScope{}
+	for _, domain := range domains {
+		scope.domains = append(scope.domains, strings.ToLower(domain))
+	}
+
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid URL pattern %q: %v", ErrInvalidJob, pattern, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+
+	var err error
+	if scope.include, err = compile(include); err != nil {
+		return nil, err
+	}
+	if scope.exclude, err = compile(exclude); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// scopeOf builds the scope of a persisted crawl
+func scopeOf(info *CrawlInfo) (*crawlScope, error) {
+	return newCrawlScope(info.AllowedDomains, info.Include, info.Exclude)
+}
+
+// Allows reports whether rawURL is on an allowed domain and passes the
+// include and exclude patterns
+func (s *crawlScope) Allows(rawURL string) bool {
+	if !isAllowedDomain(rawURL, s.domains) {
+		return false
+	}
+	for _, re := range s.exclude {
+		if re.MatchString(rawURL) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, re := range s.include {
+		if re.MatchString(rawURL) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,25 +3,59 @@ package crawlers
 import (
 	"github.com/gocolly/colly/v2"
 	"github.com/gocolly/colly/v2/debug"
+	"github.com/jonesrussell/goprowl/metrics"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 )
 
+// CrawlerFactory builds a crawler with its own collector, for callers that
+// run more than one crawl in the same process
+type CrawlerFactory func() (Crawler, error)
+
 var Module = fx.Module("crawlers",
 	fx.Provide(
-		func(cfg *Config) *colly.Collector {
-			opts := []colly.CollectorOption{}
-
-			// Only add debug logger if debug mode is enabled
-			if cfg.Debug {
-				opts = append(opts, colly.Debugger(&debug.LogDebugger{}))
-			}
-
-			return colly.NewCollector(opts...)
-		},
+		newCollector,
 		NewConfig,
+		NewScheduler,
+		NewCanonicalizer,
+		NewCrawlerFactory,
 		fx.Annotate(
 			NewCollyCrawler,
 			fx.As(new(Crawler)),
 		),
 	),
 )
+
+// newCollector builds a collector sending the configured user agent. Colly's
+// own robots.txt support stays off; the crawler applies RobotsPolicy itself
+// so it can honor Crawl-delay and record why URLs were skipped. Revisits are
+// allowed because the frontier already deduplicates URLs, and a page the
+// host asked to retry later has to be requested again
+func newCollector(cfg *Config) *colly.Collector {
+	opts := []colly.CollectorOption{
+		colly.UserAgent(cfg.UserAgent),
+		colly.AllowURLRevisit(),
+	}
+
+	// Only add debug logger if debug mode is enabled
+	if cfg.Debug {
+		opts = append(opts, colly.Debugger(&debug.LogDebugger{}))
+	}
+
+	return colly.NewCollector(opts...)
+}
+
+// NewCrawlerFactory returns a CrawlerFactory sharing the given dependencies,
+// including the scheduler, so concurrent crawls pace each host together
+func NewCrawlerFactory(
+	logger *zap.Logger,
+	metrics *metrics.ComponentMetrics,
+	pushgateway *metrics.PushGatewayClient,
+	scheduler *Scheduler,
+	canonicalizer *Canonicalizer,
+	cfg *Config,
+) CrawlerFactory {
+	return func() (Crawler, error) {
+		return NewCollyCrawler(logger, newCollector(cfg), metrics, pushgateway, scheduler, canonicalizer, cfg)
+	}
+}
@@ -0,0 +1,397 @@
+package crawlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRobotsSize is the amount of a robots.txt file that is parsed, the
+	// minimum RFC 9309 asks crawlers to support
+	maxRobotsSize = 500 * 1024
+	// robotsCacheTTL is how long a host's robots.txt is trusted
+	robotsCacheTTL = 24 * time.Hour
+	// robotsErrorTTL is how long an unreachable robots.txt blocks a host
+	// before it is requested again
+	robotsErrorTTL = 5 * time.Minute
+	// maxCrawlDelay caps the Crawl-delay a site can impose
+	maxCrawlDelay = time.Minute
+)
+
+// RobotsPolicy decides which URLs may be fetched according to each host's
+// robots.txt, read for the crawler's user agent. Files are fetched once per
+// host and cached
+type RobotsPolicy struct {
+	client    *http.Client
+	userAgent string
+	token     string // Product token matched against User-agent lines
+	logger    *zap.Logger
+
+	mu    sync.Mutex
+	hosts map[string]*robotsHost
+}
+
+type robotsHost struct {
+	ready   chan struct{} // Closed once rules is set
+	rules   *RobotsRules
+	expires time.Time
+}
+
+// RobotsRules are the rules of one host's robots.txt that apply to the
+// crawler's user agent
+type RobotsRules struct {
+	CrawlDelay time.Duration
+	Sitemaps   []string
+
+	rules []robotsRule
+	// blocked is set when robots.txt could not be read, in which case
+	// nothing may be fetched
+	blocked string
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// NewRobotsPolicy creates a policy for the crawler's user agent
+func NewRobotsPolicy(cfg *Config, logger *zap.Logger) *RobotsPolicy {
+	return &RobotsPolicy{
+		client:    &http.Client{Timeout: 30 * time.Second},
+		userAgent: cfg.UserAgent,
+		token:     robotsToken(cfg.UserAgent),
+		logger:    logger,
+		hosts:     make(map[string]*robotsHost),
+	}
+}
+
+// robotsToken returns the product token of a user agent, such as "goprowl"
+// for "GoProwl Bot" or "GoProwl/1.0"
+func robotsToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(userAgent), " ")
+	token, _, _ = strings.Cut(token, "/")
+	return strings.ToLower(token)
+}
+
+// Rules returns the robots.txt rules of the host serving rawURL
+func (p *RobotsPolicy) Rules(ctx context.Context, rawURL string) (*RobotsRules, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", rawURL, err)
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	p.mu.Lock()
+	host, ok := p.hosts[origin]
+	if ok && host.rules != nil && time.Now().After(host.expires) {
+		ok = false
+	}
+	if !ok {
+		host = &robotsHost{ready: make(chan struct{})}
+		p.hosts[origin] = host
+		p.mu.Unlock()
+
+		rules, ttl := p.fetch(ctx, origin)
+		p.mu.Lock()
+		host.rules, host.expires = rules, time.Now().Add(ttl)
+		close(host.ready)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-host.ready:
+		return host.rules, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Allowed reports whether rawURL may be fetched and, when it may not, why
+func (p *RobotsPolicy) Allowed(ctx context.Context, rawURL string) (bool, string, error) {
+	rules, err := p.Rules(ctx, rawURL)
+	if err != nil {
+		return false, "", err
+	}
+	allowed, reason := rules.Allowed(rawURL)
+	return allowed, reason, nil
+}
+
+// fetch reads the robots.txt of origin. Following RFC 9309, a missing file
+// allows everything and an unreachable one disallows everything
+func (p *RobotsPolicy) fetch(ctx context.Context, origin string) (*RobotsRules, time.Duration) {
+	robotsURL := origin + "/robots.txt"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return &RobotsRules{blocked: err.Error()}, robotsErrorTTL
+	}
+	if p.userAgent != "" {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.logger.Warn("robots.txt unreachable, disallowing host",
+			zap.String("url", robotsURL),
+			zap.Error(err))
+		return &RobotsRules{blocked: "unreachable"}, robotsErrorTTL
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		p.logger.Warn("robots.txt unavailable, disallowing host",
+			zap.String("url", robotsURL),
+			zap.Int("status", resp.StatusCode))
+		return &RobotsRules{blocked: resp.Status}, robotsErrorTTL
+	case resp.StatusCode >= 400:
+		p.logger.Debug("no robots.txt, allowing host",
+			zap.String("url", robotsURL),
+			zap.Int("status", resp.StatusCode))
+		return &RobotsRules{}, robotsCacheTTL
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		return &RobotsRules{blocked: err.Error()}, robotsErrorTTL
+	}
+
+	rules := parseRobots(body, p.token, p.userAgent)
+	p.logger.Debug("read robots.txt",
+		zap.String("url", robotsURL),
+		zap.Int("rules", len(rules.rules)),
+		zap.Duration("crawl_delay", rules.CrawlDelay))
+	return rules, robotsCacheTTL
+}
+
+// parseRobots extracts the rules applying to the given product token. Groups
+// naming the token are merged; without any, the groups for "*" apply
+func parseRobots(body []byte, token, userAgent string) *RobotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	var sitemaps []string
+	inRules := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share the rules that follow them
+			if current == nil || inRules {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			// An empty Disallow allows everything, which is the default
+			if value != "" {
+				current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = min(time.Duration(seconds*float64(time.Second)), maxCrawlDelay)
+			}
+		case "sitemap":
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+
+	userAgent = strings.ToLower(userAgent)
+	rules := &RobotsRules{Sitemaps: sitemaps}
+	matched := false
+	for _, wildcard := range []bool{false, true} {
+		for _, group := range groups {
+			if !group.matches(token, userAgent, wildcard) {
+				continue
+			}
+			matched = true
+			rules.rules = append(rules.rules, group.rules...)
+			rules.CrawlDelay = max(rules.CrawlDelay, group.crawlDelay)
+		}
+		if matched {
+			break
+		}
+	}
+	return rules
+}
+
+// matches reports whether the group names the crawler, or is the "*" group
+// when wildcard is set
+func (g *robotsGroup) matches(token, userAgent string, wildcard bool) bool {
+	for _, agent := range g.agents {
+		if wildcard {
+			if agent == "*" {
+				return true
+			}
+		} else if agent != "" && (agent == token || agent == userAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether rawURL may be fetched and, when it may not, the
+// rule that forbids it. The longest matching pattern wins, and Allow wins ties
+func (r *RobotsRules) Allowed(rawURL string) (bool, string) {
+	if r.blocked != "" {
+		return false, "robots.txt unavailable: " + r.blocked
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, "invalid URL"
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	var best *robotsRule
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if best == nil || len(rule.pattern) > len(best.pattern) ||
+			(len(rule.pattern) == len(best.pattern) && rule.allow) {
+			best = rule
+		}
+	}
+
+	if best == nil || best.allow {
+		return true, ""
+	}
+	return false, "robots.txt: Disallow: " + best.pattern
+}
+
+// matchRobotsPattern matches a path against a robots.txt pattern, where "*"
+// matches any run of characters and a trailing "$" anchors the end
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	if len(parts) == 1 {
+		return !anchored || path == parts[0]
+	}
+
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		index := strings.Index(rest, part)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+	return true
+}
+
+// RobotsDirectives are the indexing directives a page gives crawlers through
+// <meta name="robots"> or the X-Robots-Tag header
+type RobotsDirectives struct {
+	NoIndex  bool
+	NoFollow bool
+}
+
+// add applies a comma separated directive list such as "noindex, nofollow"
+func (d *RobotsDirectives) add(list string) {
+	for _, directive := range strings.Split(list, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			d.NoIndex = true
+		case "nofollow":
+			d.NoFollow = true
+		case "none":
+			d.NoIndex, d.NoFollow = true, true
+		}
+	}
+}
+
+// Directives combines the X-Robots-Tag headers and robots meta tags of a
+// page. Meta tags are given as name to content and may be addressed to
+// "robots" or the crawler's product token; headers may be prefixed with an
+// agent, as in "goprowl: noindex"
+func (p *RobotsPolicy) Directives(header http.Header, metas map[string][]string) RobotsDirectives {
+	var directives RobotsDirectives
+
+	for _, value := range header.Values("X-Robots-Tag") {
+		if agent, list, ok := strings.Cut(value, ":"); ok && isRobotsAgent(agent) {
+			if strings.ToLower(strings.TrimSpace(agent)) != p.token {
+				continue
+			}
+			value = list
+		}
+		directives.add(value)
+	}
+
+	for name, contents := range metas {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "robots" && name != p.token {
+			continue
+		}
+		for _, content := range contents {
+			directives.add(content)
+		}
+	}
+
+	return directives
+}
+
+// isRobotsAgent tells an agent prefix of an X-Robots-Tag value from
+// directives that take a value themselves, such as unavailable_after
+func isRobotsAgent(prefix string) bool {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" || strings.ContainsAny(prefix, " ,") {
+		return false
+	}
+	switch prefix {
+	case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package crawlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMatchRobotsPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/anything", true},
+		{"/private", "/private/page", true},
+		{"/private", "/privately", true},
+		{"/private", "/public", false},
+		{"/private/", "/private", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/dir/index.php?x=1", true},
+		{"/*.php", "/index.html", false},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/*.php$", "/index.phpx", false},
+		{"/page$", "/page", true},
+		{"/page$", "/page/", false},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+		{"/a*b$", "/ab", true},
+		{"/ab*b$", "/ab", false},
+		{"*", "/", true},
+		{"/*?sort=", "/list?sort=asc", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchRobotsPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchRobotsPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsRulesAllowed(t *testing.T) {
+	const robots = `
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Allow: /tie
+Disallow: /tie
+Disallow: /search?
+Allow: /search?q=
+`
+	rules := parseRobots([]byte(robots), "goprowl", "goprowl/1.0")
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/", true},
+		{"https://example.com/private", false},
+		{"https://example.com/private/page", false},
+		// The longest matching pattern wins
+		{"https://example.com/private/public/page", true},
+		{"https://example.com/doc.pdf", false},
+		{"https://example.com/doc.pdf?download=1", true},
+		// Allow wins ties between patterns of the same length
+		{"https://example.com/tie", true},
+		{"https://example.com/search?page=2", false},
+		{"https://example.com/search?q=crawler", true},
+		{"https://example.com/search", true},
+	}
+
+	for _, tt := range tests {
+		got, reason := rules.Allowed(tt.url)
+		if got != tt.want {
+			t.Errorf("Allowed(%s) = %v (%s), want %v", tt.url, got, reason, tt.want)
+		}
+		if !got && reason == "" {
+			t.Errorf("Allowed(%s) gave no reason", tt.url)
+		}
+	}
+}
+
+func TestParseRobotsGroups(t *testing.T) {
+	const robots = `
+Sitemap: https://example.com/sitemap.xml
+
+User-agent: *
+Disallow: /
+
+User-agent: otherbot
+User-agent: GoProwl
+Disallow: /private
+Crawl-delay: 2
+
+User-agent: goprowl # merged with the group above
+Disallow: /drafts
+Crawl-delay: 5
+
+User-agent: anotherbot
+Disallow: /public
+Crawl-delay: 10
+`
+
+	tests := []struct {
+		name      string
+		token     string
+		userAgent string
+		allowed   []string
+		disallow  []string
+		delay     time.Duration
+	}{
+		{
+			name:      "grouped user agents",
+			token:     "goprowl",
+			userAgent: "goprowl/1.0",
+			allowed:   []string{"/", "/public"},
+			disallow:  []string{"/private", "/drafts/one"},
+			delay:     5 * time.Second,
+		},
+		{
+			name:      "first of grouped user agents",
+			token:     "otherbot",
+			userAgent: "otherbot",
+			allowed:   []string{"/", "/drafts/one"},
+			disallow:  []string{"/private"},
+			delay:     2 * time.Second,
+		},
+		{
+			name:      "wildcard group",
+			token:     "unknownbot",
+			userAgent: "unknownbot/2.0",
+			disallow:  []string{"/", "/public"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots([]byte(robots), tt.token, tt.userAgent)
+			for _, path := range tt.allowed {
+				if ok, reason := rules.Allowed("https://example.com" + path); !ok {
+					t.Errorf("%s disallowed: %s", path, reason)
+				}
+			}
+			for _, path := range tt.disallow {
+				if ok, _ := rules.Allowed("https://example.com" + path); ok {
+					t.Errorf("%s allowed", path)
+				}
+			}
+			if rules.CrawlDelay != tt.delay {
+				t.Errorf("CrawlDelay = %v, want %v", rules.CrawlDelay, tt.delay)
+			}
+			if len(rules.Sitemaps) != 1 || rules.Sitemaps[0] != "https://example.com/sitemap.xml" {
+				t.Errorf("Sitemaps = %v", rules.Sitemaps)
+			}
+		})
+	}
+}
+
+func TestRobotsPolicyStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusNotFound, true},
+		{http.StatusForbidden, true},
+		{http.StatusInternalServerError, false},
+		{http.StatusServiceUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					w.Write([]byte("User-agent: *\nDisallow: /\n"))
+				}
+			}))
+			defer server.Close()
+
+			policy := NewRobotsPolicy(&Config{UserAgent: "GoProwl/1.0"}, zap.NewNop())
+			got, reason, err := policy.Allowed(context.Background(), server.URL+"/page")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Allowed = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package crawlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minBackoff is the first pause after a host answers 429 or 503
+	// without a Retry-After header
+	minBackoff = time.Second
+	// maxBackoff caps how long a host is paused, Retry-After included
+	maxBackoff = time.Hour
+	// maxFetchAttempts is how often an entry is tried before a 429 or 503
+	// is recorded as a failure
+	maxFetchAttempts = 4
+)
+
+// Scheduler decides when each host may be sent another request. Every host
+// gets its own concurrency limit and minimum delay between requests, which
+// grows while the host answers 429 or 503, and the number of requests in
+// flight across all hosts is capped. A Scheduler is shared by every crawl in
+// the process, so concurrent crawls of the same host stay polite together
+type Scheduler struct {
+	maxConnections  int
+	hostParallelism int
+	hostDelay       time.Duration
+
+	mu      sync.Mutex
+	active  int
+	hosts   map[string]*hostSchedule
+	changed chan struct{} // Closed and replaced whenever a slot frees up
+}
+
+type hostSchedule struct {
+	active     int
+	next       time.Time     // Earliest start of the next request
+	crawlDelay time.Duration // From robots.txt
+	backoff    time.Duration // Current pause after 429 or 503, 0 when healthy
+	probing    bool          // No request has completed yet
+}
+
+// NewScheduler creates a scheduler from the crawler configuration
+func NewScheduler(cfg *Config) *Scheduler {
+	return &Scheduler{
+		maxConnections:  max(cfg.Parallelism, 1),
+		hostParallelism: max(cfg.HostParallelism, 1),
+		hostDelay:       cfg.RequestDelay,
+		hosts:           make(map[string]*hostSchedule),
+		changed:         make(chan struct{}),
+	}
+}
+
+func (s *Scheduler) host(name string) *hostSchedule {
+	h, ok := s.hosts[name]
+	if !ok {
+		h = &hostSchedule{probing: true}
+		s.hosts[name] = h
+	}
+	return h
+}
+
+// TryAcquire reserves a request slot for host. When none is free it returns
+// how long until the host's delay has passed, or 0 if the caller has to wait
+// for a slot to be released
+func (s *Scheduler) TryAcquire(host string) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.host(host)
+	now := time.Now()
+
+	if wait := h.next.Sub(now); wait > 0 {
+		return false, wait
+	}
+	if h.active >= s.parallelism(h) || s.active >= s.maxConnections {
+		return false, 0
+	}
+
+	h.active++
+	s.active++
+	h.next = now.Add(max(s.hostDelay, h.crawlDelay))
+	return true, 0
+}
+
+// parallelism is the number of concurrent requests a host may receive. A
+// host is probed with a single request first, and hosts asking for a
+// Crawl-delay are crawled one request at a time
+func (s *Scheduler) parallelism(h *hostSchedule) int {
+	if h.probing || h.crawlDelay > 0 {
+		return 1
+	}
+	return s.hostParallelism
+}
+
+// Release returns a slot taken by TryAcquire, adapting the host's pace to
+// the response status: 429 and 503 pause the host, for Retry-After when
+// given and otherwise for twice the previous pause, while other responses
+// let an earlier pause wind down
+func (s *Scheduler) Release(host string, status int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.host(host)
+	h.active--
+	h.probing = false
+	s.active--
+
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		backoff := retryAfter
+		if backoff <= 0 {
+			backoff = max(2*h.backoff, minBackoff)
+		}
+		h.backoff = min(backoff, maxBackoff)
+		if resume := time.Now().Add(h.backoff); resume.After(h.next) {
+			h.next = resume
+		}
+	default:
+		if h.backoff /= 2; h.backoff < minBackoff {
+			h.backoff = 0
+		}
+	}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// SetCrawlDelay applies a host's robots.txt Crawl-delay
+func (s *Scheduler) SetCrawlDelay(host string, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.host(host)
+	if delay != h.crawlDelay {
+		h.next = h.next.Add(delay - h.crawlDelay)
+		h.crawlDelay = delay
+	}
+}
+
+// Changed returns a channel closed the next time a slot is released
+func (s *Scheduler) Changed() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.changed
+}
+
+// hostQueues buffers frontier entries by host so that a host with a long
+// queue does not hold up the others. Hosts are served round robin
+type hostQueues struct {
+	entries map[string][]*FrontierEntry
+	order   []string
+	size    int
+}
+
+func newHostQueues() *hostQueues {
+	return &hostQueues{entries: make(map[string][]*FrontierEntry)}
+}
+
+func (q *hostQueues) push(host string, entry *FrontierEntry) {
+	if _, ok := q.entries[host]; !ok {
+		q.order = append(q.order, host)
+	}
+	q.entries[host] = append(q.entries[host], entry)
+	q.size++
+}
+
+// pushFront queues an entry to be retried before the rest of its host's
+func (q *hostQueues) pushFront(host string, entry *FrontierEntry) {
+	if _, ok := q.entries[host]; !ok {
+		q.order = append(q.order, host)
+	}
+	q.entries[host] = append([]*FrontierEntry{entry}, q.entries[host]...)
+	q.size++
+}
+
+// pop takes the next entry of host and moves the host to the back of the
+// round robin order
+func (q *hostQueues) pop(host string) *FrontierEntry {
+	entries := q.entries[host]
+	entry := entries[0]
+	q.size--
+
+	for i, name := range q.order {
+		if name == host {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+	if len(entries) == 1 {
+		delete(q.entries, host)
+	} else {
+		q.entries[host] = entries[1:]
+		q.order = append(q.order, host)
+	}
+	return entry
+}
+
+// hosts returns the hosts with queued entries in round robin order
+func (q *hostQueues) hosts() []string {
+	return append([]string(nil), q.order...)
+}
+
+func (q *hostQueues) Len() int {
+	return q.size
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
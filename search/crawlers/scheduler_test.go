@@ -0,0 +1,91 @@
+package crawlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSchedulerBackoff(t *testing.T) {
+	const host = "example.com"
+	s := NewScheduler(&Config{Parallelism: 1, HostParallelism: 1})
+	s.host(host)
+
+	// request acquires a slot for host, whatever its pause, and releases it
+	// with status
+	request := func(status int, retryAfter time.Duration) time.Duration {
+		t.Helper()
+		s.hosts[host].next = time.Time{}
+		if ok, _ := s.TryAcquire(host); !ok {
+			t.Fatal("TryAcquire failed")
+		}
+		s.Release(host, status, retryAfter)
+		return s.hosts[host].backoff
+	}
+
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{"first 503", http.StatusServiceUnavailable, 0, minBackoff},
+		{"doubles", http.StatusTooManyRequests, 0, 2 * minBackoff},
+		{"doubles again", http.StatusServiceUnavailable, 0, 4 * minBackoff},
+		{"success halves", http.StatusOK, 0, 2 * minBackoff},
+		{"halves again", http.StatusOK, 0, minBackoff},
+		{"ends below the minimum", http.StatusOK, 0, 0},
+		{"Retry-After", http.StatusTooManyRequests, 30 * time.Second, 30 * time.Second},
+		{"doubles Retry-After", http.StatusTooManyRequests, 0, time.Minute},
+		{"Retry-After capped", http.StatusServiceUnavailable, 2 * maxBackoff, maxBackoff},
+		{"doubling capped", http.StatusServiceUnavailable, 0, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := request(tt.status, tt.retryAfter); got != tt.want {
+			t.Errorf("%s: backoff %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerBackoffPausesHost(t *testing.T) {
+	const host = "example.com"
+	s := NewScheduler(&Config{Parallelism: 1, HostParallelism: 1})
+
+	if ok, _ := s.TryAcquire(host); !ok {
+		t.Fatal("TryAcquire failed")
+	}
+	s.Release(host, http.StatusTooManyRequests, 10*time.Second)
+
+	ok, wait := s.TryAcquire(host)
+	if ok {
+		t.Fatal("TryAcquire succeeded during the pause")
+	}
+	if wait <= 9*time.Second || wait > 10*time.Second {
+		t.Errorf("wait %v, want about 10s", wait)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{" 5 ", 5 * time.Second, 5 * time.Second},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{now.Add(90 * time.Second).UTC().Format(http.TimeFormat), 88 * time.Second, 90 * time.Second},
+		{now.Add(2 * time.Hour).UTC().Format(time.RFC850), 2*time.Hour - 2*time.Second, 2 * time.Hour},
+		{now.Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package crawlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxSitemapSize is the protocol's limit on an uncompressed sitemap
+	maxSitemapSize = 50 * 1024 * 1024
+	// maxSitemapNesting bounds how deep sitemap indexes may refer to other
+	// indexes. The protocol forbids nesting, but some sites do it anyway
+	maxSitemapNesting = 3
+)
+
+// sitemapDateLayouts are the W3C datetime variants allowed in <lastmod>
+var sitemapDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// sitemapDocument decodes both <urlset> and <sitemapindex> roots
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+// SitemapDiscoverer finds the sitemaps of a site and expands them into the
+// page URLs they list
+type SitemapDiscoverer struct {
+	client    *http.Client
+	robots    *RobotsPolicy
+	userAgent string
+	maxURLs   int
+	logger    *zap.Logger
+}
+
+// NewSitemapDiscoverer creates a discoverer using the crawler's user agent.
+// Sitemaps are listed from the robots.txt files cached by robots
+func NewSitemapDiscoverer(cfg *Config, robots *RobotsPolicy, logger *zap.Logger) *SitemapDiscoverer {
+	return &SitemapDiscoverer{
+		client:    &http.Client{Timeout: 30 * time.Second},
+		robots:    robots,
+		userAgent: cfg.UserAgent,
+		maxURLs:   cfg.MaxSitemapURLs,
+		logger:    logger,
+	}
+}
+
+// Discover returns the URLs listed in the sitemaps of the site serving
+// startURL. Sitemaps are taken from the Sitemap: lines of /robots.txt, with
+// /sitemap.xml as a fallback. Sitemaps that cannot be fetched are logged and
+// skipped, since most sites have none
+func (d *SitemapDiscoverer) Discover(ctx context.Context, startURL string) ([]*SitemapURL, error) {
+	base, err := url.Parse(startURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", startURL, err)
+	}
+	root := &url.URL{Scheme: base.Scheme, Host: base.Host}
+
+	rules, err := d.robots.Rules(ctx, root.String())
+	if err != nil {
+		return nil, err
+	}
+
+	sitemaps := rules.Sitemaps
+	if len(sitemaps) == 0 {
+		sitemaps = []string{root.JoinPath("sitemap.xml").String()}
+	}
+
+	var urls []*SitemapURL
+	seen := make(map[string]bool)
+	for _, sitemap := range sitemaps {
+		if err := d.expand(ctx, sitemap, 0, seen, &urls); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			d.logger.Warn("failed to read sitemap",
+				zap.String("sitemap", sitemap),
+				zap.Error(err))
+		}
+		if d.maxURLs > 0 && len(urls) >= d.maxURLs {
+			d.logger.Warn("sitemap url limit reached", zap.Int("limit", d.maxURLs))
+			break
+		}
+	}
+
+	return urls, nil
+}
+
+// expand reads a sitemap or sitemap index, appending listed pages to urls
+// and recursing into nested sitemaps
+func (d *SitemapDiscoverer) expand(ctx context.Context, sitemapURL string, nesting int, seen map[string]bool, urls *[]*SitemapURL) error {
+	if seen[sitemapURL] {
+		return nil
+	}
+	seen[sitemapURL] = true
+
+	body, err := d.get(ctx, sitemapURL)
+	if err != nil {
+		return err
+	}
+
+	doc, err := parseSitemap(body)
+	if err != nil {
+		return fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+
+	for _, entry := range doc.URLs {
+		if d.maxURLs > 0 && len(*urls) >= d.maxURLs {
+			return nil
+		}
+		if loc := strings.TrimSpace(entry.Loc); loc != "" {
+			*urls = append(*urls, newSitemapURL(loc, entry))
+		}
+	}
+
+	if len(doc.Sitemaps) > 0 && nesting >= maxSitemapNesting {
+		d.logger.Warn("sitemap index nested too deeply", zap.String("sitemap", sitemapURL))
+		return nil
+	}
+	for _, entry := range doc.Sitemaps {
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" {
+			continue
+		}
+		if err := d.expand(ctx, loc, nesting+1, seen, urls); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			d.logger.Warn("failed to read sitemap",
+				zap.String("sitemap", loc),
+				zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// get fetches a URL, transparently decompressing gzipped bodies
+func (d *SitemapDiscoverer) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSitemapSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rawURL, err)
+	}
+
+	// Sitemaps served as .gz files arrive compressed regardless of headers
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", rawURL, err)
+		}
+		defer reader.Close()
+
+		body, err = io.ReadAll(io.LimitReader(reader, maxSitemapSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", rawURL, err)
+		}
+	}
+
+	return body, nil
+}
+
+// parseSitemap decodes a <urlset> or <sitemapindex> document
+func parseSitemap(body []byte) (*sitemapDocument, error) {
+	doc := &sitemapDocument{}
+	if err := xml.Unmarshal(body, doc); err != nil {
+		return nil, err
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unexpected root element <%s>", doc.XMLName.Local)
+}
+
+func newSitemapURL(loc string, entry sitemapEntry) *SitemapURL {
+	u := &SitemapURL{
+		Loc:        loc,
+		ChangeFreq: strings.TrimSpace(entry.ChangeFreq),
+	}
+
+	if lastMod := strings.TrimSpace(entry.LastMod); lastMod != "" {
+		for _, layout := range sitemapDateLayouts {
+			if parsed, err := time.Parse(layout, lastMod); err == nil {
+				u.LastMod = &parsed
+				break
+			}
+		}
+	}
+
+	if priority, err := strconv.ParseFloat(strings.TrimSpace(entry.Priority), 64); err == nil && priority >= 0 && priority <= 1 {
+		u.Priority = &priority
+	}
+
+	return u
+}
+
+// Metadata returns the sitemap attributes recorded on indexed documents
+func (u *SitemapURL) Metadata() map[string]interface{} {
+	metadata := map[string]interface{}{}
+	if u.LastMod != nil {
+		metadata["sitemap_lastmod"] = *u.LastMod
+	}
+	if u.Priority != nil {
+		metadata["sitemap_priority"] = *u.Priority
+	}
+	if u.ChangeFreq != "" {
+		metadata["sitemap_changefreq"] = u.ChangeFreq
+	}
+	return metadata
+}
@@ -2,7 +2,11 @@ package crawlers
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/jonesrussell/goprowl/search/dedup"
+	"github.com/jonesrussell/goprowl/search/extract"
 )
 
 // Crawler defines the interface for web crawling operations
@@ -11,15 +15,40 @@ type Crawler interface {
 	Crawl(ctx context.Context, startURL string, depth int) error
 	GetID() string
 	CrawlWithHandler(ctx context.Context, startURL string, depth int, handler PageHandler) error
+	// CrawlJobWithHandler crawls every seed of a job in a single crawl
+	CrawlJobWithHandler(ctx context.Context, job *CrawlJob, handler PageHandler) error
+	// ResumeWithHandler continues an interrupted crawl from its persisted frontier
+	ResumeWithHandler(ctx context.Context, crawlID string, handler PageHandler) error
+	// SetPageStore enables incremental recrawls against previously indexed pages
+	SetPageStore(store PageStore)
 }
 
 // CrawlResult represents the result of a crawl operation
 type CrawlResult struct {
 	URL       string
 	Title     string
-	Content   string
+	Content   string   // Main content of the page, without navigation and other boilerplate
+	Headings  []string // Headings within the main content, in document order
 	Links     []string
 	CreatedAt string
+	Metadata  map[string]interface{} // Attributes discovered before fetching, such as sitemap data
+	Job       string                 // Name of the crawl job that found the page, if any
+	Variants  []string               // Other URLs the page was found as, such as before canonicalization
+	// Fingerprint is the SimHash of Content, used to find near-duplicates
+	Fingerprint dedup.Fingerprint
+	// Structured is the page's meta tags, OpenGraph and Twitter card tags,
+	// and schema.org data
+	Structured *extract.Metadata
+
+	// Response attributes used for faceting
+	ContentType   string // Media type without parameters
+	ContentLength int    // Body size in bytes
+	Language      string // Primary language subtag declared by the page
+
+	// Change detection state for incremental recrawls
+	ContentHash  string
+	ETag         string
+	LastModified string
 }
 
 type CrawlConfig struct {
@@ -37,13 +66,78 @@ type CrawlStatus struct {
 	State           string // "running", "paused", "completed", "failed"
 }
 
-// Add to search/crawlers/types.go
+// URLState tracks the progress of a single URL in the crawl frontier
+type URLState string
+
+const (
+	URLPending    URLState = "pending"
+	URLInProgress URLState = "in_progress"
+	URLDone       URLState = "done"
+	URLFailed     URLState = "failed"
+	URLSkipped    URLState = "skipped"
+)
+
+// FrontierEntry is a URL known to the crawl frontier
+type FrontierEntry struct {
+	URL       string      `json:"url"`
+	Depth     int         `json:"depth"`
+	State     URLState    `json:"state"`
+	Attempts  int         `json:"attempts"`
+	Reason    string      `json:"reason,omitempty"`   // Error or skip reason
+	Sitemap   *SitemapURL `json:"sitemap,omitempty"`  // Set when the URL came from a sitemap
+	Variants  []string    `json:"variants,omitempty"` // Other spellings the URL was found as
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// SitemapURL is a page listed in a sitemap along with its optional attributes
+type SitemapURL struct {
+	Loc        string     `json:"loc"`
+	LastMod    *time.Time `json:"lastmod,omitempty"`
+	ChangeFreq string     `json:"changefreq,omitempty"`
+	Priority   *float64   `json:"priority,omitempty"`
+}
+
+// CrawlInfo describes a crawl persisted in a frontier
+type CrawlInfo struct {
+	ID             string    `json:"id"`
+	Job            string    `json:"job,omitempty"` // Name of the crawl job
+	StartURL       string    `json:"start_url"`
+	Seeds          []string  `json:"seeds,omitempty"`
+	MaxDepth       int       `json:"max_depth"`
+	MaxPages       int       `json:"max_pages,omitempty"`
+	AllowedDomains []string  `json:"allowed_domains"`        // Hosts, or *.host for subdomains
+	Include        []string  `json:"include,omitempty"`      // URL patterns links must match
+	Exclude        []string  `json:"exclude,omitempty"`      // URL patterns links must not match
+	SitemapOnly    bool      `json:"sitemap_only,omitempty"` // Index sitemap URLs without following links
+	State          string    `json:"state"`                  // "running", "interrupted", "completed"
+	StartedAt      time.Time `json:"started_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// PageContent is the state recorded for a previously indexed page
 type PageContent struct {
-	URL         string
-	Content     string
-	ContentHash string
-	LastUpdated time.Time
+	URL          string
+	Content      string
+	ContentHash  string
+	LastUpdated  time.Time
+	ETag         string
+	LastModified string
+	Links        []string
 }
 
-// PageHandler defines the callback for processing crawled pages
+// PageStore exposes previously indexed pages to the crawler, so recrawls can
+// send conditional requests and skip pages that have not changed
+type PageStore interface {
+	// LookupPage returns the stored state of a page, or nil if it was never indexed
+	LookupPage(ctx context.Context, url string) (*PageContent, error)
+	// DeletePage removes a page that no longer exists
+	DeletePage(ctx context.Context, url string) error
+}
+
+// PageHandler defines the callback for processing crawled pages. Returning
+// an error wrapping ErrNearDuplicate records the page as skipped
 type PageHandler func(context.Context, *CrawlResult) error
+
+// ErrNearDuplicate is returned by page handlers that did not index a page
+// because its content nearly matches a page indexed before
+var ErrNearDuplicate = errors.New("near duplicate")
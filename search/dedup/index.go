@@ -0,0 +1,161 @@
+package dedup
+
+import (
+	"sync"
+)
+
+// Match is an indexed document close to a fingerprint
+type Match struct {
+	ID       string
+	Cluster  string
+	Distance int
+}
+
+// Index finds documents whose fingerprint lies within a Hamming distance of
+// a given one. Fingerprints are split into one band more than the distance,
+// so any match agrees exactly on at least one band and only documents
+// sharing a band are compared
+type Index struct {
+	maxDistance int
+	bands       []band
+
+	mu      sync.RWMutex
+	docs    map[string]entry
+	buckets []map[uint64][]string // Per band, band value -> document IDs
+}
+
+type band struct {
+	shift uint
+	mask  uint64
+}
+
+type entry struct {
+	fingerprint Fingerprint
+	cluster     string
+}
+
+// NewIndex creates an index answering lookups up to maxDistance bits apart
+func NewIndex(maxDistance int) *Index {
+	maxDistance = min(max(maxDistance, 0), 63)
+	count := maxDistance + 1
+
+	idx := &Index{
+		maxDistance: maxDistance,
+		docs:        make(map[string]entry),
+		buckets:     make([]map[uint64][]string, count),
+	}
+
+	shift := uint(0)
+	for i := 0; i < count; i++ {
+		// Spread the 64 bits as evenly as possible over the bands
+		width := uint(64 / count)
+		if i < 64%count {
+			width++
+		}
+		idx.bands = append(idx.bands, band{shift: shift, mask: 1<<width - 1})
+		idx.buckets[i] = make(map[uint64][]string)
+		shift += width
+	}
+	return idx
+}
+
+func (b band) value(fp Fingerprint) uint64 {
+	return uint64(fp) >> b.shift & b.mask
+}
+
+// Add records a document's fingerprint and cluster, replacing any earlier
+// version of the document
+func (idx *Index) Add(id string, fp Fingerprint, cluster string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+	idx.docs[id] = entry{fingerprint: fp, cluster: cluster}
+	for i, b := range idx.bands {
+		v := b.value(fp)
+		idx.buckets[i][v] = append(idx.buckets[i][v], id)
+	}
+}
+
+// Remove forgets a document
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	e, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	delete(idx.docs, id)
+
+	for i, b := range idx.bands {
+		v := b.value(e.fingerprint)
+		ids := idx.buckets[i][v]
+		for j, other := range ids {
+			if other == id {
+				ids = append(ids[:j], ids[j+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(idx.buckets[i], v)
+		} else {
+			idx.buckets[i][v] = ids
+		}
+	}
+}
+
+// Has reports whether a document is indexed
+func (idx *Index) Has(id string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	_, ok := idx.docs[id]
+	return ok
+}
+
+// Len returns the number of indexed documents
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Nearest returns the indexed document closest to fp, other than exclude,
+// if one lies within maxDistance bits. maxDistance is capped at the distance
+// the index was created for. Ties go to the smallest ID, so lookups are
+// repeatable
+func (idx *Index) Nearest(fp Fingerprint, maxDistance int, exclude string) (Match, bool) {
+	maxDistance = min(maxDistance, idx.maxDistance)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var best Match
+	found := false
+	seen := make(map[string]bool)
+	for i, b := range idx.bands {
+		for _, id := range idx.buckets[i][b.value(fp)] {
+			if id == exclude || seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			e := idx.docs[id]
+			d := Distance(fp, e.fingerprint)
+			if d > maxDistance {
+				continue
+			}
+			if !found || d < best.Distance || (d == best.Distance && id < best.ID) {
+				best = Match{ID: id, Cluster: e.cluster, Distance: d}
+				found = true
+			}
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,73 @@
+// Package dedup detects near-duplicate documents, such as mirrors,
+// printer-friendly copies and paginated listings, by their SimHash
+package dedup
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is the number of consecutive words hashed together. Shingles
+// make the fingerprint sensitive to word order, not just vocabulary
+const shingleSize = 3
+
+// Fingerprint is the 64-bit SimHash of a text. Texts differing in a few
+// words have fingerprints differing in a few bits
+type Fingerprint uint64
+
+// NewFingerprint computes the SimHash of text from its word shingles,
+// weighted by how often each occurs. It is 0 for text without words
+func NewFingerprint(text string) Fingerprint {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	size := min(shingleSize, len(words))
+	var weights [64]int
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fp Fingerprint
+	for bit, weight := range weights {
+		if weight > 0 {
+			fp |= 1 << bit
+		}
+	}
+	return fp
+}
+
+// Distance returns the number of bits in which two fingerprints differ
+func Distance(a, b Fingerprint) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// String formats the fingerprint as 16 hex digits, the form it is stored in
+func (f Fingerprint) String() string {
+	return fmt.Sprintf("%016x", uint64(f))
+}
+
+// ParseFingerprint reads a fingerprint formatted by String
+func ParseFingerprint(s string) (Fingerprint, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fingerprint %q: %w", s, err)
+	}
+	return Fingerprint(v), nil
+}
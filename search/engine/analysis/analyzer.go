@@ -0,0 +1,130 @@
+// Package analysis turns text into the terms the in-house inverted index
+// stores and searches for. An Analyzer runs text through char filters, splits
+// it into tokens and passes the tokens through token filters; indexing and
+// querying with the same Analyzer makes document and query terms agree
+package analysis
+
+// Token is a term of analyzed text
+type Token struct {
+	Term string
+	// Position is the index of the token in the token stream. Removed tokens
+	// leave gaps and synonyms share the position of the token they stand for
+	Position int
+	// Start and End are the byte offsets of the token in the text after char
+	// filtering
+	Start int
+	End   int
+}
+
+// CharFilter rewrites text before it is tokenized
+type CharFilter interface {
+	Filter(text string) string
+}
+
+// Tokenizer splits text into tokens
+type Tokenizer interface {
+	Tokenize(text string) []Token
+}
+
+// TokenFilter transforms, removes or adds tokens. Filters may modify the
+// tokens they are given in place
+type TokenFilter interface {
+	Filter(tokens []Token) []Token
+}
+
+// Analyzer is a text analysis pipeline
+type Analyzer struct {
+	CharFilters []CharFilter
+	// Tokenizer defaults to UnicodeTokenizer
+	Tokenizer    Tokenizer
+	TokenFilters []TokenFilter
+}
+
+// Analyze runs text through the pipeline
+func (a *Analyzer) Analyze(text string) []Token {
+	for _, filter := range a.CharFilters {
+		text = filter.Filter(text)
+	}
+
+	tokenizer := a.Tokenizer
+	if tokenizer == nil {
+		tokenizer = UnicodeTokenizer{}
+	}
+	tokens := tokenizer.Tokenize(text)
+
+	for _, filter := range a.TokenFilters {
+		tokens = filter.Filter(tokens)
+	}
+	return tokens
+}
+
+// Terms returns the terms of the tokens of text, in order
+func (a *Analyzer) Terms(text string) []string {
+	tokens := a.Analyze(text)
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = token.Term
+	}
+	return terms
+}
+
+// maxTermLength is the longest term, in runes, the built-in analyzers keep;
+// longer tokens are encoded data or garbage rather than words
+const maxTermLength = 64
+
+// Standard returns an analyzer that splits text into Unicode words and
+// lowercases and ASCII folds them, without removing or stemming any
+func Standard() *Analyzer {
+	return &Analyzer{
+		Tokenizer: UnicodeTokenizer{},
+		TokenFilters: []TokenFilter{
+			LowercaseFilter{},
+			ASCIIFoldingFilter{},
+			NewLengthFilter(1, maxTermLength),
+		},
+	}
+}
+
+// ForLanguage returns an analyzer for text in the language with the given
+// ISO 639-1 code: words are lowercased, elided articles and the language's
+// stop words removed, the rest stemmed with its Snowball stemmer and finally
+// ASCII folded. Languages without a stemmer get the Standard analyzer
+func ForLanguage(lang string) *Analyzer {
+	stemmer, err := NewSnowballFilter(lang)
+	if err != nil {
+		return Standard()
+	}
+	filters := []TokenFilter{LowercaseFilter{}}
+	if articles, ok := elisions[lang]; ok {
+		filters = append(filters, NewElisionFilter(articles...))
+	}
+	filters = append(filters,
+		NewStopFilter(stopWords(lang)...),
+		stemmer,
+		ASCIIFoldingFilter{},
+		NewLengthFilter(1, maxTermLength),
+	)
+	return &Analyzer{Tokenizer: UnicodeTokenizer{}, TokenFilters: filters}
+}
+
+// elisions are the articles and pronouns elided before vowels in the
+// languages that write them joined to the next word
+var elisions = map[string][]string{
+	"fr": {"l", "m", "t", "qu", "n", "s", "j", "d", "c", "jusqu", "quoiqu", "lorsqu", "puisqu"},
+	"it": {"c", "l", "all", "dall", "dell", "nell", "sull", "coll", "pell", "gl", "agl", "dagl", "degl", "negl", "sugl", "un", "m", "t", "s", "v", "d"},
+}
+
+// English returns the analyzer for English text, which stems with the
+// original Porter algorithm
+func English() *Analyzer {
+	return &Analyzer{
+		Tokenizer: UnicodeTokenizer{},
+		TokenFilters: []TokenFilter{
+			LowercaseFilter{},
+			ASCIIFoldingFilter{},
+			NewStopFilter(EnglishStopWords...),
+			PorterFilter{},
+			NewLengthFilter(1, maxTermLength),
+		},
+	}
+}
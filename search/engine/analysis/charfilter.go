@@ -0,0 +1,49 @@
+package analysis
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// markup matches HTML comments, tags and character references
+var markup = regexp.MustCompile(`(?s)<!--.*?-->|</?[a-zA-Z!][^>]*>|&(?:#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z][a-zA-Z0-9]*);`)
+
+// HTMLStripFilter removes HTML markup from text. Tags and comments become
+// white space and character references the character they stand for,
+// padded with spaces, so the text keeps its length and token offsets stay
+// valid for the original text
+type HTMLStripFilter struct{}
+
+func (HTMLStripFilter) Filter(text string) string {
+	return markup.ReplaceAllStringFunc(text, func(m string) string {
+		if m[0] == '&' {
+			if decoded := html.UnescapeString(m); len(decoded) <= len(m) {
+				return decoded + strings.Repeat(" ", len(m)-len(decoded))
+			}
+			return m
+		}
+		return strings.Repeat(" ", len(m))
+	})
+}
+
+// MappingFilter replaces strings in text, such as "&" with " and ". The
+// replacements may change the length of the text, after which token offsets
+// refer to the replaced text
+type MappingFilter struct {
+	replacer *strings.Replacer
+}
+
+// NewMappingFilter creates a filter replacing each key of mapping with its
+// value. Where keys overlap, the one listed first in sorted order wins
+func NewMappingFilter(mapping map[string]string) *MappingFilter {
+	pairs := make([]string, 0, 2*len(mapping))
+	for _, from := range sortedKeys(mapping) {
+		pairs = append(pairs, from, mapping[from])
+	}
+	return &MappingFilter{replacer: strings.NewReplacer(pairs...)}
+}
+
+func (f *MappingFilter) Filter(text string) string {
+	return f.replacer.Replace(text)
+}
@@ -0,0 +1,204 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// EnglishStopWords are the English words too common to be worth indexing
+var EnglishStopWords = strings.Fields("a an and are as at be but by for if in into is it no not of on or such that the their then there these they this to was will with")
+
+// LowercaseFilter lowercases terms
+type LowercaseFilter struct{}
+
+func (LowercaseFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = strings.ToLower(tokens[i].Term)
+	}
+	return tokens
+}
+
+// foldings are the letters that have no decomposition to an ASCII letter
+// and a combining mark
+var foldings = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "TH",
+	'ı': "i", 'ŀ': "l", 'Ŀ': "L",
+}
+
+// ASCIIFoldingFilter removes diacritics from Latin letters, so "café" and
+// "cafe" are the same term. Letters of other scripts are kept as they are
+type ASCIIFoldingFilter struct{}
+
+func (ASCIIFoldingFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = fold(tokens[i].Term)
+	}
+	return tokens
+}
+
+func fold(term string) string {
+	ascii := true
+	for i := 0; i < len(term); i++ {
+		if term[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return term
+	}
+
+	var b strings.Builder
+	for _, r := range term {
+		if folded, ok := foldings[r]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		if r < utf8.RuneSelf || !unicode.Is(unicode.Latin, r) {
+			b.WriteRune(r)
+			continue
+		}
+		stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), string(r))
+		if err != nil {
+			stripped = string(r)
+		}
+		b.WriteString(stripped)
+	}
+	return b.String()
+}
+
+// StopFilter removes stop words. The positions of the other tokens are kept,
+// so phrases do not match across a removed word
+type StopFilter struct {
+	words map[string]bool
+}
+
+// NewStopFilter creates a filter removing words
+func NewStopFilter(words ...string) *StopFilter {
+	f := &StopFilter{words: make(map[string]bool, len(words))}
+	for _, word := range words {
+		f.words[word] = true
+	}
+	return f
+}
+
+func (f *StopFilter) Filter(tokens []Token) []Token {
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if !f.words[token.Term] {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+// ElisionFilter removes elided articles and pronouns from the start of
+// terms, such as the "l'" of French "l'été". Terms are expected in lowercase
+type ElisionFilter struct {
+	articles map[string]bool
+}
+
+// NewElisionFilter creates a filter removing the given articles, without
+// their apostrophe
+func NewElisionFilter(articles ...string) *ElisionFilter {
+	f := &ElisionFilter{articles: make(map[string]bool, len(articles))}
+	for _, article := range articles {
+		f.articles[article] = true
+	}
+	return f
+}
+
+func (f *ElisionFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		if at := strings.IndexAny(tokens[i].Term, "'’"); at > 0 && f.articles[tokens[i].Term[:at]] {
+			_, size := utf8.DecodeRuneInString(tokens[i].Term[at:])
+			tokens[i].Term = tokens[i].Term[at+size:]
+		}
+	}
+	return tokens
+}
+
+// LengthFilter removes terms shorter than Min or longer than Max runes.
+// A Max of 0 sets no upper limit
+type LengthFilter struct {
+	Min int
+	Max int
+}
+
+// NewLengthFilter creates a filter keeping terms of min to max runes
+func NewLengthFilter(min, max int) LengthFilter {
+	return LengthFilter{Min: min, Max: max}
+}
+
+func (f LengthFilter) Filter(tokens []Token) []Token {
+	kept := tokens[:0]
+	for _, token := range tokens {
+		n := utf8.RuneCountInString(token.Term)
+		if n >= f.Min && (f.Max == 0 || n <= f.Max) {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+// SynonymFilter adds the synonyms of a term as tokens at the same position
+// and offsets. Terms are compared as they reach the filter, so it belongs
+// after the filters that normalize them; synonyms are single terms
+type SynonymFilter struct {
+	synonyms map[string][]string
+}
+
+// NewSynonymFilter creates a filter from groups of terms that mean the
+// same, such as {"car", "automobile"}: each term of a group is expanded to
+// the others
+func NewSynonymFilter(groups ...[]string) *SynonymFilter {
+	f := &SynonymFilter{synonyms: make(map[string][]string)}
+	for _, group := range groups {
+		for _, term := range group {
+			for _, synonym := range group {
+				if synonym != term && !contains(f.synonyms[term], synonym) {
+					f.synonyms[term] = append(f.synonyms[term], synonym)
+				}
+			}
+		}
+	}
+	return f
+}
+
+func (f *SynonymFilter) Filter(tokens []Token) []Token {
+	expanded := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		expanded = append(expanded, token)
+		for _, synonym := range f.synonyms[token.Term] {
+			added := token
+			added.Term = synonym
+			expanded = append(expanded, added)
+		}
+	}
+	return expanded
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
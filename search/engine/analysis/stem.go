@@ -0,0 +1,91 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	porterstemmer "github.com/blevesearch/go-porterstemmer"
+	"github.com/blevesearch/snowballstem"
+	"github.com/blevesearch/snowballstem/danish"
+	"github.com/blevesearch/snowballstem/dutch"
+	"github.com/blevesearch/snowballstem/english"
+	"github.com/blevesearch/snowballstem/finnish"
+	"github.com/blevesearch/snowballstem/french"
+	"github.com/blevesearch/snowballstem/german"
+	"github.com/blevesearch/snowballstem/hungarian"
+	"github.com/blevesearch/snowballstem/italian"
+	"github.com/blevesearch/snowballstem/norwegian"
+	"github.com/blevesearch/snowballstem/portuguese"
+	"github.com/blevesearch/snowballstem/romanian"
+	"github.com/blevesearch/snowballstem/russian"
+	"github.com/blevesearch/snowballstem/spanish"
+	"github.com/blevesearch/snowballstem/swedish"
+	"github.com/blevesearch/snowballstem/turkish"
+
+	"github.com/jonesrussell/goprowl/search/engine/language"
+)
+
+// PorterFilter stems English terms with the original Porter algorithm.
+// Terms are expected in lowercase
+type PorterFilter struct{}
+
+func (PorterFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = string(porterstemmer.StemWithoutLowerCasing([]rune(tokens[i].Term)))
+	}
+	return tokens
+}
+
+// snowballStemmers maps ISO 639-1 codes to Snowball stemmers
+var snowballStemmers = map[string]func(*snowballstem.Env) bool{
+	"da": danish.Stem,
+	"de": german.Stem,
+	"en": english.Stem,
+	"es": spanish.Stem,
+	"fi": finnish.Stem,
+	"fr": french.Stem,
+	"hu": hungarian.Stem,
+	"it": italian.Stem,
+	"nb": norwegian.Stem,
+	"nl": dutch.Stem,
+	"nn": norwegian.Stem,
+	"no": norwegian.Stem,
+	"pt": portuguese.Stem,
+	"ro": romanian.Stem,
+	"ru": russian.Stem,
+	"sv": swedish.Stem,
+	"tr": turkish.Stem,
+}
+
+// SnowballFilter stems terms with the Snowball stemmer of a language.
+// Terms are expected in lowercase
+type SnowballFilter struct {
+	stem func(*snowballstem.Env) bool
+}
+
+// NewSnowballFilter creates a filter stemming with the Snowball stemmer for
+// the language with the given ISO 639-1 code
+func NewSnowballFilter(lang string) (*SnowballFilter, error) {
+	stem, ok := snowballStemmers[strings.ToLower(strings.TrimSpace(lang))]
+	if !ok {
+		return nil, fmt.Errorf("no snowball stemmer for language %q", lang)
+	}
+	return &SnowballFilter{stem: stem}, nil
+}
+
+func (f *SnowballFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		env := snowballstem.NewEnv(tokens[i].Term)
+		f.stem(env)
+		tokens[i].Term = env.Current()
+	}
+	return tokens
+}
+
+// stopWords returns the stop words of a language
+func stopWords(lang string) []string {
+	if lang == "en" {
+		return EnglishStopWords
+	}
+	return language.StopWords(lang)
+}
@@ -0,0 +1,54 @@
+package analysis
+
+import (
+	"unicode"
+
+	"github.com/blevesearch/segment"
+)
+
+// UnicodeTokenizer splits text at the word boundaries of Unicode Standard
+// Annex #29, so punctuation is not part of any token, words keep their inner
+// apostrophes and periods ("don't", "e.g") and each Han ideograph is a token
+// of its own
+type UnicodeTokenizer struct{}
+
+func (UnicodeTokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	segmenter := segment.NewWordSegmenterDirect([]byte(text))
+	start := 0
+	for segmenter.Segment() {
+		end := start + len(segmenter.Bytes())
+		if segmenter.Type() != segment.None {
+			tokens = append(tokens, Token{
+				Term:     text[start:end],
+				Position: len(tokens),
+				Start:    start,
+				End:      end,
+			})
+		}
+		start = end
+	}
+	return tokens
+}
+
+// WhitespaceTokenizer splits text at white space only, keeping punctuation
+// in the tokens. It suits fields of identifiers, such as keywords or URLs
+type WhitespaceTokenizer struct{}
+
+func (WhitespaceTokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range text {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			tokens = append(tokens, Token{Term: text[start:i], Position: len(tokens), Start: start, End: i})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Term: text[start:], Position: len(tokens), Start: start, End: len(text)})
+	}
+	return tokens
+}
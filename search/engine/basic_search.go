@@ -2,105 +2,501 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/blevesearch/bleve/v2"
-	"github.com/blevesearch/bleve/v2/document"
-	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	blevequery "github.com/blevesearch/bleve/v2/search/query"
+	"github.com/jonesrussell/goprowl/search/engine/expand"
+	"github.com/jonesrussell/goprowl/search/engine/language"
+	"github.com/jonesrussell/goprowl/search/engine/query"
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
+	"github.com/jonesrussell/goprowl/search/engine/suggest"
 	"github.com/jonesrussell/goprowl/search/storage"
+	blevestorage "github.com/jonesrussell/goprowl/search/storage/bleve"
+)
+
+const (
+	defaultSuggestLimit = 10
+	// popularityWeight scales the damped query count added to a
+	// suggestion's document frequency
+	popularityWeight = 2.0
 )
 
 type BasicSearchEngine struct {
 	storage storage.StorageAdapter
 	stats   *SearchStats
-	index   bleve.Index
+
+	// mu guards index, which Reindex and Clear replace, and pending
+	mu    sync.RWMutex
+	index bleve.Index
+	// pending collects IDs written while a reindex is running, nil otherwise
+	pending map[string]struct{}
+
+	// dictionary serves suggestions when the storage keeps none of its own
+	dictionary *suggest.Dictionary
+	queryLog   *suggest.QueryLog
 }
 
 func (e *BasicSearchEngine) Search(query Query) (*SearchResults, error) {
-	docs, err := e.storage.GetAll(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("failed to get documents: %w", err)
-	}
+	ctx := context.Background()
 
-	// Convert storage documents to interface Documents and score them
-	scored := make([]struct {
-		doc   Document
-		score float64
-	}, 0)
+	// Apply pagination
+	page := query.Pagination()
+	from := (page.Page - 1) * page.Size
+	if from < 0 {
+		from = 0
+	}
 
-	for _, doc := range docs {
-		score := e.calculateRelevancy(doc, query.Terms())
+	now := time.Now()
+	q, err := e.buildQuery(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
 
-		// Apply filters
-		if !e.matchesFilters(doc, query.Filters()) {
-			continue
+	// Results are ordered by the sort keys, then by ID, so that a cursor
+	// resumes exactly after the last result it was returned with
+	keys := sortKeys(query.Sort())
+	var after []string
+	if c := query.Cursor(); c != "" {
+		if field := query.Collapse(); field != "" {
+			return nil, fmt.Errorf("%w: results collapsed by %s are paged by page number", ErrInvalidCursor, field)
 		}
-
-		if score > 0 {
-			scored = append(scored, struct {
-				doc   Document
-				score float64
-			}{
-				doc:   NewBasicDocument(doc),
-				score: score,
-			})
+		if after, err = decodeCursor(c, keys); err != nil {
+			return nil, err
 		}
+		from = 0
 	}
 
-	// Sort by score
-	sort.Slice(scored, func(i, j int) bool {
-		return scored[i].score > scored[j].score
-	})
+	size := page.Size
+	if query.Collapse() != "" {
+		// Groups are formed from the top hits, which are fetched from the
+		// start so a group never spans two pages
+		size, from = collapseWindow(from, page.Size), 0
+	}
 
-	// Apply pagination
-	page := query.Pagination()
-	start := (page.Page - 1) * page.Size
-	end := start + page.Size
-	if end > len(scored) {
-		end = len(scored)
+	req := bleve.NewSearchRequestOptions(q, size, from, false)
+	req.SortByCustom(sortOrder(keys))
+	req.SearchAfter = after
+	req.Fields = []string{"*"}
+	for _, facet := range query.Facets() {
+		req.AddFacet(facet.Name, facet.request(now))
 	}
+	req.IncludeLocations = query.Highlight() != nil
+	req.Explain = query.Explain()
 
-	// Convert scored documents to SearchResults
-	hits := make([]SearchResult, 0)
-	if start < end {
-		for _, s := range scored[start:end] {
-			hits = append(hits, SearchResult{
-				Content:  s.doc.Content(),
-				Score:    s.score,
-				Metadata: s.doc.Metadata(),
-			})
+	result, err := e.searchIndex(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search index: %w", err)
+	}
+
+	// Convert bleve hits to SearchResults
+	hits := make([]SearchResult, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		doc := newDocumentFromFields(hit.ID, hit.Fields)
+		result := SearchResult{
+			Content:  doc.Content(),
+			Score:    hit.Score,
+			Metadata: doc.Metadata(),
+		}
+		if opts := query.Highlight(); opts != nil {
+			highlightResult(&result, hit.Locations, opts)
 		}
+		if hit.Expl != nil {
+			result.Explanation = explanation(hit.Expl)
+		}
+		hits = append(hits, result)
+	}
+
+	collapsed := 0
+	if field := query.Collapse(); field != "" {
+		hits, collapsed = collapseHits(hits, field)
+		hits = pageHits(hits, (page.Page-1)*page.Size, page.Size)
 	}
 
 	// Create facets
 	facets := make(map[string][]Facet)
-	typeCounts := make(map[string]int64)
-	for _, doc := range docs {
-		typeCounts[doc.Type]++
+	for _, facet := range query.Facets() {
+		if facetResult, ok := result.Facets[facet.Name]; ok {
+			facets[facet.Name] = facet.results(facetResult)
+		}
 	}
 
-	typeFacets := make([]Facet, 0)
-	for typ, count := range typeCounts {
-		typeFacets = append(typeFacets, Facet{
-			Value: typ,
-			Count: count,
-		})
+	metadata := map[string]interface{}{
+		"total":      int64(result.Total),
+		"query_time": time.Now(),
+		"took":       result.Took,
+		"collapsed":  collapsed,
+	}
+	if query.Collapse() != "" {
+		metadata["total"], metadata["total_approximate"] = collapsedTotal(result.Total, len(result.Hits), collapsed)
+	}
+	// A full page may be followed by another, which the cursor of its last
+	// result returns
+	if query.Collapse() == "" && len(result.Hits) > 0 && len(result.Hits) == size {
+		metadata["next_cursor"] = encodeCursor(keys, result.Hits[len(result.Hits)-1])
 	}
-	facets["type"] = typeFacets
 
 	return &SearchResults{
-		Hits:   hits,
-		Facets: facets,
-		Metadata: map[string]interface{}{
-			"total":      int64(len(scored)),
-			"query_time": time.Now(),
-		},
+		Hits:     hits,
+		Facets:   facets,
+		Metadata: metadata,
 	}, nil
 }
 
+// explanation converts a bleve score explanation
+func explanation(expl *search.Explanation) *ranking.Explanation {
+	children := make([]*ranking.Explanation, len(expl.Children))
+	for i, child := range expl.Children {
+		children[i] = explanation(child)
+	}
+	return ranking.Explain(expl.Value, explanationMessage(expl.Message), children...)
+}
+
+// explanationMessage removes the internal document number bleve writes into
+// some explanation messages as raw bytes, as in "fieldNorm(field=title,
+// doc=\x00...)", which means nothing outside the index
+func explanationMessage(msg string) string {
+	end := strings.LastIndexByte(msg, ')')
+	for _, marker := range []string{" in ", ", doc="} {
+		start := strings.LastIndex(msg[:max(end, 0)], marker)
+		if start < 0 {
+			continue
+		}
+		id := msg[start+len(marker) : end]
+		if strings.IndexFunc(id, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+			return msg[:start] + msg[end:]
+		}
+	}
+	return msg
+}
+
+// searchIndex runs req against the storage's own bleve index when it has one,
+// falling back to the engine's in-memory index otherwise
+func (e *BasicSearchEngine) searchIndex(ctx context.Context, req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	if indexed, ok := e.storage.(IndexedStorage); ok {
+		return indexed.SearchIndex(ctx, req)
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.index.SearchInContext(ctx, req)
+}
+
+// buildQuery translates the parsed query tree and filters into a bleve query.
+// Filters named after a facet, requested or default, select its values or
+// buckets; other filters match their value against the field of that name.
+// The typed filter is added to them. A filter on a single language analyzes
+// the query text for that language
+func (e *BasicSearchEngine) buildQuery(ctx context.Context, query Query, now time.Time) (blevequery.Query, error) {
+	root := query.Root()
+	filters := query.Filters()
+	typed := query.Filter()
+	if root == nil && len(filters) == 0 && typed == nil {
+		return bleve.NewMatchNoneQuery(), nil
+	}
+
+	// A query of filters alone, such as "lang:fr", selects everything they allow
+	var q blevequery.Query = bleve.NewMatchAllQuery()
+	if root != nil {
+		var err error
+		builder := &queryBuilder{
+			analyzer: queryAnalyzer(filters),
+			now:      now,
+			expand: func(field string, m expand.Matcher) ([]expand.Term, error) {
+				return e.expandTerms(ctx, field, m, query.MaxExpansions())
+			},
+		}
+		if q, err = builder.buildNodeQuery(root); err != nil {
+			return nil, err
+		}
+	}
+	if len(filters) == 0 && typed == nil {
+		return q, nil
+	}
+
+	// Filters restrict the result set without affecting the score
+	conjuncts := []blevequery.Query{q}
+	if typed != nil {
+		filter, err := typed.query(now)
+		if err != nil {
+			return nil, err
+		}
+		conjuncts = append(conjuncts, unscored(filter))
+	}
+	for key, value := range filters {
+		if isLanguageField(key) {
+			key = language.Field
+		}
+
+		facet, ok := findFacet(query.Facets(), key)
+		if !ok {
+			facet, ok = findFacet(DefaultFacets(), key)
+		}
+
+		var filter blevequery.Query
+		if ok {
+			var err error
+			if filter, err = facet.filter(value, now); err != nil {
+				return nil, err
+			}
+		} else {
+			match := bleve.NewMatchQuery(fmt.Sprint(value))
+			match.SetField(key)
+			match.SetOperator(blevequery.MatchQueryOperatorAnd)
+			filter = match
+		}
+
+		conjuncts = append(conjuncts, unscored(filter))
+	}
+
+	return bleve.NewConjunctionQuery(conjuncts...), nil
+}
+
+// unscored keeps a filter from adding to the scores of the documents it
+// matches
+func unscored(filter blevequery.Query) blevequery.Query {
+	if boostable, ok := filter.(blevequery.BoostableQuery); ok {
+		boostable.SetBoost(0)
+	}
+	return filter
+}
+
+// queryAnalyzer returns the analyzer of the language the filters restrict
+// results to, or "" when they allow several languages or one without an
+// analyzer
+func queryAnalyzer(filters map[string]interface{}) string {
+	var langs []string
+	for key, value := range filters {
+		if isLanguageField(key) {
+			langs = append(langs, filterValues(value)...)
+		}
+	}
+	if len(langs) != 1 {
+		return ""
+	}
+	analyzer, _ := language.Analyzer(langs[0])
+	return analyzer
+}
+
+// isLanguageField reports whether a query field or filter names the
+// document language, for which "lang" is short
+func isLanguageField(field string) bool {
+	return field == "lang" || field == language.Field
+}
+
+// queryBuilder converts query trees into bleve queries
+type queryBuilder struct {
+	// analyzer, when set, matches text against the fields analyzed for the
+	// language of the results
+	analyzer string
+	// now is the time relative dates in ranges are resolved against
+	now time.Time
+	// expand returns the terms of a field a pattern matches
+	expand func(field string, m expand.Matcher) ([]expand.Term, error)
+}
+
+// buildNodeQuery converts a query tree node into the equivalent bleve query
+func (b *queryBuilder) buildNodeQuery(node query.Node) (blevequery.Query, error) {
+	switch n := node.(type) {
+	case *QueryTerm:
+		return b.buildTermQuery(n)
+	case *query.RequiredNode:
+		return b.buildNodeQuery(n.Child)
+	case *query.NotNode:
+		child, err := b.buildNodeQuery(n.Child)
+		if err != nil {
+			return nil, err
+		}
+		return blevequery.NewBooleanQuery(nil, nil, []blevequery.Query{child}), nil
+	case *query.BooleanNode:
+		var must, should, mustNot []blevequery.Query
+		for _, clause := range n.Clauses {
+			target := &should
+			switch c := clause.(type) {
+			case *query.NotNode:
+				target, clause = &mustNot, c.Child
+			case *query.RequiredNode:
+				target, clause = &must, c.Child
+			default:
+				if n.Op == query.OpAnd {
+					target = &must
+				}
+			}
+			q, err := b.buildNodeQuery(clause)
+			if err != nil {
+				return nil, err
+			}
+			*target = append(*target, q)
+		}
+
+		boolQuery := blevequery.NewBooleanQuery(must, should, mustNot)
+		if len(must) == 0 && len(should) > 0 {
+			// Without required clauses at least one optional clause has to
+			// match, otherwise negations alone would select documents
+			boolQuery.SetMinShould(1)
+		}
+		return boolQuery, nil
+	}
+
+	return bleve.NewMatchNoneQuery(), nil
+}
+
+// buildTermQuery converts a single query term into a bleve query, weighting
+// title matches above heading matches, and those above content and
+// description matches, when no field is given. A language term matches the
+// document language exactly, a range term the values within it, and a
+// pattern term the indexed terms it expands to
+func (b *queryBuilder) buildTermQuery(term *QueryTerm) (blevequery.Query, error) {
+	if isLanguageField(term.Field) {
+		q := bleve.NewTermQuery(strings.ToLower(term.Text))
+		q.SetField(language.Field)
+		return q, nil
+	}
+	if term.Type == TypeRange {
+		return termFilter(term).query(b.now)
+	}
+	if term.MatchesAll() {
+		if term.Field == "" {
+			return bleve.NewMatchAllQuery(), nil
+		}
+		return existsQuery(filterField(term.Field)), nil
+	}
+
+	var matcher expand.Matcher
+	if expand.IsPattern(term) {
+		var err error
+		if matcher, err = expand.ForTerm(term); err != nil {
+			return nil, err
+		}
+	}
+
+	fieldQuery := func(field string, boost float64) (blevequery.Query, error) {
+		if term.Boost > 0 {
+			boost *= term.Boost
+		}
+		if matcher != nil {
+			return b.expandedQuery(field, matcher, boost)
+		}
+
+		// Text is analyzed the way the language's documents were indexed
+		textField, textAnalyzer := field, ""
+		if b.analyzer != "" && language.IsAnalyzed(field) {
+			textField, textAnalyzer = language.AnalyzedField(field), b.analyzer
+		}
+
+		switch term.Type {
+		case TypePhrase:
+			if term.Slop > 0 {
+				// bleve has no sloppy phrase queries, so a proximity phrase
+				// matches the documents holding all of its terms
+				q := bleve.NewMatchQuery(term.Text)
+				q.SetField(textField)
+				q.Analyzer = textAnalyzer
+				q.SetOperator(blevequery.MatchQueryOperatorAnd)
+				q.SetBoost(boost)
+				return q, nil
+			}
+			q := bleve.NewMatchPhraseQuery(term.Text)
+			q.SetField(textField)
+			q.Analyzer = textAnalyzer
+			q.SetBoost(boost)
+			return q, nil
+		default:
+			q := bleve.NewMatchQuery(term.Text)
+			q.SetField(textField)
+			q.Analyzer = textAnalyzer
+			q.SetBoost(boost)
+			return q, nil
+		}
+	}
+
+	if term.Field != "" {
+		return fieldQuery(term.Field, 1.0)
+	}
+
+	titleBoost, headingsBoost, contentBoost := 2.0, 1.5, 1.0
+	if term.Type == TypePhrase {
+		titleBoost, headingsBoost, contentBoost = 3.0, 2.5, 2.0
+	}
+
+	fields := []struct {
+		name  string
+		boost float64
+	}{
+		{"title", titleBoost},
+		{"headings", headingsBoost},
+		{"content", contentBoost},
+		{"description", contentBoost},
+	}
+	disjuncts := make([]blevequery.Query, len(fields))
+	for i, field := range fields {
+		q, err := fieldQuery(field.name, field.boost)
+		if err != nil {
+			return nil, err
+		}
+		disjuncts[i] = q
+	}
+	return bleve.NewDisjunctionQuery(disjuncts...), nil
+}
+
+// expandedQuery matches the terms of field that m matches, as found by
+// b.expand. Fuzzy matches are weighted down the more edits they are away
+func (b *queryBuilder) expandedQuery(field string, m expand.Matcher, boost float64) (blevequery.Query, error) {
+	terms, err := b.expand(field, m)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return bleve.NewMatchNoneQuery(), nil
+	}
+
+	disjuncts := make([]blevequery.Query, len(terms))
+	for i, term := range terms {
+		q := bleve.NewTermQuery(term.Text)
+		q.SetField(field)
+		q.SetBoost(boost / float64(1+term.Distance))
+		disjuncts[i] = q
+	}
+	return bleve.NewDisjunctionQuery(disjuncts...), nil
+}
+
+// expandTerms returns the terms of field in the index searched that m
+// matches, at most limit of them, or an error wrapping
+// expand.ErrTooManyTerms when there are more
+func (e *BasicSearchEngine) expandTerms(ctx context.Context, field string, m expand.Matcher, limit int) ([]expand.Term, error) {
+	collector := expand.NewCollector(m, limit)
+	if indexed, ok := e.storage.(IndexedStorage); ok {
+		if err := indexed.FieldTerms(ctx, field, collector.Visit); err != nil {
+			return nil, err
+		}
+		return collector.Terms()
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	dict, err := e.index.FieldDict(field)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terms of %s: %w", field, err)
+	}
+	defer dict.Close()
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read terms of %s: %w", field, err)
+		}
+		if entry == nil || !collector.Visit(entry.Term) {
+			return collector.Terms()
+		}
+	}
+}
+
 // Helper to convert storage document to Document interface
 type BasicDocument struct {
 	id         string
@@ -129,6 +525,57 @@ func NewBasicDocument(doc *storage.Document) *BasicDocument {
 	}
 }
 
+// newDocumentFromFields builds a document from the stored fields of an index hit
+func newDocumentFromFields(id string, fields map[string]interface{}) *BasicDocument {
+	stringField := func(name string) string {
+		value, _ := fields[name].(string)
+		return value
+	}
+
+	var createdAt time.Time
+	if created := stringField("created_at"); created != "" {
+		if parsed, err := time.Parse(time.RFC3339, created); err == nil {
+			createdAt = parsed
+		}
+	}
+
+	url := stringField("url")
+	if url == "" {
+		url = id
+	}
+
+	docType := stringField("type")
+	if docType == "" {
+		docType = "webpage"
+	}
+
+	// Stored fields beyond the core ones are document metadata
+	metadata := map[string]interface{}{}
+	for name, value := range fields {
+		switch name {
+		case "url", "title", "content", "type":
+			continue
+		}
+		metadata[name] = value
+	}
+	metadata["created_at"] = createdAt
+
+	return &BasicDocument{
+		id:      id,
+		docType: docType,
+		content: map[string]interface{}{
+			"title":   stringField("title"),
+			"content": stringField("content"),
+			"url":     url,
+		},
+		metadata: metadata,
+		permission: &Permission{
+			Read:  []string{"public"},
+			Write: []string{"admin"},
+		},
+	}
+}
+
 // Implement Document interface
 func (d *BasicDocument) ID() string                       { return d.id }
 func (d *BasicDocument) Type() string                     { return d.docType }
@@ -161,35 +608,35 @@ func (e *BasicSearchEngine) Index(doc Document) error {
 
 	// Convert Document interface to storage.Document
 	storageDoc := &storage.Document{
-		URL:     doc.ID(),
-		Title:   title,
-		Content: contentStr,
-		Type:    doc.Type(),
+		URL:       doc.ID(),
+		Title:     title,
+		Content:   contentStr,
+		Type:      doc.Type(),
+		Metadata:  doc.Metadata(),
+		CreatedAt: time.Now(),
 	}
 
-	// Create a new document for indexing
-	indexDoc := document.NewDocument(storageDoc.URL)
+	ctx := context.Background()
 
-	// Only add fields that are not empty
-	if storageDoc.Title != "" {
-		indexDoc.AddField(document.NewTextField("title", []uint64{}, []byte(storageDoc.Title)))
-	}
-	if storageDoc.Content != "" {
-		indexDoc.AddField(document.NewTextField("content", []uint64{}, []byte(storageDoc.Content)))
-	}
-	if storageDoc.Type != "" {
-		indexDoc.AddField(document.NewTextField("type", []uint64{}, []byte(storageDoc.Type)))
+	// Storage backed by its own index indexes the document as it stores it
+	if _, ok := e.storage.(IndexedStorage); ok {
+		if err := e.storage.Store(ctx, storageDoc); err != nil {
+			return fmt.Errorf("failed to store document: %w", err)
+		}
+		return nil
 	}
 
-	// Store in storage adapter
-	err := e.storage.Store(context.Background(), storageDoc)
+	previous, err := e.previousVersions(ctx, []*storage.Document{storageDoc})
 	if err != nil {
+		return err
+	}
+
+	if err := e.storage.Store(ctx, storageDoc); err != nil {
 		return fmt.Errorf("failed to store document: %w", err)
 	}
 
-	// Index the document
-	if err := e.index.Index(storageDoc.URL, indexDoc); err != nil {
-		return fmt.Errorf("failed to index document: %w", err)
+	if err := e.indexDocuments([]*storage.Document{storageDoc}); err != nil {
+		return e.rollback(ctx, fmt.Errorf("failed to index document: %w", err), previous)
 	}
 
 	return nil
@@ -203,14 +650,31 @@ func (e *BasicSearchEngine) BatchIndex(docs []Document) error {
 			Title:     doc.Content()["title"].(string),
 			Content:   doc.Content()["content"].(string),
 			Type:      doc.Type(),
+			Metadata:  doc.Metadata(),
 			CreatedAt: time.Now(),
 		}
 	}
 
-	// Store all documents
-	err := e.storage.BatchStore(context.Background(), storageDocs)
-	if err != nil {
-		return fmt.Errorf("failed to batch store documents: %w", err)
+	ctx := context.Background()
+
+	if _, ok := e.storage.(IndexedStorage); ok {
+		if err := e.storage.BatchStore(ctx, storageDocs); err != nil {
+			return fmt.Errorf("failed to batch store documents: %w", err)
+		}
+	} else {
+		previous, err := e.previousVersions(ctx, storageDocs)
+		if err != nil {
+			return err
+		}
+
+		if err := e.storage.BatchStore(ctx, storageDocs); err != nil {
+			// Part of the batch may have been written
+			return e.rollback(ctx, fmt.Errorf("failed to batch store documents: %w", err), previous)
+		}
+
+		if err := e.indexDocuments(storageDocs); err != nil {
+			return e.rollback(ctx, fmt.Errorf("failed to batch index documents: %w", err), previous)
+		}
 	}
 
 	// Update stats
@@ -220,91 +684,167 @@ func (e *BasicSearchEngine) BatchIndex(docs []Document) error {
 	return nil
 }
 
+// Delete removes a document from storage and the index. If the index
+// cannot be updated the document is stored again, so the two stay in step
 func (e *BasicSearchEngine) Delete(id string) error {
-	// Implementation
+	ctx := context.Background()
+
+	doc, err := e.storage.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete document %s: %w", id, err)
+	}
+
+	if err := e.storage.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete document %s: %w", id, err)
+	}
+
+	if _, ok := e.storage.(IndexedStorage); ok {
+		return nil
+	}
+
+	if err := e.unindexDocument(id); err != nil {
+		err = fmt.Errorf("failed to remove document %s from index: %w", id, err)
+		return e.rollback(ctx, err, map[string]*storage.Document{id: doc})
+	}
+
 	return nil
 }
 
-func (e *BasicSearchEngine) Suggest(prefix string) []string {
-	// Implementation
+// indexDocuments adds documents to the engine's own index
+func (e *BasicSearchEngine) indexDocuments(docs []*storage.Document) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	batch := e.index.NewBatch()
+	for _, doc := range docs {
+		if err := batch.Index(doc.URL, blevestorage.DocumentFields(doc)); err != nil {
+			return fmt.Errorf("failed to add document to batch: %w", err)
+		}
+	}
+	if err := e.index.Batch(batch); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		e.markPending(doc.URL)
+		e.dictionary.Add(doc.URL, doc.Title, doc.Content)
+	}
 	return nil
 }
 
-func (e *BasicSearchEngine) Reindex() error {
-	// Implementation
+// unindexDocument removes a document from the engine's own index
+func (e *BasicSearchEngine) unindexDocument(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.index.Delete(id); err != nil {
+		return err
+	}
+
+	e.markPending(id)
+	e.dictionary.Remove(id)
 	return nil
 }
 
-func (e *BasicSearchEngine) Stats() *SearchStats {
-	return e.stats
+// markPending records a write made while a reindex is running. Callers hold mu
+func (e *BasicSearchEngine) markPending(id string) {
+	if e.pending != nil {
+		e.pending[id] = struct{}{}
+	}
 }
 
-func (e *BasicSearchEngine) calculateRelevancy(doc *storage.Document, terms []*QueryTerm) float64 {
-	score := 0.0
+// previousVersions returns the stored version of each document, nil for
+// documents that are not stored yet, so a failed write can be undone
+func (e *BasicSearchEngine) previousVersions(ctx context.Context, docs []*storage.Document) (map[string]*storage.Document, error) {
+	previous := make(map[string]*storage.Document, len(docs))
+	for _, doc := range docs {
+		stored, err := e.storage.Get(ctx, doc.URL)
+		if err != nil && !errors.Is(err, storage.ErrDocumentNotFound) {
+			return nil, fmt.Errorf("failed to read document %s: %w", doc.URL, err)
+		}
+		previous[doc.URL] = stored
+	}
+	return previous, nil
+}
 
-	for _, term := range terms {
-		switch term.Type {
-		case TypePhrase:
-			if strings.Contains(doc.Title, term.Text) {
-				score += 3.0
-			}
-			if strings.Contains(doc.Content, term.Text) {
-				score += 2.0
-			}
+// rollback restores the previous versions of documents in storage after the
+// index rejected a write, returning cause along with any restore failures
+func (e *BasicSearchEngine) rollback(ctx context.Context, cause error, previous map[string]*storage.Document) error {
+	errs := []error{cause}
+	for id, doc := range previous {
+		var err error
+		if doc == nil {
+			err = e.storage.Delete(ctx, id)
+		} else {
+			err = e.storage.Store(ctx, doc)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore document %s in storage: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
 
-		case TypeFuzzy:
-			// Implement fuzzy matching logic here
-			// For now, simple contains check
-			if strings.Contains(doc.Title, term.Text) {
-				score += 2.0
-			}
-			if strings.Contains(doc.Content, term.Text) {
-				score += 1.0
-			}
+// Suggest returns completions of prefix ranked by document frequency and
+// search popularity
+func (e *BasicSearchEngine) Suggest(prefix string) []string {
+	suggestions, err := e.SuggestWithOptions(context.Background(), prefix, SuggestOptions{Popularity: true})
+	if err != nil {
+		return nil
+	}
 
-		default:
-			if term.Field != "" {
-				switch term.Field {
-				case "title":
-					if strings.Contains(strings.ToLower(doc.Title), strings.ToLower(term.Text)) {
-						score += 2.0
-					}
-				case "content":
-					if strings.Contains(strings.ToLower(doc.Content), strings.ToLower(term.Text)) {
-						score += 1.0
-					}
-				}
-			} else {
-				if strings.Contains(strings.ToLower(doc.Title), strings.ToLower(term.Text)) {
-					score += 2.0
-				}
-				if strings.Contains(strings.ToLower(doc.Content), strings.ToLower(term.Text)) {
-					score += 1.0
-				}
-			}
+	texts := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		texts = append(texts, suggestion.Text)
+	}
+	return texts
+}
+
+// SuggestWithOptions implements the SearchEngine interface
+func (e *BasicSearchEngine) SuggestWithOptions(ctx context.Context, prefix string, opts SuggestOptions) ([]Suggestion, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+
+	// Popularity can promote any completion, so rank all of them
+	candidates := limit
+	if opts.Popularity {
+		candidates = 0
+	}
+
+	var suggestions []Suggestion
+	if suggesting, ok := e.storage.(SuggestingStorage); ok {
+		var err error
+		if suggestions, err = suggesting.Suggest(ctx, prefix, candidates); err != nil {
+			return nil, fmt.Errorf("failed to get suggestions: %w", err)
 		}
+	} else {
+		suggestions = e.dictionary.Complete(prefix, candidates)
 	}
 
-	return score
+	if opts.Popularity {
+		suggestions = e.queryLog.WithPopularity(prefix, suggestions, popularityWeight, limit)
+	}
+	return suggestions, nil
 }
 
-func (e *BasicSearchEngine) matchesFilters(doc *storage.Document, filters map[string]interface{}) bool {
-	for key, value := range filters {
-		switch key {
-		case "type":
-			if doc.Type != value.(string) {
-				return false
-			}
-			// Add more filter cases as needed
-		}
+// Stats returns engine statistics. The document count is read from the
+// index, since crawled pages may be stored without passing through Index
+func (e *BasicSearchEngine) Stats() *SearchStats {
+	stats := *e.stats
+
+	req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	if result, err := e.searchIndex(context.Background(), req); err == nil {
+		stats.DocumentCount = int64(result.Total)
 	}
-	return true
+
+	return &stats
 }
 
 func New(storage storage.StorageAdapter) (SearchEngine, error) {
 	// Create new bleve index in memory
-	indexMapping := mapping.NewIndexMapping()
-	index, err := bleve.NewMemOnly(indexMapping)
+	index, err := bleve.NewMemOnly(blevestorage.NewMapping())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create search index: %w", err)
 	}
@@ -314,27 +854,106 @@ func New(storage storage.StorageAdapter) (SearchEngine, error) {
 		stats: &SearchStats{
 			LastIndexed: time.Now(),
 		},
-		index: index,
+		index:      index,
+		dictionary: suggest.NewDictionary(),
+		queryLog:   suggest.NewQueryLog(),
 	}, nil
 }
 
 // SearchWithOptions implements the SearchEngine interface
-func (e *BasicSearchEngine) SearchWithOptions(ctx context.Context, opts SearchOptions) ([]SearchResult, error) {
+func (e *BasicSearchEngine) SearchWithOptions(ctx context.Context, opts SearchOptions) (*SearchResults, error) {
+	query, err := optionsQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := e.Search(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only queries that found something are worth suggesting to others
+	if total, _ := results.Metadata["total"].(int64); total > 0 {
+		if text, ok := plainQuery(opts.Query); ok {
+			e.queryLog.Record(text)
+		}
+	}
+
+	return results, nil
+}
+
+// optionsQuery parses the query of opts and applies the other options to it
+func optionsQuery(opts SearchOptions) (*BasicQuery, error) {
 	processor := NewQueryProcessor()
 	query, err := processor.ParseQuery(opts.Query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse query: %w", err)
 	}
-	query.SetPagination(opts.Page, opts.PageSize)
-
-	// Use existing Search method
-	results, err := e.Search(query)
+	page, pageSize := opts.Page, opts.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	query.SetPagination(page, pageSize)
+	query.SetHighlight(opts.Highlight)
+	query.SetFacets(opts.Facets)
+	query.SetCollapse(opts.Collapse)
+	query.SetExplain(opts.Explain)
+	keys, err := ParseSort(opts.SortBy, opts.SortOrder)
 	if err != nil {
 		return nil, err
 	}
+	query.SetSort(keys)
+	query.SetCursor(opts.Cursor)
+	query.SetMaxExpansions(opts.MaxExpansions)
+	for key, value := range opts.Filters {
+		query.SetFilter(key, value)
+	}
+	query.AddFilter(opts.Filter)
+	return query, nil
+}
+
+// plainQuery returns the words and phrase texts of a query made of nothing
+// else, for the query log. Queries with fields, operators, exclusions,
+// patterns, ranges or boosts are left out, so their syntax is never
+// suggested to others
+func plainQuery(input string) (string, bool) {
+	root, err := query.NewQueryProcessor().ParseQuery(input)
+	if err != nil {
+		return "", false
+	}
 
-	// Return the hits directly
-	return results.Hits, nil
+	var words []string
+	var walk func(n query.Node) bool
+	walk = func(n query.Node) bool {
+		switch n := n.(type) {
+		case *query.BooleanNode:
+			// Words side by side parse to OR, so AND was typed
+			if n.Op != query.OpOr {
+				return false
+			}
+			for _, clause := range n.Clauses {
+				if !walk(clause) {
+					return false
+				}
+			}
+			return true
+		case *query.QueryTerm:
+			if n.Field != "" || n.Boost != 0 || n.Slop != 0 ||
+				(n.Type != query.TypeSimple && n.Type != query.TypePhrase) {
+				return false
+			}
+			words = append(words, n.Text)
+			return true
+		}
+		return false
+	}
+	if !walk(root) {
+		return "", false
+	}
+	return strings.Join(words, " "), true
 }
 
 // GetTotalResults implements the SearchEngine interface
@@ -372,37 +991,100 @@ func (e *BasicSearchEngine) List() ([]Document, error) {
 	// Convert storage documents to engine Documents
 	results := make([]Document, 0, len(docs))
 	for _, doc := range docs {
-		results = append(results, &BasicDocument{
-			id: doc.URL,
-			content: map[string]interface{}{
-				"url":     doc.URL,
-				"title":   doc.Title,
-				"content": doc.Content,
-			},
-			docType: doc.Type,
-			metadata: map[string]interface{}{
-				"created_at": doc.CreatedAt,
-			},
-		})
+		results = append(results, documentFromStorage(doc))
 	}
 
 	return results, nil
 }
 
+// ListedFields are the stored fields ListPage returns of each document
+var ListedFields = []string{
+	"url", "title", "type", "created_at", "modified_at",
+	"host", "language", "content_type", "content_length",
+}
+
+// ListPage returns up to limit documents in ID order, starting after the ID
+// after, or from the first when it is "". The page is read from the index,
+// fetching ListedFields only
+func (e *BasicSearchEngine) ListPage(ctx context.Context, after string, limit int) (*DocumentPage, error) {
+	// One more than the page tells whether another follows
+	req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), limit+1, 0, false)
+	req.SortBy([]string{"_id"})
+	req.Fields = ListedFields
+	if after != "" {
+		req.SetSearchAfter([]string{after})
+	}
+
+	result, err := e.searchIndex(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	hits := result.Hits
+	page := &DocumentPage{Total: int64(result.Total)}
+	if len(hits) > limit {
+		hits = hits[:limit]
+		page.Next = hits[len(hits)-1].ID
+	}
+	page.Documents = make([]Document, 0, len(hits))
+	for _, hit := range hits {
+		page.Documents = append(page.Documents, newDocumentFromFields(hit.ID, hit.Fields))
+	}
+	return page, nil
+}
+
+// Get retrieves a single document from storage by ID
+func (e *BasicSearchEngine) Get(id string) (Document, error) {
+	doc, err := e.storage.Get(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document %s: %w", id, err)
+	}
+
+	return documentFromStorage(doc), nil
+}
+
+// documentFromStorage converts a storage document to an engine Document
+func documentFromStorage(doc *storage.Document) *BasicDocument {
+	metadata := make(map[string]interface{}, len(doc.Metadata)+1)
+	for key, value := range doc.Metadata {
+		metadata[key] = value
+	}
+	metadata["created_at"] = doc.CreatedAt
+
+	return &BasicDocument{
+		id: doc.URL,
+		content: map[string]interface{}{
+			"url":     doc.URL,
+			"title":   doc.Title,
+			"content": doc.Content,
+		},
+		docType:  doc.Type,
+		metadata: metadata,
+	}
+}
+
 // Clear implements the SearchEngine interface by removing all documents
 func (e *BasicSearchEngine) Clear() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.pending != nil {
+		return storage.ErrReindexInProgress
+	}
+
 	// Clear the bleve index
 	if err := e.index.Close(); err != nil {
 		return fmt.Errorf("failed to close index: %w", err)
 	}
 
 	// Create new empty index
-	indexMapping := mapping.NewIndexMapping()
-	newIndex, err := bleve.NewMemOnly(indexMapping)
+	newIndex, err := bleve.NewMemOnly(blevestorage.NewMapping())
 	if err != nil {
 		return fmt.Errorf("failed to create new index: %w", err)
 	}
 	e.index = newIndex
+	e.dictionary.Clear()
+	e.queryLog.Clear()
 
 	// Clear the storage
 	if err := e.storage.Clear(context.Background()); err != nil {
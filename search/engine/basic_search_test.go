@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jonesrussell/goprowl/search/engine/expand"
+)
+
+func TestListPage(t *testing.T) {
+	e := newTestEngine(t)
+
+	var ids []string
+	after := ""
+	for pages := 0; ; pages++ {
+		if pages > len(testDocuments) {
+			t.Fatal("listing does not end")
+		}
+		page, err := e.ListPage(context.Background(), after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != int64(len(testDocuments)) {
+			t.Errorf("page after %q total = %d, want %d", after, page.Total, len(testDocuments))
+		}
+		for _, doc := range page.Documents {
+			ids = append(ids, doc.ID())
+			if content, _ := doc.Content()["content"].(string); content != "" {
+				t.Errorf("document %s listed with its content", doc.ID())
+			}
+		}
+		if page.Next == "" {
+			break
+		}
+		after = page.Next
+	}
+
+	if want := []string{article, news, produit}; !equalStrings(ids, want) {
+		t.Errorf("listed %v, want %v", ids, want)
+	}
+}
+
+func TestSearchFiltersOnly(t *testing.T) {
+	e := newTestEngine(t)
+
+	results, err := e.SearchWithOptions(context.Background(), SearchOptions{
+		Filters: map[string]interface{}{"host": "a.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := results.Metadata["total"].(int64); total != 2 {
+		t.Errorf("filters alone matched %d documents, want 2", total)
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	e := newTestEngine(t)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"*", []string{article, news, produit}},
+		{"* -crawler", []string{produit}},
+		{"author:*", []string{article}},
+		{"* -author:*", []string{news, produit}},
+	}
+	for _, tt := range tests {
+		if got := searchURLs(t, e, tt.query); !equalStrings(got, tt.want) {
+			t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMaxExpansions(t *testing.T) {
+	e := newTestEngine(t)
+
+	// content holds faster, fetches, fetching and follows
+	tests := []struct {
+		query         string
+		maxExpansions int
+		tooMany       bool
+	}{
+		{query: "f*", maxExpansions: 3, tooMany: true},
+		{query: "f*", maxExpansions: 4},
+		{query: "fetch*", maxExpansions: 2},
+		{query: "fetch*", maxExpansions: 1, tooMany: true},
+		{query: "/f(aster|etches)/", maxExpansions: 1, tooMany: true},
+		{query: "f*"},
+	}
+	for _, tt := range tests {
+		_, err := e.SearchWithOptions(context.Background(), SearchOptions{Query: tt.query, MaxExpansions: tt.maxExpansions})
+		if tt.tooMany && !errors.Is(err, expand.ErrTooManyTerms) {
+			t.Errorf("search %q with %d expansions: got error %v, want ErrTooManyTerms", tt.query, tt.maxExpansions, err)
+		}
+		if !tt.tooMany && err != nil {
+			t.Errorf("search %q with %d expansions: %v", tt.query, tt.maxExpansions, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package engine
+
+import "fmt"
+
+// ClusterField holds the ID of the group of near-duplicate pages a document
+// belongs to
+const ClusterField = "cluster_id"
+
+const (
+	// collapseFactor is how many hits are fetched per result wanted when
+	// collapsing, leaving room for groups with several members
+	collapseFactor = 5
+	// maxCollapseWindow caps the hits fetched for collapsing
+	maxCollapseWindow = 1000
+)
+
+// collapseWindow returns how many top hits to fetch to fill the page
+// starting at from once they are collapsed
+func collapseWindow(from, size int) int {
+	return min((from+size)*collapseFactor, maxCollapseWindow)
+}
+
+// collapsedTotal returns the number of groups that the matches of a search
+// collapse to, from the hits of its window. Pages end with the window, which
+// holds all the matches or maxCollapseWindow of them, so the total counts
+// the groups among at most that many matches. It is exact when the window
+// held them all, and otherwise an upper bound: the groups of the matches
+// past the window are not known
+func collapsedTotal(matches uint64, window, collapsed int) (int64, bool) {
+	reachable := min(int(matches), maxCollapseWindow)
+	return int64(reachable - collapsed), window < reachable
+}
+
+// collapseHits keeps the first, best scoring, hit of each group of hits
+// sharing a value of field, counting the others in its "duplicates"
+// metadata. Hits without a value form groups of their own. It returns the
+// kept hits and how many were dropped
+func collapseHits(hits []SearchResult, field string) ([]SearchResult, int) {
+	groups := make(map[string]int, len(hits)) // Group value -> index in kept
+	kept := hits[:0]
+	for _, hit := range hits {
+		value := collapseValue(hit, field)
+		if value == "" {
+			kept = append(kept, hit)
+			continue
+		}
+		if i, ok := groups[value]; ok {
+			duplicates, _ := kept[i].Metadata["duplicates"].(int)
+			kept[i].Metadata["duplicates"] = duplicates + 1
+			continue
+		}
+		groups[value] = len(kept)
+		kept = append(kept, hit)
+	}
+	return kept, len(hits) - len(kept)
+}
+
+func collapseValue(hit SearchResult, field string) string {
+	for _, fields := range []map[string]interface{}{hit.Metadata, hit.Content} {
+		if value, ok := fields[field]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// pageHits returns the hits of one page
+func pageHits(hits []SearchResult, from, size int) []SearchResult {
+	if from >= len(hits) {
+		return []SearchResult{}
+	}
+	return hits[from:min(from+size, len(hits))]
+}
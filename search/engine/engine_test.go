@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jonesrussell/goprowl/search/storage"
+	blevestorage "github.com/jonesrussell/goprowl/search/storage/bleve"
+)
+
+// testNow is the time the test documents are dated against
+var testNow = time.Now()
+
+// The URLs of testDocuments
+const (
+	article = "https://a.example.com/article"
+	news    = "https://a.example.com/news"
+	produit = "https://b.example.com/produit"
+)
+
+// testDocuments are indexed by newTestEngine
+var testDocuments = []*storage.Document{
+	{
+		URL:       article,
+		Title:     "Writing a web crawler",
+		Content:   "A crawler fetches pages and follows their links.",
+		Type:      "webpage",
+		CreatedAt: testNow.Add(-48 * time.Hour),
+		Metadata: map[string]interface{}{
+			"host":         "a.example.com",
+			"author":       "Ada",
+			"schema_types": []string{"Article"},
+			"language":     "en",
+		},
+	},
+	{
+		URL:       news,
+		Title:     "Crawler news",
+		Content:   "The crawler was released today with faster fetching.",
+		Type:      "webpage",
+		CreatedAt: testNow.Add(-30 * 24 * time.Hour),
+		Metadata: map[string]interface{}{
+			"host":         "a.example.com",
+			"schema_types": []string{"Article", "NewsArticle"},
+			"language":     "en",
+		},
+	},
+	{
+		URL:       produit,
+		Title:     "Robot d'indexation",
+		Content:   "Un robot d'indexation parcourt les pages du web et suit leurs liens.",
+		Type:      "webpage",
+		CreatedAt: testNow.Add(-24 * time.Hour),
+		Metadata: map[string]interface{}{
+			"host":         "b.example.com",
+			"schema_types": []string{"Product"},
+			"language":     "fr",
+		},
+	},
+}
+
+// newTestStorage returns a bleve storage of its own holding testDocuments
+func newTestStorage(t *testing.T) storage.StorageAdapter {
+	t.Helper()
+
+	store, err := blevestorage.New(filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if err := store.BatchStore(context.Background(), testDocuments); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// newTestEngine returns an engine searching testDocuments in a bleve
+// storage of its own
+func newTestEngine(t *testing.T) SearchEngine {
+	t.Helper()
+
+	e, err := New(newTestStorage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// searchURLs returns the URLs of the results of query, sorted
+func searchURLs(t *testing.T, e SearchEngine, query string) []string {
+	t.Helper()
+
+	results, err := e.SearchWithOptions(context.Background(), SearchOptions{Query: query, PageSize: 100})
+	if err != nil {
+		t.Fatalf("search %q: %v", query, err)
+	}
+	urls := make([]string, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		url, _ := hit.Content["url"].(string)
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+// Package expand matches the terms of an index's dictionary against the
+// patterns of multi-term queries: prefixes, wildcards, regular expressions
+// and fuzzy terms
+package expand
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jonesrussell/goprowl/search/engine/query"
+)
+
+// DefaultMaxExpansions is how many terms a pattern may match in a field when
+// no limit is set
+const DefaultMaxExpansions = 1024
+
+// ErrTooManyTerms is returned when a pattern matches more terms than allowed
+var ErrTooManyTerms = errors.New("too many terms")
+
+// Matcher matches dictionary terms against a pattern
+type Matcher interface {
+	// Match reports whether term matches, and how many edits it is away from
+	// the pattern, which is zero unless the pattern is fuzzy
+	Match(term string) (int, bool)
+	// LiteralPrefix returns the text every matching term starts with, so a
+	// sorted dictionary can stop once past it
+	LiteralPrefix() string
+	String() string
+}
+
+// IsPattern reports whether term is a prefix, wildcard, regular expression
+// or fuzzy term, which match the indexed terms they expand to rather than
+// being analyzed
+func IsPattern(term *query.QueryTerm) bool {
+	switch term.Type {
+	case query.TypePrefix, query.TypeWildcard, query.TypeRegexp, query.TypeFuzzy:
+		return true
+	}
+	return false
+}
+
+// ForTerm returns the matcher of a pattern term. Patterns other than
+// regular expressions are lowercased, as analyzers lowercase indexed terms
+func ForTerm(term *query.QueryTerm) (Matcher, error) {
+	switch term.Type {
+	case query.TypeWildcard:
+		return NewWildcard(strings.ToLower(term.Text)), nil
+	case query.TypeRegexp:
+		return NewRegexp(term.Text)
+	case query.TypeFuzzy:
+		return NewFuzzy(strings.ToLower(term.Text), term.Fuzziness), nil
+	case query.TypePrefix:
+		return Prefix(strings.ToLower(term.Text)), nil
+	}
+	return nil, fmt.Errorf("%s is not a pattern", term)
+}
+
+// Prefix matches the terms starting with a text
+type Prefix string
+
+func (p Prefix) Match(term string) (int, bool) {
+	return 0, strings.HasPrefix(term, string(p))
+}
+
+func (p Prefix) LiteralPrefix() string {
+	return string(p)
+}
+
+func (p Prefix) String() string {
+	return string(p) + "*"
+}
+
+// Regexp matches the terms a regular expression matches as a whole
+type Regexp struct {
+	re      *regexp.Regexp
+	pattern string
+	prefix  string
+}
+
+// NewRegexp compiles a regular expression in the syntax of package regexp.
+// It has to match a whole term, as if enclosed in ^ and $
+func NewRegexp(pattern string) (*Regexp, error) {
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	prefix, _ := re.LiteralPrefix()
+	return &Regexp{re: re, pattern: "/" + pattern + "/", prefix: prefix}, nil
+}
+
+// NewWildcard compiles a wildcard pattern, in which '*' stands for any
+// number of characters and '?' for exactly one. A backslash makes the
+// character after it literal
+func NewWildcard(pattern string) *Regexp {
+	var b strings.Builder
+	literal := func(s string) {
+		b.WriteString(regexp.QuoteMeta(s))
+	}
+	for i := 0; i < len(pattern); {
+		r, size := utf8.DecodeRuneInString(pattern[i:])
+		switch {
+		case r == '\\' && i+size < len(pattern):
+			next, nextSize := utf8.DecodeRuneInString(pattern[i+size:])
+			literal(string(next))
+			i += size + nextSize
+			continue
+		case r == '*':
+			b.WriteString(`.*`)
+		case r == '?':
+			b.WriteString(`.`)
+		default:
+			literal(string(r))
+		}
+		i += size
+	}
+
+	// Quoted text always compiles
+	re := regexp.MustCompile(`^(?s:` + b.String() + `)$`)
+	prefix, _ := re.LiteralPrefix()
+	return &Regexp{re: re, pattern: pattern, prefix: prefix}
+}
+
+func (r *Regexp) Match(term string) (int, bool) {
+	return 0, r.re.MatchString(term)
+}
+
+func (r *Regexp) LiteralPrefix() string {
+	return r.prefix
+}
+
+func (r *Regexp) String() string {
+	return r.pattern
+}
+
+// Fuzzy matches the terms within a number of edits of a text, an edit being
+// the insertion, deletion or substitution of a character, or the
+// transposition of two adjacent ones
+type Fuzzy struct {
+	text      []rune
+	fuzziness int
+}
+
+// NewFuzzy matches the terms at most fuzziness edits away from text
+func NewFuzzy(text string, fuzziness int) *Fuzzy {
+	return &Fuzzy{text: []rune(text), fuzziness: fuzziness}
+}
+
+func (f *Fuzzy) Match(term string) (int, bool) {
+	distance := Distance(f.text, []rune(term), f.fuzziness)
+	return distance, distance <= f.fuzziness
+}
+
+func (f *Fuzzy) LiteralPrefix() string {
+	return ""
+}
+
+func (f *Fuzzy) String() string {
+	return fmt.Sprintf("%s~%d", string(f.text), f.fuzziness)
+}
+
+// Distance returns the number of edits turning a into b, counting the
+// transposition of adjacent characters as one edit (the optimal string
+// alignment distance). Distances above limit are reported as limit+1, which
+// allows skipping terms whose length alone rules them out
+func Distance(a, b []rune, limit int) int {
+	if diff := len(a) - len(b); diff > limit || -diff > limit {
+		return limit + 1
+	}
+
+	// Three rows of the edit matrix: two back, previous and current
+	before := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		lowest := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], before[j-2]+1)
+			}
+			lowest = min(lowest, cur[j])
+		}
+		if lowest > limit {
+			return limit + 1
+		}
+		before, prev, cur = prev, cur, before
+	}
+	return min(prev[len(b)], limit+1)
+}
+
+// Term is a dictionary term matching a pattern
+type Term struct {
+	Text     string
+	Distance int // Edits away from the pattern
+}
+
+// Collector gathers the terms of a dictionary matching a pattern, up to a
+// limit. Feed it the terms in order through Visit until it returns false,
+// then read the result with Terms
+type Collector struct {
+	matcher Matcher
+	limit   int
+	prefix  string
+	terms   []Term
+	err     error
+}
+
+// NewCollector collects the terms matching m, failing with ErrTooManyTerms
+// past limit of them. A limit of zero or less is DefaultMaxExpansions
+func NewCollector(m Matcher, limit int) *Collector {
+	if limit <= 0 {
+		limit = DefaultMaxExpansions
+	}
+	return &Collector{matcher: m, limit: limit, prefix: m.LiteralPrefix()}
+}
+
+// Visit checks the next term of the dictionary, reporting whether later
+// terms may still match
+func (c *Collector) Visit(term string) bool {
+	if !strings.HasPrefix(term, c.prefix) {
+		// Terms are visited in order, so none after one sorting past the
+		// prefix can start with it
+		return term < c.prefix
+	}
+	distance, ok := c.matcher.Match(term)
+	if !ok {
+		return true
+	}
+	if len(c.terms) == c.limit {
+		c.err = fmt.Errorf("%w: %s matches more than %d terms", ErrTooManyTerms, c.matcher, c.limit)
+		return false
+	}
+	c.terms = append(c.terms, Term{Text: term, Distance: distance})
+	return true
+}
+
+// Terms returns the matching terms in order, or ErrTooManyTerms when there
+// were more than the limit
+func (c *Collector) Terms() ([]Term, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.terms, nil
+}
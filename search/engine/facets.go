@@ -0,0 +1,277 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	blevequery "github.com/blevesearch/bleve/v2/search/query"
+)
+
+// FacetType selects how a facet groups the matching documents
+type FacetType string
+
+const (
+	FacetTerms        FacetType = "terms"         // Most frequent values of a keyword field
+	FacetDateRange    FacetType = "date_range"    // Named age buckets of a date field
+	FacetNumericRange FacetType = "numeric_range" // Named buckets of a numeric field
+)
+
+const (
+	defaultFacetSize = 10
+	day              = 24 * time.Hour
+)
+
+// ErrInvalidFilter is returned when a filter selects a value its facet
+// does not have
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// FacetConfig describes a facet computed over the documents matching a search.
+// Its name is also the key under which a selected value is passed back in
+// SearchOptions.Filters
+type FacetConfig struct {
+	Name          string
+	Field         string
+	Type          FacetType
+	Size          int // Values returned by a terms facet, 0 for the default
+	DateRanges    []DateRange
+	NumericRanges []NumericRange
+}
+
+// DateRange is a bucket of documents whose date lies between MinAge and
+// MaxAge before the time of the search. A zero MaxAge leaves the bucket open
+// into the past
+type DateRange struct {
+	Name   string
+	MinAge time.Duration
+	MaxAge time.Duration
+}
+
+// NumericRange is a bucket of values from Min, inclusive, up to Max,
+// exclusive. A nil bound leaves that side open
+type NumericRange struct {
+	Name string
+	Min  *float64
+	Max  *float64
+}
+
+// dateBuckets are the age buckets of the default date facets. Apart from
+// "older" they are cumulative, the way search engines usually offer them
+var dateBuckets = []DateRange{
+	{Name: "past_day", MaxAge: day},
+	{Name: "past_week", MaxAge: 7 * day},
+	{Name: "past_month", MaxAge: 30 * day},
+	{Name: "past_year", MaxAge: 365 * day},
+	{Name: "older", MinAge: 365 * day},
+}
+
+// DefaultFacets returns the facets offered for crawled pages
+func DefaultFacets() []FacetConfig {
+	kb := func(n float64) *float64 {
+		n *= 1024
+		return &n
+	}
+
+	return []FacetConfig{
+		{Name: "host", Field: "host", Type: FacetTerms},
+		{Name: "type", Field: "type", Type: FacetTerms},
+		{Name: "language", Field: "language", Type: FacetTerms},
+		{Name: "content_type", Field: "content_type", Type: FacetTerms},
+		{Name: "job", Field: "job", Type: FacetTerms},
+		{Name: "schema_type", Field: "schema_types", Type: FacetTerms},
+		{Name: "created", Field: "created_at", Type: FacetDateRange, DateRanges: dateBuckets},
+		{Name: "last_modified", Field: "modified_at", Type: FacetDateRange, DateRanges: dateBuckets},
+		{Name: "published", Field: "published_at", Type: FacetDateRange, DateRanges: dateBuckets},
+		{Name: "content_length", Field: "content_length", Type: FacetNumericRange, NumericRanges: []NumericRange{
+			{Name: "under_1kb", Max: kb(1)},
+			{Name: "1kb_10kb", Min: kb(1), Max: kb(10)},
+			{Name: "10kb_100kb", Min: kb(10), Max: kb(100)},
+			{Name: "over_100kb", Min: kb(100)},
+		}},
+	}
+}
+
+// LookupFacets returns the default facets with the given names, or all of
+// them for "all"
+func LookupFacets(names []string) ([]FacetConfig, error) {
+	defaults := DefaultFacets()
+
+	var facets []FacetConfig
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			return defaults, nil
+		}
+
+		facet, ok := findFacet(defaults, name)
+		if !ok {
+			available := make([]string, 0, len(defaults))
+			for _, facet := range defaults {
+				available = append(available, facet.Name)
+			}
+			return nil, fmt.Errorf("unknown facet %q (available: all, %s)", name, strings.Join(available, ", "))
+		}
+		facets = append(facets, facet)
+	}
+	return facets, nil
+}
+
+func findFacet(facets []FacetConfig, name string) (FacetConfig, bool) {
+	for _, facet := range facets {
+		if facet.Name == name {
+			return facet, true
+		}
+	}
+	return FacetConfig{}, false
+}
+
+// request builds the bleve facet request, resolving date buckets against now
+func (c FacetConfig) request(now time.Time) *bleve.FacetRequest {
+	size := c.Size
+	if size <= 0 {
+		size = defaultFacetSize
+	}
+
+	switch c.Type {
+	case FacetDateRange:
+		req := bleve.NewFacetRequest(c.Field, len(c.DateRanges))
+		for _, r := range c.DateRanges {
+			start, end := r.bounds(now)
+			req.AddDateTimeRange(r.Name, start, end)
+		}
+		return req
+	case FacetNumericRange:
+		req := bleve.NewFacetRequest(c.Field, len(c.NumericRanges))
+		for _, r := range c.NumericRanges {
+			req.AddNumericRange(r.Name, r.Min, r.Max)
+		}
+		return req
+	default:
+		return bleve.NewFacetRequest(c.Field, size)
+	}
+}
+
+// bounds returns the bucket's time span, zero times for open sides
+func (r DateRange) bounds(now time.Time) (start, end time.Time) {
+	if r.MaxAge > 0 {
+		start = now.Add(-r.MaxAge)
+	}
+	if r.MinAge > 0 {
+		end = now.Add(-r.MinAge)
+	}
+	return start, end
+}
+
+// results converts a bleve facet result. Range buckets keep their configured
+// order and are reported even when empty, so clients can render them stably
+func (c FacetConfig) results(result *search.FacetResult) []Facet {
+	switch c.Type {
+	case FacetDateRange:
+		counts := make(map[string]int, len(result.DateRanges))
+		for _, r := range result.DateRanges {
+			counts[r.Name] = r.Count
+		}
+		facets := make([]Facet, 0, len(c.DateRanges))
+		for _, r := range c.DateRanges {
+			facets = append(facets, Facet{Value: r.Name, Count: int64(counts[r.Name])})
+		}
+		return facets
+	case FacetNumericRange:
+		counts := make(map[string]int, len(result.NumericRanges))
+		for _, r := range result.NumericRanges {
+			counts[r.Name] = r.Count
+		}
+		facets := make([]Facet, 0, len(c.NumericRanges))
+		for _, r := range c.NumericRanges {
+			facets = append(facets, Facet{Value: r.Name, Count: int64(counts[r.Name])})
+		}
+		return facets
+	default:
+		facets := make([]Facet, 0)
+		if result.Terms != nil {
+			for _, term := range result.Terms.Terms() {
+				facets = append(facets, Facet{Value: term.Term, Count: int64(term.Count)})
+			}
+		}
+		sort.SliceStable(facets, func(i, j int) bool {
+			return facets[i].Count > facets[j].Count
+		})
+		return facets
+	}
+}
+
+// filter builds the query selecting documents in the chosen facet values.
+// Several values select documents in any of them
+func (c FacetConfig) filter(value interface{}, now time.Time) (blevequery.Query, error) {
+	values := filterValues(value)
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: no value for %s", ErrInvalidFilter, c.Name)
+	}
+
+	queries := make([]blevequery.Query, 0, len(values))
+	for _, v := range values {
+		q, err := c.valueFilter(v, now)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+
+	if len(queries) == 1 {
+		return queries[0], nil
+	}
+	return bleve.NewDisjunctionQuery(queries...), nil
+}
+
+func (c FacetConfig) valueFilter(value string, now time.Time) (blevequery.Query, error) {
+	switch c.Type {
+	case FacetDateRange:
+		for _, r := range c.DateRanges {
+			if r.Name == value {
+				start, end := r.bounds(now)
+				q := bleve.NewDateRangeQuery(start, end)
+				q.SetField(c.Field)
+				return q, nil
+			}
+		}
+	case FacetNumericRange:
+		for _, r := range c.NumericRanges {
+			if r.Name == value {
+				q := bleve.NewNumericRangeQuery(r.Min, r.Max)
+				q.SetField(c.Field)
+				return q, nil
+			}
+		}
+	default:
+		q := bleve.NewTermQuery(value)
+		q.SetField(c.Field)
+		return q, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s has no bucket %q", ErrInvalidFilter, c.Name, value)
+}
+
+// filterValues accepts a single value or a list of them
+func filterValues(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case nil:
+		return nil
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,546 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	blevequery "github.com/blevesearch/bleve/v2/search/query"
+	"github.com/jonesrussell/goprowl/search/engine/language"
+	"github.com/jonesrussell/goprowl/search/engine/query"
+	blevestorage "github.com/jonesrussell/goprowl/search/storage/bleve"
+)
+
+// FilterType selects which documents a Filter matches
+type FilterType string
+
+const (
+	FilterTerm         FilterType = "term"          // Documents whose field has the value
+	FilterTerms        FilterType = "terms"         // Documents whose field has any of the values
+	FilterPrefix       FilterType = "prefix"        // Documents whose field starts with any of the values
+	FilterNumericRange FilterType = "numeric_range" // Documents whose number lies between Min and Max
+	FilterDateRange    FilterType = "date_range"    // Documents whose date lies between Min and Max
+	FilterExists       FilterType = "exists"        // Documents with a value for the field
+	FilterMissing      FilterType = "missing"       // Documents without a value for the field
+	FilterAnd          FilterType = "and"           // Documents matching every one of Filters
+	FilterOr           FilterType = "or"            // Documents matching any of Filters
+	FilterNot          FilterType = "not"           // Documents matching none of Filters
+)
+
+// Filter restricts search results to the documents it matches without
+// affecting their scores. Filters are evaluated by the index, as part of
+// the search
+type Filter struct {
+	Type  FilterType `json:"type"`
+	Field string     `json:"field,omitempty"`
+	// Values holds the value of a term filter, the values of a terms
+	// filter and the prefixes of a prefix filter
+	Values []string `json:"values,omitempty"`
+	// Min and Max bound range filters, inclusively unless excluded, and an
+	// empty bound leaves that side open. Date bounds are RFC 3339 times,
+	// dates such as 2026-01-01, or times relative to the search such as
+	// now-7d
+	Min        string `json:"min,omitempty"`
+	Max        string `json:"max,omitempty"`
+	ExcludeMin bool   `json:"exclude_min,omitempty"`
+	ExcludeMax bool   `json:"exclude_max,omitempty"`
+	// Filters are combined by and, or and not filters
+	Filters []*Filter `json:"filters,omitempty"`
+}
+
+// filterAliases maps short names filters may use to the fields they filter
+var filterAliases = map[string]string{
+	"lang":          language.Field,
+	"created":       "created_at",
+	"modified":      "modified_at",
+	"last_modified": "modified_at",
+	"published":     "published_at",
+	"size":          "content_length",
+}
+
+// dateFields are the fields that ranges compare as dates whatever their
+// bounds look like
+var dateFields = map[string]bool{
+	"created_at":   true,
+	"modified_at":  true,
+	"published_at": true,
+}
+
+// filterTermFields are the fields that required terms at the top level of a
+// query filter on rather than score, as in "golang +host:go.dev"
+var filterTermFields = map[string]bool{
+	"host":         true,
+	"type":         true,
+	"content_type": true,
+	"job":          true,
+	"schema_types": true,
+	"url_variants": true,
+	ClusterField:   true,
+}
+
+// filterField resolves the field a filter names
+func filterField(field string) string {
+	field = strings.ToLower(strings.TrimSpace(field))
+	if alias, ok := filterAliases[field]; ok {
+		return alias
+	}
+	return field
+}
+
+// allFilters combines filters into one matching the documents all of them
+// match, nil when there are none
+func allFilters(filters ...*Filter) *Filter {
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	}
+	return &Filter{Type: FilterAnd, Filters: filters}
+}
+
+// ParseFilter parses a filter expression in the query syntax, such as
+// "created:>now-7d size:[1000 TO 50000] -type:pdf". Every term names its
+// field, and clauses without an operator between them all have to match.
+// Field terms are term filters, or prefix filters with a trailing '*'
+func ParseFilter(expr string) (*Filter, error) {
+	processor := query.NewQueryProcessor()
+	processor.DefaultOperator = query.OpAnd
+	root, err := processor.ParseQuery(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+	}
+	if root == nil {
+		return nil, nil
+	}
+	return nodeFilter(root)
+}
+
+// nodeFilter converts a parsed filter expression
+func nodeFilter(node query.Node) (*Filter, error) {
+	switch n := node.(type) {
+	case *QueryTerm:
+		if n.Field == "" {
+			return nil, fmt.Errorf("%w: %s names no field", ErrInvalidFilter, n)
+		}
+		return termFilter(n), nil
+	case *query.RequiredNode:
+		return nodeFilter(n.Child)
+	case *query.NotNode:
+		child, err := nodeFilter(n.Child)
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Type: FilterNot, Filters: []*Filter{child}}, nil
+	case *query.BooleanNode:
+		var must, should, mustNot []*Filter
+		for _, clause := range n.Clauses {
+			target := &must
+			switch c := clause.(type) {
+			case *query.NotNode:
+				target, clause = &mustNot, c.Child
+			case *query.RequiredNode:
+				clause = c.Child
+			default:
+				if n.Op == query.OpOr {
+					target = &should
+				}
+			}
+			filter, err := nodeFilter(clause)
+			if err != nil {
+				return nil, err
+			}
+			*target = append(*target, filter)
+		}
+
+		if len(should) > 0 {
+			must = append(must, &Filter{Type: FilterOr, Filters: should})
+		}
+		if len(mustNot) > 0 {
+			must = append(must, &Filter{Type: FilterNot, Filters: mustNot})
+		}
+		return allFilters(must...), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported expression %s", ErrInvalidFilter, node)
+}
+
+// termFilter converts a field term of a query: ranges become numeric or
+// date range filters, or exists filters when open on both sides, prefixes
+// prefix filters and other terms term filters
+func termFilter(term *QueryTerm) *Filter {
+	field := filterField(term.Field)
+	switch term.Type {
+	case query.TypeRange:
+		r := term.Range
+		if r.Min == "" && r.Max == "" {
+			return &Filter{Type: FilterExists, Field: field}
+		}
+		filter := &Filter{
+			Type:       FilterNumericRange,
+			Field:      field,
+			Min:        r.Min,
+			Max:        r.Max,
+			ExcludeMin: r.Min != "" && !r.MinInclusive,
+			ExcludeMax: r.Max != "" && !r.MaxInclusive,
+		}
+		if dateFields[field] || !isNumber(r.Min) || !isNumber(r.Max) {
+			filter.Type = FilterDateRange
+		}
+		return filter
+	case query.TypePrefix:
+		return &Filter{Type: FilterPrefix, Field: field, Values: []string{term.Text}}
+	}
+	return &Filter{Type: FilterTerm, Field: field, Values: []string{term.Text}}
+}
+
+// isNumber reports whether a range bound is a number or open
+func isNumber(bound string) bool {
+	if bound == "" {
+		return true
+	}
+	_, err := strconv.ParseFloat(bound, 64)
+	return err == nil
+}
+
+// isFilterTerm reports whether a term at the top level of a query filters
+// the results: ranges, terms on filterTermFields and URL prefixes, as in
+// url:https://go.dev/doc/*. Other URL terms match words of the URL, and
+// wildcard, regular expression and fuzzy terms match as query terms
+func isFilterTerm(term *QueryTerm) bool {
+	field := filterField(term.Field)
+	switch {
+	case field == "":
+		return false
+	case term.Type == query.TypeWildcard || term.Type == query.TypeRegexp || term.Type == query.TypeFuzzy:
+		return false
+	case term.Type == query.TypeRange:
+		return true
+	case field == "url":
+		return term.Type == query.TypePrefix
+	}
+	return filterTermFields[field]
+}
+
+// fieldFilters takes the filter terms that every result has to match, or
+// none may, off the top level of a query tree, returning the rest of the
+// tree and the filters they make. Like language terms, those are the terms
+// joined by AND or required with +, and negated terms whatever the
+// operator: each makes a filter of its own, all of which have to match, and
+// negated terms exclude their documents. An OR made only of filter terms is
+// one filter matching any of them, the values given for a field merged.
+// Other optional terms of an OR, and terms nested deeper, match like any
+// other term
+func fieldFilters(root query.Node) (query.Node, []*Filter) {
+	if filter := anyFilter(root); filter != nil {
+		return nil, []*Filter{filter}
+	}
+
+	var filters []*Filter
+	take := func(n query.Node, all bool) bool {
+		negated := false
+		switch c := n.(type) {
+		case *query.RequiredNode:
+			n, all = c.Child, true
+		case *query.NotNode:
+			n, negated, all = c.Child, true, true
+		}
+		term, ok := n.(*QueryTerm)
+		if !ok || !all || !isFilterTerm(term) {
+			return false
+		}
+
+		filter := termFilter(term)
+		if negated {
+			filter = &Filter{Type: FilterNot, Filters: []*Filter{filter}}
+		}
+		filters = append(filters, filter)
+		return true
+	}
+
+	switch n := root.(type) {
+	case *query.BooleanNode:
+		clauses := make([]query.Node, 0, len(n.Clauses))
+		for _, clause := range n.Clauses {
+			if !take(clause, n.Op == query.OpAnd) {
+				clauses = append(clauses, clause)
+			}
+		}
+		switch len(clauses) {
+		case 0:
+			return nil, filters
+		case 1:
+			return clauses[0], filters
+		}
+		return &query.BooleanNode{Op: n.Op, Clauses: clauses}, filters
+	default:
+		if root != nil && take(root, true) {
+			return nil, filters
+		}
+	}
+	return root, filters
+}
+
+// anyFilter returns the filter matching any clause of an OR whose clauses
+// are all optional filter terms, as in "host:go.dev OR host:pkg.go.dev",
+// and nil for other trees. Term and prefix filters on the same field are
+// merged into one with all their values
+func anyFilter(root query.Node) *Filter {
+	n, ok := root.(*query.BooleanNode)
+	if !ok || n.Op != query.OpOr {
+		return nil
+	}
+
+	var filters []*Filter
+	sets := make(map[string]*Filter) // Term and prefix filters by type and field
+	for _, clause := range n.Clauses {
+		term, ok := clause.(*QueryTerm)
+		if !ok || !isFilterTerm(term) {
+			return nil
+		}
+
+		filter := termFilter(term)
+		if filter.Type != FilterTerm && filter.Type != FilterPrefix {
+			filters = append(filters, filter)
+			continue
+		}
+		key := string(filter.Type) + ":" + filter.Field
+		if set, ok := sets[key]; ok {
+			set.Values = append(set.Values, filter.Values...)
+			if set.Type == FilterTerm {
+				set.Type = FilterTerms
+			}
+			continue
+		}
+		sets[key] = filter
+		filters = append(filters, filter)
+	}
+
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return &Filter{Type: FilterOr, Filters: filters}
+}
+
+// query builds the bleve query matching the documents the filter allows,
+// resolving relative dates against now
+func (f *Filter) query(now time.Time) (blevequery.Query, error) {
+	switch f.Type {
+	case FilterAnd, FilterOr, FilterNot:
+		if len(f.Filters) == 0 {
+			return nil, fmt.Errorf("%w: %s filter without filters", ErrInvalidFilter, f.Type)
+		}
+		queries := make([]blevequery.Query, 0, len(f.Filters))
+		for _, filter := range f.Filters {
+			if filter == nil {
+				return nil, fmt.Errorf("%w: empty filter in %s filter", ErrInvalidFilter, f.Type)
+			}
+			q, err := filter.query(now)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, q)
+		}
+		switch f.Type {
+		case FilterAnd:
+			return bleve.NewConjunctionQuery(queries...), nil
+		case FilterOr:
+			return bleve.NewDisjunctionQuery(queries...), nil
+		}
+		return notQuery(queries...), nil
+	}
+
+	field := filterField(f.Field)
+	if field == "" {
+		return nil, fmt.Errorf("%w: %s filter without a field", ErrInvalidFilter, f.Type)
+	}
+
+	switch f.Type {
+	case FilterTerm, FilterTerms, FilterPrefix:
+		if len(f.Values) == 0 || (f.Type == FilterTerm && len(f.Values) > 1) {
+			return nil, fmt.Errorf("%w: %s filter on %s with %d values", ErrInvalidFilter, f.Type, field, len(f.Values))
+		}
+		queries := make([]blevequery.Query, len(f.Values))
+		for i, value := range f.Values {
+			if f.Type == FilterPrefix {
+				queries[i] = prefixQuery(field, value)
+			} else {
+				queries[i] = termQuery(field, value)
+			}
+		}
+		if len(queries) == 1 {
+			return queries[0], nil
+		}
+		return bleve.NewDisjunctionQuery(queries...), nil
+	case FilterNumericRange:
+		min, err := parseNumber(f.Min)
+		if err != nil {
+			return nil, err
+		}
+		max, err := parseNumber(f.Max)
+		if err != nil {
+			return nil, err
+		}
+		if min == nil && max == nil {
+			return nil, fmt.Errorf("%w: range on %s without bounds", ErrInvalidFilter, field)
+		}
+		minInclusive, maxInclusive := !f.ExcludeMin, !f.ExcludeMax
+		q := bleve.NewNumericRangeInclusiveQuery(min, max, &minInclusive, &maxInclusive)
+		q.SetField(field)
+		return q, nil
+	case FilterDateRange:
+		start, err := rangeDate(field, f.Min, now)
+		if err != nil {
+			return nil, err
+		}
+		end, err := rangeDate(field, f.Max, now)
+		if err != nil {
+			return nil, err
+		}
+		if start.IsZero() && end.IsZero() {
+			return nil, fmt.Errorf("%w: range on %s without bounds", ErrInvalidFilter, field)
+		}
+		minInclusive, maxInclusive := !f.ExcludeMin, !f.ExcludeMax
+		q := bleve.NewDateRangeInclusiveQuery(start, end, &minInclusive, &maxInclusive)
+		q.SetField(field)
+		return q, nil
+	case FilterExists:
+		return existsQuery(field), nil
+	case FilterMissing:
+		return notQuery(existsQuery(field)), nil
+	}
+	return nil, fmt.Errorf("%w: unknown filter type %q", ErrInvalidFilter, f.Type)
+}
+
+// termQuery matches a value of field. Titles and URLs match their whole
+// value, regardless of case, the language its code, and other fields
+// every term of the value as the field is analyzed
+func termQuery(field, value string) blevequery.Query {
+	if language.IsSorted(field) {
+		q := bleve.NewTermQuery(strings.ToLower(value))
+		q.SetField(language.SortField(field))
+		return q
+	}
+	if field == language.Field {
+		value = strings.ToLower(value)
+	}
+	q := bleve.NewMatchQuery(value)
+	q.SetField(field)
+	q.SetOperator(blevequery.MatchQueryOperatorAnd)
+	return q
+}
+
+// prefixQuery matches a field starting with prefix, titles and URLs
+// regardless of case
+func prefixQuery(field, prefix string) blevequery.Query {
+	if language.IsSorted(field) {
+		field, prefix = language.SortField(field), strings.ToLower(prefix)
+	}
+	q := bleve.NewPrefixQuery(prefix)
+	q.SetField(field)
+	return q
+}
+
+// existsQuery matches the documents with a value for field, which the
+// index lists under its presence field
+func existsQuery(field string) blevequery.Query {
+	q := bleve.NewTermQuery(field)
+	q.SetField(blevestorage.PresenceField)
+	return q
+}
+
+// notQuery matches the documents matching none of queries
+func notQuery(queries ...blevequery.Query) blevequery.Query {
+	return blevequery.NewBooleanQuery([]blevequery.Query{bleve.NewMatchAllQuery()}, nil, queries)
+}
+
+// parseNumber parses a numeric range bound, nil when open
+func parseNumber(bound string) (*float64, error) {
+	if bound == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(bound), 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not a number", ErrInvalidFilter, bound)
+	}
+	return &n, nil
+}
+
+// rangeDate parses a date range bound on field. Ranges on fields other than
+// dateFields are date ranges when their bounds are not numbers, so a bound
+// that is not a date either is reported as such
+func rangeDate(field, bound string, now time.Time) (time.Time, error) {
+	t, err := parseDate(bound, now)
+	if err != nil && !dateFields[field] {
+		return time.Time{}, fmt.Errorf("%w: %s is not a date or number field, its range bounds have to be numbers or dates and %q is neither", ErrInvalidFilter, field, bound)
+	}
+	return t, err
+}
+
+// dateLayouts are the absolute forms date range bounds may take
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseDate parses a date range bound, the zero time when open. A bound is
+// an absolute date or "now" followed by any number of offsets, as in
+// now-7d or now-1M+12h, counted in s(econds), m(inutes), h(ours), d(ays),
+// w(eeks), M(onths) or y(ears)
+func parseDate(bound string, now time.Time) (time.Time, error) {
+	bound = strings.TrimSpace(bound)
+	if bound == "" {
+		return time.Time{}, nil
+	}
+
+	offsets, ok := strings.CutPrefix(bound, "now")
+	if !ok {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, bound); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("%w: %q is not a date (want 2026-01-31, an RFC 3339 time or now-7d)", ErrInvalidFilter, bound)
+	}
+
+	t := now
+	for offsets != "" {
+		sign := 1
+		switch offsets[0] {
+		case '+':
+		case '-':
+			sign = -1
+		default:
+			return time.Time{}, fmt.Errorf("%w: invalid offset %q in %q", ErrInvalidFilter, offsets, bound)
+		}
+
+		digits := 1
+		for digits < len(offsets) && offsets[digits] >= '0' && offsets[digits] <= '9' {
+			digits++
+		}
+		n, err := strconv.Atoi(offsets[1:digits])
+		if err != nil || digits == len(offsets) {
+			return time.Time{}, fmt.Errorf("%w: invalid offset %q in %q", ErrInvalidFilter, offsets, bound)
+		}
+		n *= sign
+
+		switch offsets[digits] {
+		case 's':
+			t = t.Add(time.Duration(n) * time.Second)
+		case 'm':
+			t = t.Add(time.Duration(n) * time.Minute)
+		case 'h':
+			t = t.Add(time.Duration(n) * time.Hour)
+		case 'd':
+			t = t.AddDate(0, 0, n)
+		case 'w':
+			t = t.AddDate(0, 0, 7*n)
+		case 'M':
+			t = t.AddDate(0, n, 0)
+		case 'y':
+			t = t.AddDate(n, 0, 0)
+		default:
+			return time.Time{}, fmt.Errorf("%w: unknown unit %q in %q", ErrInvalidFilter, offsets[digits], bound)
+		}
+		offsets = offsets[digits+1:]
+	}
+	return t, nil
+}
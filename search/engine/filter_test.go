@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestQueryFilters(t *testing.T) {
+	e := newTestEngine(t)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Required and AND-ed terms on one field all have to match
+		{"+schema_types:Article +schema_types:NewsArticle", []string{news}},
+		{"schema_types:Article AND schema_types:NewsArticle", []string{news}},
+		{"+schema_types:NewsArticle +schema_types:Product", []string{}},
+		// An OR of filter terms matches any of them
+		{"schema_types:NewsArticle OR schema_types:Product", []string{news, produit}},
+		{"host:b.example.com OR schema_types:NewsArticle", []string{news, produit}},
+		// Negated terms exclude their documents whatever the operator
+		{"crawler -schema_types:NewsArticle", []string{article}},
+		{"* -host:a.example.com", []string{produit}},
+		// Dates relative to now
+		{"+created:>=now-7d", []string{article, produit}},
+		{"+created:<now-7d", []string{news}},
+		{"crawler AND created:[now-7d TO now]", []string{article}},
+		// Existence
+		{"author:*", []string{article}},
+		{"* -author:*", []string{news, produit}},
+		{"+author:[* TO *]", []string{article}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := searchURLs(t, e, tt.query); !equalStrings(got, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryFilterErrors(t *testing.T) {
+	e := newTestEngine(t)
+
+	for _, query := range []string{
+		"+title:[a TO m]",
+		"+created:>yesterday",
+	} {
+		t.Run(query, func(t *testing.T) {
+			_, err := e.SearchWithOptions(context.Background(), SearchOptions{Query: query})
+			if !errors.Is(err, ErrInvalidFilter) {
+				t.Fatalf("search %q error = %v, want ErrInvalidFilter", query, err)
+			}
+		})
+	}
+}
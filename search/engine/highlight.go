@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/jonesrussell/goprowl/search/engine/highlight"
+	"github.com/jonesrussell/goprowl/search/engine/language"
+)
+
+// highlightFields are the stored text fields snippets are generated from
+var highlightFields = []string{"title", "content"}
+
+// snippetFallbacks are the fields describing a page, in order of
+// preference, whose text is the snippet when no match was found in the content
+var snippetFallbacks = []string{"description", "og_description", "twitter_description"}
+
+// highlightResult adds highlighted fragments and a content snippet to a
+// result, using the term locations the index reported for the hit. When
+// nothing matched in the content, the page's description is the snippet
+func highlightResult(result *SearchResult, locations search.FieldTermLocationMap, opts *HighlightOptions) {
+	formatter := opts.Formatter
+	if formatter == nil {
+		formatter = highlight.NoneFormatter{}
+	}
+	fragmentOpts := highlight.Options{
+		FragmentSize: opts.FragmentSize,
+		MaxFragments: opts.MaxFragments,
+	}
+
+	result.Highlights = make(map[string][]string)
+	for _, field := range highlightFields {
+		text, _ := result.Content[field].(string)
+		spans := matchSpans(locations, field)
+
+		if field == "title" {
+			if text != "" && len(spans) > 0 {
+				result.Highlights[field] = []string{highlight.Highlight(text, spans, formatter)}
+			}
+			continue
+		}
+
+		if len(spans) == 0 {
+			if fallback, fallbackText, fallbackSpans := snippetFallback(result, locations); fallback != "" {
+				field, text, spans = fallback, fallbackText, fallbackSpans
+			}
+		}
+		if text == "" {
+			continue
+		}
+
+		if fragments := highlight.Fragments(text, spans, fragmentOpts, formatter); len(fragments) > 0 {
+			if len(spans) > 0 {
+				result.Highlights[field] = fragments
+			}
+			result.Content["snippet"] = strings.Join(fragments, " ")
+		}
+	}
+}
+
+// snippetFallback returns the field holding the page's description, its
+// text and the matches in it, preferring a description the query matched.
+// The field is "" when the page has no description
+func snippetFallback(result *SearchResult, locations search.FieldTermLocationMap) (string, string, []highlight.Span) {
+	var field, text string
+	for _, name := range snippetFallbacks {
+		value := stringValue(result.Metadata[name])
+		if value == "" {
+			continue
+		}
+		if spans := fieldSpans(locations[name]); len(spans) > 0 {
+			return name, value, spans
+		}
+		if field == "" {
+			field, text = name, value
+		}
+	}
+	return field, text, nil
+}
+
+// stringValue returns a stored field as a string, taking the first value of
+// a repeated field
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			s, _ := v[0].(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// matchSpans returns the byte spans of the matches in a text field, whether
+// they were matched as indexed for every document or for its language
+func matchSpans(locations search.FieldTermLocationMap, field string) []highlight.Span {
+	spans := fieldSpans(locations[field])
+	if language.IsAnalyzed(field) {
+		spans = append(spans, fieldSpans(locations[language.AnalyzedField(field)])...)
+	}
+	return spans
+}
+
+// fieldSpans converts the term locations of one field into byte spans
+func fieldSpans(terms search.TermLocationMap) []highlight.Span {
+	var spans []highlight.Span
+	for _, locations := range terms {
+		for _, location := range locations {
+			spans = append(spans, highlight.Span{
+				Start: int(location.Start),
+				End:   int(location.End),
+			})
+		}
+	}
+	return spans
+}
@@ -0,0 +1,95 @@
+package highlight
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// Formatter renders highlighted text for a particular output
+type Formatter interface {
+	// Text formats a run of text outside any match
+	Text(s string) string
+	// Match formats a matched term
+	Match(s string) string
+}
+
+// ANSIFormatter highlights matches with terminal escape codes
+type ANSIFormatter struct{}
+
+func (ANSIFormatter) Text(s string) string {
+	return s
+}
+
+func (ANSIFormatter) Match(s string) string {
+	return "\x1b[1;33m" + s + "\x1b[0m"
+}
+
+// HTMLFormatter wraps matches in <mark> tags and escapes the rest
+type HTMLFormatter struct{}
+
+func (HTMLFormatter) Text(s string) string {
+	return html.EscapeString(s)
+}
+
+func (HTMLFormatter) Match(s string) string {
+	return "<mark>" + html.EscapeString(s) + "</mark>"
+}
+
+// PlainFormatter surrounds matches with plain text markers, for consumers
+// such as JSON clients that render highlights themselves
+type PlainFormatter struct {
+	Pre  string
+	Post string
+}
+
+func (f PlainFormatter) Text(s string) string {
+	return s
+}
+
+func (f PlainFormatter) Match(s string) string {
+	return f.Pre + s + f.Post
+}
+
+// NoneFormatter leaves matches unmarked, producing bare snippets
+type NoneFormatter struct{}
+
+func (NoneFormatter) Text(s string) string {
+	return s
+}
+
+func (NoneFormatter) Match(s string) string {
+	return s
+}
+
+var formatters = map[string]Formatter{
+	"ansi":  ANSIFormatter{},
+	"html":  HTMLFormatter{},
+	"plain": PlainFormatter{Pre: "[[", Post: "]]"},
+	"none":  NoneFormatter{},
+}
+
+// Register makes a formatter available by name, replacing any existing one
+func Register(name string, formatter Formatter) {
+	formatters[name] = formatter
+}
+
+// Lookup returns the formatter registered under name
+func Lookup(name string) (Formatter, error) {
+	formatter, ok := formatters[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown highlight format %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return formatter, nil
+}
+
+// Names returns the registered formatter names in sorted order
+func Names() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
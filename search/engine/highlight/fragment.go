@@ -0,0 +1,242 @@
+package highlight
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultFragmentSize = 150
+	DefaultMaxFragments = 3
+
+	ellipsis = "…"
+)
+
+// Span is a matched region of a field's text, as byte offsets
+type Span struct {
+	Start int
+	End   int
+}
+
+// Options controls fragment selection
+type Options struct {
+	FragmentSize int // Approximate fragment length in bytes
+	MaxFragments int // Maximum number of fragments returned
+}
+
+func (o Options) withDefaults() Options {
+	if o.FragmentSize <= 0 {
+		o.FragmentSize = DefaultFragmentSize
+	}
+	if o.MaxFragments <= 0 {
+		o.MaxFragments = DefaultMaxFragments
+	}
+	return o
+}
+
+// Highlight formats the whole of text, marking every span
+func Highlight(text string, spans []Span, f Formatter) string {
+	spans = normalize(text, spans)
+	return strings.TrimSpace(render(text, 0, len(text), spans, f))
+}
+
+// candidate is a window of text around a run of consecutive spans
+type candidate struct {
+	first, last int // Span indexes covered
+	distinct    int // Number of distinct matched terms
+	start, end  int
+}
+
+// Fragments returns the best-matching fragments of text, best first. A
+// fragment covers as many distinct matched terms as fit in the configured
+// size and is cut at word boundaries. Without spans, the leading fragment of
+// the text is returned
+func Fragments(text string, spans []Span, opts Options, f Formatter) []string {
+	opts = opts.withDefaults()
+	spans = normalize(text, spans)
+
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	if len(spans) == 0 {
+		end := snapEnd(text, min(opts.FragmentSize, len(text)), 0)
+		return []string{fragment(text, 0, end, nil, f)}
+	}
+
+	candidates := make([]candidate, 0, len(spans))
+	for i := range spans {
+		j := i
+		for j+1 < len(spans) && spans[j+1].End-spans[i].Start <= opts.FragmentSize {
+			j++
+		}
+
+		terms := make(map[string]bool)
+		for _, span := range spans[i : j+1] {
+			terms[strings.ToLower(text[span.Start:span.End])] = true
+		}
+
+		start, end := window(text, spans[i].Start, spans[j].End, opts.FragmentSize)
+		candidates = append(candidates, candidate{
+			first:    i,
+			last:     j,
+			distinct: len(terms),
+			start:    start,
+			end:      end,
+		})
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		ca, cb := candidates[a], candidates[b]
+		if ca.distinct != cb.distinct {
+			return ca.distinct > cb.distinct
+		}
+		return ca.last-ca.first > cb.last-cb.first
+	})
+
+	var chosen []candidate
+	for _, c := range candidates {
+		if len(chosen) == opts.MaxFragments {
+			break
+		}
+		overlaps := false
+		for _, other := range chosen {
+			if c.start < other.end && other.start < c.end {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			chosen = append(chosen, c)
+		}
+	}
+
+	fragments := make([]string, 0, len(chosen))
+	for _, c := range chosen {
+		fragments = append(fragments, fragment(text, c.start, c.end, spans, f))
+	}
+	return fragments
+}
+
+// window centers a fragment of the given size on the matched region
+// [matchStart, matchEnd) and snaps it to word boundaries
+func window(text string, matchStart, matchEnd, size int) (int, int) {
+	pad := (size - (matchEnd - matchStart)) / 2
+	if pad < 0 {
+		pad = 0
+	}
+
+	start := max(0, matchStart-pad)
+	end := min(len(text), max(matchEnd, start+size))
+	if end == len(text) {
+		start = max(0, min(matchStart, end-size))
+	}
+
+	return snapStart(text, start, matchStart), snapEnd(text, end, matchEnd)
+}
+
+// snapStart moves start forward to the beginning of a word, without passing limit
+func snapStart(text string, start, limit int) int {
+	if start == 0 {
+		return 0
+	}
+	if i := strings.IndexFunc(text[start:limit], unicode.IsSpace); i >= 0 {
+		return start + i + 1
+	}
+	for start < limit && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return start
+}
+
+// snapEnd moves end back to the end of a word, without passing limit
+func snapEnd(text string, end, limit int) int {
+	if end >= len(text) {
+		return len(text)
+	}
+	if i := strings.LastIndexFunc(text[limit:end], unicode.IsSpace); i >= 0 {
+		return limit + i
+	}
+	for end > limit && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return end
+}
+
+// fragment renders text[start:end] with ellipses marking truncation
+func fragment(text string, start, end int, spans []Span, f Formatter) string {
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(ellipsis)
+	}
+	b.WriteString(strings.TrimSpace(render(text, start, end, spans, f)))
+	if end < len(text) {
+		b.WriteString(ellipsis)
+	}
+	return b.String()
+}
+
+// render formats text[start:end], marking the parts covered by spans
+func render(text string, start, end int, spans []Span, f Formatter) string {
+	var b strings.Builder
+	pos := start
+	for _, span := range spans {
+		if span.End <= start || span.Start >= end {
+			continue
+		}
+		spanStart, spanEnd := max(span.Start, start), min(span.End, end)
+		if spanStart > pos {
+			b.WriteString(f.Text(collapseSpace(text[pos:spanStart])))
+		}
+		b.WriteString(f.Match(collapseSpace(text[spanStart:spanEnd])))
+		pos = spanEnd
+	}
+	if pos < end {
+		b.WriteString(f.Text(collapseSpace(text[pos:end])))
+	}
+	return b.String()
+}
+
+// normalize clamps spans to text, drops empty ones and merges overlaps
+func normalize(text string, spans []Span) []Span {
+	valid := make([]Span, 0, len(spans))
+	for _, span := range spans {
+		span.Start, span.End = max(span.Start, 0), min(span.End, len(text))
+		if span.Start < span.End {
+			valid = append(valid, span)
+		}
+	}
+
+	sort.Slice(valid, func(i, j int) bool {
+		return valid[i].Start < valid[j].Start
+	})
+
+	merged := valid[:0]
+	for _, span := range valid {
+		if n := len(merged); n > 0 && span.Start <= merged[n-1].End {
+			merged[n-1].End = max(merged[n-1].End, span.End)
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// collapseSpace replaces each run of whitespace with a single space
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
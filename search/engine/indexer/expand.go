@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jonesrussell/goprowl/search/engine/expand"
+	"github.com/jonesrussell/goprowl/search/engine/query"
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
+)
+
+// scoreExpanded scores the documents holding terms of fields that a prefix,
+// wildcard, regular expression or fuzzy term matches. The terms it matches
+// are scored as one term, like synonyms, fuzzy matches counting for less the
+// more edits they are away. It fails with expand.ErrTooManyTerms when the
+// term matches more than the configured number of terms in a field. The
+// caller holds the read lock
+func (idx *InvertedIndex) scoreExpanded(fields []string, term *query.QueryTerm, explain bool) (*matches, error) {
+	m, err := expand.ForTerm(term)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newMatches(explain)
+	// map[documentID]field stats
+	docs := make(map[string][]ranking.FieldStats)
+	// the terms matched, for explanations
+	var names []string
+	for _, field := range fields {
+		expansions, err := idx.expandTerms(field, m)
+		if err != nil {
+			return nil, err
+		}
+
+		avgLength := idx.avgLength(field)
+		for _, expansion := range expansions {
+			if explain && !contains(names, expansion.Text) {
+				names = append(names, expansion.Text)
+			}
+			weight := 1 / float64(1+expansion.Distance)
+			for docID, posting := range idx.index[field][expansion.Text] {
+				docs[docID] = addFieldStats(docs[docID], ranking.FieldStats{
+					Field:     field,
+					Frequency: weight * float64(posting.Frequency()),
+					Length:    float64(idx.docLengths[docID][field]),
+					AvgLength: avgLength,
+				})
+				for _, offset := range posting.Offsets {
+					result.locate(docID, Location{Field: field, Offset: offset})
+				}
+			}
+		}
+	}
+
+	for docID, stats := range docs {
+		termStats := ranking.TermStats{
+			Fields:       stats,
+			DocsWithTerm: int64(len(docs)),
+			TotalDocs:    idx.documentCount,
+		}
+		result.add(docID, idx.scorer.Score(termStats))
+		if explain {
+			explanation := idx.scorer.Explain(termStats)
+			explanation.Description = fmt.Sprintf("term %s, matching %s, %s", m, strings.Join(quote(names), "|"), explanation.Description)
+			result.explainScore(docID, explanation)
+		}
+	}
+	return result, nil
+}
+
+// expandTerms returns the terms of field that m matches, in order. The caller
+// holds the read lock
+func (idx *InvertedIndex) expandTerms(field string, m expand.Matcher) ([]expand.Term, error) {
+	terms := make([]string, 0, len(idx.index[field]))
+	for term := range idx.index[field] {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	collector := expand.NewCollector(m, idx.maxExpansions)
+	for _, term := range terms {
+		if !collector.Visit(term) {
+			break
+		}
+	}
+	return collector.Terms()
+}
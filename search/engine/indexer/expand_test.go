@@ -0,0 +1,82 @@
+package indexer
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/jonesrussell/goprowl/search/engine/expand"
+)
+
+func newExpandIndex(maxExpansions int) *InvertedIndex {
+	idx := NewWithConfig(Config{MaxExpansions: maxExpansions})
+	idx.IndexFields("crawler", map[string]string{"title": "Crawler", "content": "a crawler crawls"})
+	idx.IndexFields("crawling", map[string]string{"title": "Crawling", "content": "crawling the web"})
+	idx.IndexFields("robot", map[string]string{"content": "a robot"})
+	return idx
+}
+
+func TestMaxExpansions(t *testing.T) {
+	tests := []struct {
+		query         string
+		maxExpansions int
+		want          []string
+		tooMany       bool
+	}{
+		// content holds crawler, crawling and crawls
+		{query: "craw*", maxExpansions: 3, want: []string{"crawler", "crawling"}},
+		{query: "craw*", maxExpansions: 2, tooMany: true},
+		{query: "title:craw*", maxExpansions: 2, want: []string{"crawler", "crawling"}},
+		{query: "crawl?r", maxExpansions: 1, want: []string{"crawler"}},
+		{query: "/crawl(er|ing|s)/", maxExpansions: 2, tooMany: true},
+		{query: "crawlers~1", maxExpansions: 1, want: []string{"crawler"}},
+		{query: "crawl~2", maxExpansions: 1, tooMany: true},
+		{query: "craw*", want: []string{"crawler", "crawling"}},
+	}
+
+	for _, tt := range tests {
+		results, err := newExpandIndex(tt.maxExpansions).Query(tt.query)
+		if tt.tooMany {
+			if !errors.Is(err, expand.ErrTooManyTerms) {
+				t.Errorf("Query(%s) with %d expansions: got error %v, want ErrTooManyTerms", tt.query, tt.maxExpansions, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Query(%s) with %d expansions: %v", tt.query, tt.maxExpansions, err)
+			continue
+		}
+		got := resultIDs(results)
+		sort.Strings(got)
+		if !equalIDs(got, tt.want) {
+			t.Errorf("Query(%s) with %d expansions = %v, want %v", tt.query, tt.maxExpansions, got, tt.want)
+		}
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	idx := newExpandIndex(0)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"*", []string{"crawler", "crawling", "robot"}},
+		{"* -web", []string{"crawler", "robot"}},
+		{"title:*", []string{"crawler", "crawling"}},
+		{"* -title:*", []string{"robot"}},
+		{"robot OR *", []string{"crawler", "crawling", "robot"}},
+	}
+
+	for _, tt := range tests {
+		results, err := idx.Query(tt.query)
+		if err != nil {
+			t.Fatalf("Query(%s): %v", tt.query, err)
+		}
+		got := resultIDs(results)
+		sort.Strings(got)
+		if !equalIDs(got, tt.want) {
+			t.Errorf("Query(%s) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -1,116 +1,460 @@
 package indexer
 
 import (
+	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/jonesrussell/goprowl/search/engine/analysis"
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
 )
 
+// DefaultField is the field IndexDocument indexes content under
+const DefaultField = "content"
+
+// Analyzers selects the analyzer each field is indexed and searched with
+type Analyzers struct {
+	// Default analyzes the fields not listed in Fields. Nil means
+	// analysis.Standard
+	Default *analysis.Analyzer
+	Fields  map[string]*analysis.Analyzer
+}
+
+// For returns the analyzer of field
+func (a Analyzers) For(field string) *analysis.Analyzer {
+	if analyzer, ok := a.Fields[field]; ok && analyzer != nil {
+		return analyzer
+	}
+	if a.Default != nil {
+		return a.Default
+	}
+	return analysis.Standard()
+}
+
+// Offset is the byte range of a term occurrence in the text of a field
+type Offset struct {
+	Start int
+	End   int
+}
+
+// Posting records where a term occurs in a field of a document
+type Posting struct {
+	// Positions are the token positions of the occurrences, ascending
+	Positions []int
+	// Offsets are the byte ranges of the occurrences, in the same order
+	Offsets []Offset
+}
+
+// Frequency returns how often the term occurs
+func (p *Posting) Frequency() int {
+	return len(p.Positions)
+}
+
+// BoostFunc returns the factor a named boost multiplies the score of a
+// result by, 1 to leave it as it is
+type BoostFunc func(result SearchResult) float64
+
+// TitleBoost returns a boost for results that matched in field
+func TitleBoost(field string, factor float64) BoostFunc {
+	return func(result SearchResult) float64 {
+		for _, location := range result.Locations {
+			if location.Field == field {
+				return factor
+			}
+		}
+		return 1
+	}
+}
+
+// Config configures an inverted index
+type Config struct {
+	Analyzers Analyzers
+	// Scorer scores term matches. Nil means BM25
+	Scorer ranking.Scorer
+	// Boosts are named factors applied to the score of every result, such
+	// as a title match, freshness or authority boost. The boosts that change
+	// a score are reported in the result
+	Boosts map[string]BoostFunc
+	// MaxExpansions is how many terms of a field a prefix, wildcard,
+	// regular expression or fuzzy term may match before the query fails.
+	// Zero means expand.DefaultMaxExpansions
+	MaxExpansions int
+}
+
 // InvertedIndex represents the core index structure
 type InvertedIndex struct {
-	mu sync.RWMutex
-	// map[term]map[documentID]termFrequency
-	index map[string]map[string]int
-	// map[documentID]documentLength
-	docLengths map[string]int
+	mu        sync.RWMutex
+	analyzers Analyzers
+	scorer    ranking.Scorer
+	ranker    *ranking.Ranker
+	boosts    map[string]BoostFunc
+	// maxExpansions limits the terms a pattern may match in a field
+	maxExpansions int
+	// map[field]map[term]map[documentID]posting
+	index map[string]map[string]map[string]*Posting
+	// map[documentID]map[field]fieldLength
+	docLengths map[string]map[string]int
+	// map[documentID]map[field]terms, to drop the postings of a document
+	// when it is updated
+	docTerms map[string]map[string][]string
+	// map[field]total length of the field over all documents
+	fieldLengths map[string]int
+	// map[field]number of documents with the field
+	fieldDocs map[string]int
 	// total number of documents
 	documentCount int64
 }
 
-// New creates a new inverted index
+// New creates a new inverted index analyzing every field with
+// analysis.Standard and scoring with BM25
 func New() *InvertedIndex {
+	return NewWithConfig(Config{})
+}
+
+// NewWithAnalyzers creates a new inverted index analyzing fields with the
+// given analyzers. Queries on a field are analyzed with the same analyzer
+// as its content
+func NewWithAnalyzers(analyzers Analyzers) *InvertedIndex {
+	return NewWithConfig(Config{Analyzers: analyzers})
+}
+
+// NewWithConfig creates a new inverted index configured by cfg
+func NewWithConfig(cfg Config) *InvertedIndex {
+	if cfg.Analyzers.Default == nil {
+		cfg.Analyzers.Default = analysis.Standard()
+	}
+	if cfg.Scorer == nil {
+		cfg.Scorer = ranking.NewBM25()
+	}
 	return &InvertedIndex{
-		index:         make(map[string]map[string]int),
-		docLengths:    make(map[string]int),
+		analyzers:     cfg.Analyzers,
+		scorer:        cfg.Scorer,
+		ranker:        ranking.New(),
+		boosts:        cfg.Boosts,
+		maxExpansions: cfg.MaxExpansions,
+		index:         make(map[string]map[string]map[string]*Posting),
+		docLengths:    make(map[string]map[string]int),
+		docTerms:      make(map[string]map[string][]string),
+		fieldLengths:  make(map[string]int),
+		fieldDocs:     make(map[string]int),
 		documentCount: 0,
 	}
 }
 
-// IndexDocument adds or updates a document in the index
+// IndexDocument adds or updates a document in the index, with content
+// under DefaultField
 func (idx *InvertedIndex) IndexDocument(docID string, content string) {
+	idx.IndexFields(docID, map[string]string{DefaultField: content})
+}
+
+// IndexFields adds or updates a document in the index, analyzing each field
+// with its analyzer
+func (idx *InvertedIndex) IndexFields(docID string, fields map[string]string) {
+	// Analyze outside the lock, analysis does not touch the index
+	analyzed := make(map[string][]analysis.Token, len(fields))
+	for field, text := range fields {
+		analyzed[field] = idx.analyzers.For(field).Analyze(text)
+	}
+
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	// Tokenize the content (simple implementation)
-	terms := tokenize(content)
-
-	// Calculate term frequencies for this document
-	termFreqs := make(map[string]int)
-	docLength := 0
-	for _, term := range terms {
-		termFreqs[term]++
-		docLength++
+	if _, exists := idx.docLengths[docID]; exists {
+		idx.removeDocument(docID)
 	}
 
-	// Update document length
-	idx.docLengths[docID] = docLength
+	lengths := make(map[string]int, len(analyzed))
+	docTerms := make(map[string][]string, len(analyzed))
+	for field, tokens := range analyzed {
+		// Collect the occurrences of each term in this field
+		postings := make(map[string]*Posting)
+		for _, token := range tokens {
+			posting := postings[token.Term]
+			if posting == nil {
+				posting = &Posting{}
+				postings[token.Term] = posting
+			}
+			posting.Positions = append(posting.Positions, token.Position)
+			posting.Offsets = append(posting.Offsets, Offset{Start: token.Start, End: token.End})
+		}
+		lengths[field] = len(tokens)
+		idx.fieldLengths[field] += len(tokens)
+		idx.fieldDocs[field]++
 
-	// Update inverted index
-	for term, freq := range termFreqs {
-		if idx.index[term] == nil {
-			idx.index[term] = make(map[string]int)
+		// Update inverted index
+		if idx.index[field] == nil {
+			idx.index[field] = make(map[string]map[string]*Posting)
+		}
+		for term, posting := range postings {
+			if idx.index[field][term] == nil {
+				idx.index[field][term] = make(map[string]*Posting)
+			}
+			idx.index[field][term][docID] = posting
+			docTerms[field] = append(docTerms[field], term)
 		}
-		idx.index[term][docID] = freq
 	}
 
+	idx.docLengths[docID] = lengths
+	idx.docTerms[docID] = docTerms
 	idx.documentCount++
 }
 
-// Search performs a search query and returns ranked results
+// removeDocument drops the postings of a document. The caller holds the
+// write lock
+func (idx *InvertedIndex) removeDocument(docID string) {
+	for field, terms := range idx.docTerms[docID] {
+		for _, term := range terms {
+			postings := idx.index[field][term]
+			delete(postings, docID)
+			if len(postings) == 0 {
+				delete(idx.index[field], term)
+			}
+		}
+	}
+	for field, length := range idx.docLengths[docID] {
+		idx.fieldLengths[field] -= length
+		idx.fieldDocs[field]--
+	}
+	delete(idx.docTerms, docID)
+	delete(idx.docLengths, docID)
+	idx.documentCount--
+}
+
+// Search performs a search query over every field and returns ranked
+// results. The query is analyzed separately for each field
 func (idx *InvertedIndex) Search(query string) []SearchResult {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	queryTerms := tokenize(query)
-	scores := make(map[string]float64)
+	// Convert scores to sorted results
+	results := idx.rank(idx.scoreTerms(idx.fields(), query, false))
+	return results
+}
+
+// SearchField performs a search query over one field and returns ranked
+// results
+func (idx *InvertedIndex) SearchField(field, query string) []SearchResult {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.rank(idx.scoreTerms([]string{field}, query, false))
+}
+
+// Analyzer returns the analyzer field is indexed and searched with
+func (idx *InvertedIndex) Analyzer(field string) *analysis.Analyzer {
+	return idx.analyzers.For(field)
+}
 
-	// Calculate TF-IDF scores for each matching document
-	for _, term := range queryTerms {
-		if postings, exists := idx.index[term]; exists {
-			idf := calculateIDF(idx.documentCount, int64(len(postings)))
+// AvgLength returns the average length in tokens of field over the
+// documents that have it
+func (idx *InvertedIndex) AvgLength(field string) float64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.avgLength(field)
+}
+
+func (idx *InvertedIndex) avgLength(field string) float64 {
+	if idx.fieldDocs[field] == 0 {
+		return 0
+	}
+	return float64(idx.fieldLengths[field]) / float64(idx.fieldDocs[field])
+}
+
+// fields returns the indexed fields. The caller holds the read lock
+func (idx *InvertedIndex) fields() []string {
+	fields := make([]string, 0, len(idx.index))
+	for field := range idx.index {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
 
-			for docID, tf := range postings {
-				docLength := idx.docLengths[docID]
-				normalizedTF := float64(tf) / float64(docLength)
-				scores[docID] += normalizedTF * idf
+// scoreTerms scores the documents matching the terms of query in fields.
+// The query is analyzed for each field, and the terms at the same query
+// position are scored as one term across the fields, so a scorer such as
+// BM25F can weigh where it occurs. The caller holds the read lock
+func (idx *InvertedIndex) scoreTerms(fields []string, query string, explain bool) *matches {
+	result := newMatches(explain)
+	// map[query position]map[documentID]field stats
+	terms := make(map[int]map[string][]ranking.FieldStats)
+	// map[query position]the terms it was analyzed to, for explanations
+	names := make(map[int][]string)
+	for _, field := range fields {
+		avgLength := idx.avgLength(field)
+		for _, token := range idx.analyzers.For(field).Analyze(query) {
+			if explain && !contains(names[token.Position], token.Term) {
+				names[token.Position] = append(names[token.Position], token.Term)
+			}
+			for docID, posting := range idx.index[field][token.Term] {
+				if terms[token.Position] == nil {
+					terms[token.Position] = make(map[string][]ranking.FieldStats)
+				}
+				terms[token.Position][docID] = addFieldStats(terms[token.Position][docID], ranking.FieldStats{
+					Field:     field,
+					Frequency: float64(posting.Frequency()),
+					Length:    float64(idx.docLengths[docID][field]),
+					AvgLength: avgLength,
+				})
+				for _, offset := range posting.Offsets {
+					result.locate(docID, Location{Field: field, Offset: offset})
+				}
 			}
 		}
 	}
 
-	// Convert scores to sorted results
-	results := rankResults(scores)
-	return results
+	for position, docs := range terms {
+		for docID, stats := range docs {
+			termStats := ranking.TermStats{
+				Fields:       stats,
+				DocsWithTerm: int64(len(docs)),
+				TotalDocs:    idx.documentCount,
+			}
+			result.add(docID, idx.scorer.Score(termStats))
+			if explain {
+				explanation := idx.scorer.Explain(termStats)
+				explanation.Description = fmt.Sprintf("term %s, %s", strings.Join(quote(names[position]), "|"), explanation.Description)
+				result.explainScore(docID, explanation)
+			}
+		}
+	}
+	return result
+}
+
+// addFieldStats adds the stats of a field to those of a term, merging them
+// with the field's earlier stats when synonyms of the term occur there too
+func addFieldStats(stats []ranking.FieldStats, field ranking.FieldStats) []ranking.FieldStats {
+	for i := range stats {
+		if stats[i].Field == field.Field {
+			stats[i].Frequency += field.Frequency
+			return stats
+		}
+	}
+	return append(stats, field)
 }
 
 // SearchResult represents a ranked search result
 type SearchResult struct {
 	DocID string
 	Score float64
+	// Locations are where the query matched, ordered by field and offset,
+	// for highlighting
+	Locations []Location
+	// Boosts are the named boosts applied to Score
+	Boosts []ranking.Boost
+	// Explanation shows how Score was computed, when asked for with Explain
+	Explanation *ranking.Explanation
+}
+
+// Location is the byte range of a match in the text of a field. Phrase
+// matches span from their first to their last term
+type Location struct {
+	Field string
+	Offset
+}
+
+// matches collects the scores and match locations of documents
+type matches struct {
+	scores    map[string]float64
+	locations map[string][]Location
+	// explanations of the parts of the scores, only collected when the
+	// scores are explained
+	explain      bool
+	explanations map[string][]*ranking.Explanation
+}
+
+func newMatches(explain bool) *matches {
+	return &matches{
+		scores:       make(map[string]float64),
+		locations:    make(map[string][]Location),
+		explain:      explain,
+		explanations: make(map[string][]*ranking.Explanation),
+	}
+}
+
+func (m *matches) explainScore(docID string, explanation *ranking.Explanation) {
+	m.explanations[docID] = append(m.explanations[docID], explanation)
+}
+
+func (m *matches) add(docID string, score float64) {
+	m.scores[docID] += score
+}
+
+func (m *matches) locate(docID string, location Location) {
+	m.locations[docID] = append(m.locations[docID], location)
 }
 
 // Helper functions
 
-func tokenize(text string) []string {
-	// Simple tokenization - split on whitespace and convert to lowercase
-	return strings.Fields(strings.ToLower(text))
+// explainSum explains a score made of parts, leaving out the sum for a
+// single part
+func explainSum(parts []*ranking.Explanation) *ranking.Explanation {
+	switch len(parts) {
+	case 0:
+		return ranking.Explain(0, "no scoring clause matched")
+	case 1:
+		return parts[0]
+	}
+	return ranking.Sum("sum of:", parts)
 }
 
-func calculateIDF(totalDocs, docsWithTerm int64) float64 {
-	return float64(1.0 + totalDocs/docsWithTerm)
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func quote(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return quoted
 }
 
-func rankResults(scores map[string]float64) []SearchResult {
-	results := make([]SearchResult, 0, len(scores))
-	for docID, score := range scores {
-		results = append(results, SearchResult{
-			DocID: docID,
-			Score: score,
+// rank turns matches into results ordered by score, highest first, after
+// applying the configured boosts. The caller holds the read lock
+func (idx *InvertedIndex) rank(matches *matches) []SearchResult {
+	results := make([]SearchResult, 0, len(matches.scores))
+	for docID, score := range matches.scores {
+		locations := matches.locations[docID]
+		sort.Slice(locations, func(i, j int) bool {
+			if locations[i].Field != locations[j].Field {
+				return locations[i].Field < locations[j].Field
+			}
+			return locations[i].Start < locations[j].Start
 		})
+		result := SearchResult{
+			DocID:     docID,
+			Score:     score,
+			Locations: locations,
+		}
+
+		if len(idx.boosts) > 0 {
+			factors := make(map[string]float64, len(idx.boosts))
+			for name, boost := range idx.boosts {
+				factors[name] = boost(result)
+			}
+			result.Score, result.Boosts = idx.ranker.BoostScore(score, factors)
+		}
+		if matches.explain {
+			result.Explanation = ranking.ExplainBoosts(explainSum(matches.explanations[docID]), result.Score, result.Boosts)
+		}
+		results = append(results, result)
 	}
 
 	// Sort results by score (highest first)
 	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].DocID < results[j].DocID
 	})
 
 	return results
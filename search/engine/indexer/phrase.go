@@ -0,0 +1,221 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
+)
+
+// SearchPhrase returns the documents in which the terms of phrase occur next
+// to each other and in order, ranked by how often they do. A slop above zero
+// also matches the terms up to slop position moves apart, with closer
+// matches scoring higher; a swap of two terms takes two moves. An empty
+// field searches every field
+func (idx *InvertedIndex) SearchPhrase(field, phrase string, slop int) []SearchResult {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	fields := []string{field}
+	if field == "" {
+		fields = idx.fields()
+	}
+	return idx.rank(idx.scorePhrase(fields, phrase, slop, false))
+}
+
+// phraseSlot is a position of a phrase: the terms that may stand there,
+// several when the analyzer adds synonyms, and the position relative to the
+// first term of the phrase
+type phraseSlot struct {
+	terms  []string
+	offset int
+}
+
+// occurrence is a term occurrence in a document, with its position made
+// relative to the start of the phrase
+type occurrence struct {
+	start    int // Position of the phrase start the occurrence implies
+	position int
+	Offset
+}
+
+// scorePhrase scores the documents matching a phrase in fields. The phrase
+// is scored as a single term whose frequency is the number of matches,
+// sloppy ones counting for less the more moves they take. The caller holds
+// the read lock
+func (idx *InvertedIndex) scorePhrase(fields []string, phrase string, slop int, explain bool) *matches {
+	result := newMatches(explain)
+	// map[documentID]field stats
+	docs := make(map[string][]ranking.FieldStats)
+	for _, field := range fields {
+		slots := idx.phraseSlots(field, phrase)
+		if len(slots) == 0 {
+			continue
+		}
+
+		avgLength := idx.avgLength(field)
+		for docID := range idx.phraseCandidates(field, slots) {
+			occurrences := make([][]occurrence, len(slots))
+			for i, slot := range slots {
+				occurrences[i] = idx.slotOccurrences(field, docID, slot)
+			}
+
+			frequency := 0.0
+			for _, span := range phraseSpans(occurrences, slop) {
+				frequency += span.weight
+				result.locate(docID, Location{Field: field, Offset: span.Offset})
+			}
+			if frequency > 0 {
+				docs[docID] = append(docs[docID], ranking.FieldStats{
+					Field:     field,
+					Frequency: frequency,
+					Length:    float64(idx.docLengths[docID][field]),
+					AvgLength: avgLength,
+				})
+			}
+		}
+	}
+
+	for docID, stats := range docs {
+		termStats := ranking.TermStats{
+			Fields:       stats,
+			DocsWithTerm: int64(len(docs)),
+			TotalDocs:    idx.documentCount,
+		}
+		result.add(docID, idx.scorer.Score(termStats))
+		if explain {
+			explanation := idx.scorer.Explain(termStats)
+			explanation.Description = fmt.Sprintf("phrase %q, slop %d, %s", phrase, slop, explanation.Description)
+			result.explainScore(docID, explanation)
+		}
+	}
+	return result
+}
+
+// phraseCandidates returns the documents holding a term of every slot of a
+// phrase in field
+func (idx *InvertedIndex) phraseCandidates(field string, slots []phraseSlot) map[string]bool {
+	candidates := idx.slotDocs(field, slots[0])
+	for _, slot := range slots[1:] {
+		docs := idx.slotDocs(field, slot)
+		for docID := range candidates {
+			if !docs[docID] {
+				delete(candidates, docID)
+			}
+		}
+	}
+	return candidates
+}
+
+// phraseSlots analyzes phrase as field is analyzed and groups its terms by
+// position. Positions left by removed stop words are kept as gaps
+func (idx *InvertedIndex) phraseSlots(field, phrase string) []phraseSlot {
+	tokens := idx.analyzers.For(field).Analyze(phrase)
+	var slots []phraseSlot
+	for _, token := range tokens {
+		offset := token.Position - tokens[0].Position
+		if n := len(slots); n > 0 && slots[n-1].offset == offset {
+			slots[n-1].terms = append(slots[n-1].terms, token.Term)
+			continue
+		}
+		slots = append(slots, phraseSlot{terms: []string{token.Term}, offset: offset})
+	}
+	return slots
+}
+
+// slotDocs returns the documents holding a term of slot in field
+func (idx *InvertedIndex) slotDocs(field string, slot phraseSlot) map[string]bool {
+	docs := make(map[string]bool)
+	for _, term := range slot.terms {
+		for docID := range idx.index[field][term] {
+			docs[docID] = true
+		}
+	}
+	return docs
+}
+
+// slotOccurrences returns the occurrences of the terms of slot in a
+// document, ordered by position
+func (idx *InvertedIndex) slotOccurrences(field, docID string, slot phraseSlot) []occurrence {
+	var occurrences []occurrence
+	for _, term := range slot.terms {
+		posting := idx.index[field][term][docID]
+		if posting == nil {
+			continue
+		}
+		for i, position := range posting.Positions {
+			occurrences = append(occurrences, occurrence{
+				start:    position - slot.offset,
+				position: position,
+				Offset:   posting.Offsets[i],
+			})
+		}
+	}
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].start < occurrences[j].start
+	})
+	return occurrences
+}
+
+// phraseSpan is a match of a phrase, weighted down the more moves it takes
+type phraseSpan struct {
+	Offset
+	weight float64
+}
+
+// phraseSpans finds the non-overlapping matches of a phrase given the
+// occurrences of each of its slots. An exact match implies the same phrase
+// start for every slot; a sloppy one implies starts at most slop apart.
+// Each step looks at the earliest unused occurrence of every slot and either
+// takes them all as a match or moves past the one implying the earliest
+// start
+func phraseSpans(occurrences [][]occurrence, slop int) []phraseSpan {
+	var spans []phraseSpan
+	next := make([]int, len(occurrences))
+	for {
+		lowest, low, high := 0, 0, 0
+		for i, list := range occurrences {
+			if next[i] >= len(list) {
+				return spans
+			}
+			start := list[next[i]].start
+			if i == 0 || start < low {
+				lowest, low = i, start
+			}
+			if i == 0 || start > high {
+				high = start
+			}
+		}
+
+		if high-low <= slop && distinctPositions(occurrences, next) {
+			span := phraseSpan{weight: 1 / float64(1+high-low)}
+			for i, list := range occurrences {
+				o := list[next[i]]
+				if i == 0 || o.Start < span.Start {
+					span.Start = o.Start
+				}
+				if o.End > span.End {
+					span.End = o.End
+				}
+				next[i]++
+			}
+			spans = append(spans, span)
+			continue
+		}
+		next[lowest]++
+	}
+}
+
+// distinctPositions reports whether the current occurrences of the slots
+// are at different positions, so a single word cannot match two slots
+func distinctPositions(occurrences [][]occurrence, next []int) bool {
+	seen := make(map[int]bool, len(occurrences))
+	for i, list := range occurrences {
+		position := list[next[i]].position
+		if seen[position] {
+			return false
+		}
+		seen[position] = true
+	}
+	return true
+}
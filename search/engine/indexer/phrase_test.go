@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"sort"
+	"testing"
+)
+
+// phraseDocuments hold "fast crawler" with more and more moves between its
+// terms, in fields of the same length
+var phraseDocuments = map[string]string{
+	"exact":    "very fast crawler here",
+	"gap1":     "fast web crawler here",
+	"gap2":     "fast little web crawler",
+	"swapped":  "crawler fast very here",
+	"reversed": "crawler runs fast here",
+}
+
+func newPhraseIndex() *InvertedIndex {
+	idx := New()
+	for id, content := range phraseDocuments {
+		idx.IndexDocument(id, content)
+	}
+	return idx
+}
+
+func resultIDs(results []SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.DocID
+	}
+	return ids
+}
+
+func TestPhraseSlop(t *testing.T) {
+	idx := newPhraseIndex()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`"fast crawler"`, []string{"exact"}},
+		{`"fast crawler"~1`, []string{"exact", "gap1"}},
+		// A swap of two terms takes two moves
+		{`"fast crawler"~2`, []string{"exact", "gap1", "gap2", "swapped"}},
+		{`"fast crawler"~3`, []string{"exact", "gap1", "gap2", "reversed", "swapped"}},
+		{`"crawler fast"`, []string{"swapped"}},
+	}
+
+	for _, tt := range tests {
+		results, err := idx.Query(tt.query)
+		if err != nil {
+			t.Fatalf("Query(%s): %v", tt.query, err)
+		}
+		got := resultIDs(results)
+		sort.Strings(got)
+		sort.Strings(tt.want)
+		if !equalIDs(got, tt.want) {
+			t.Errorf("Query(%s) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPhraseSlopRanksCloserMatchesHigher(t *testing.T) {
+	idx := newPhraseIndex()
+
+	results := idx.SearchPhrase(DefaultField, "fast crawler", 2)
+	scores := make(map[string]float64, len(results))
+	for _, result := range results {
+		scores[result.DocID] = result.Score
+	}
+	if !(scores["exact"] > scores["gap1"] && scores["gap1"] > scores["gap2"]) {
+		t.Errorf("scores %v, want exact > gap1 > gap2", scores)
+	}
+	if scores["gap2"] != scores["swapped"] {
+		t.Errorf("scores %v, want gap2 and swapped, both two moves away, equal", scores)
+	}
+}
+
+func TestPhraseSlopLocations(t *testing.T) {
+	idx := newPhraseIndex()
+
+	results := idx.SearchPhrase(DefaultField, "fast crawler", 1)
+	for _, result := range results {
+		if result.DocID != "gap1" {
+			continue
+		}
+		if len(result.Locations) != 1 {
+			t.Fatalf("locations %v, want one span", result.Locations)
+		}
+		content := phraseDocuments["gap1"]
+		if got := content[result.Locations[0].Start:result.Locations[0].End]; got != "fast web crawler" {
+			t.Errorf("span %q, want %q", got, "fast web crawler")
+		}
+		return
+	}
+	t.Error("gap1 not found")
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
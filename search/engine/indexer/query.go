@@ -0,0 +1,232 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/jonesrussell/goprowl/search/engine/expand"
+	"github.com/jonesrussell/goprowl/search/engine/query"
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
+)
+
+// Query runs a query in the search syntax against the index: terms, field
+// terms, phrases with an optional slop ("fast crawler"~3), boosts and
+// boolean operators. Terms without a field match any field. Prefixes
+// (craw*), wildcards (c?awl*), regular expressions (/crawl(er|ing)/) and
+// fuzzy terms (crawler~2) match the indexed terms they expand to. Malformed
+// queries return a *query.SyntaxError, and patterns matching too many terms
+// an error wrapping expand.ErrTooManyTerms
+func (idx *InvertedIndex) Query(q string) ([]SearchResult, error) {
+	return idx.query(q, false)
+}
+
+// Explain runs a query like Query, setting the Explanation of every result
+// to the tree of values its score was computed from
+func (idx *InvertedIndex) Explain(q string) ([]SearchResult, error) {
+	return idx.query(q, true)
+}
+
+func (idx *InvertedIndex) query(q string, explain bool) ([]SearchResult, error) {
+	root, err := query.NewQueryProcessor().ParseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return idx.QueryTree(root, explain)
+}
+
+// QueryTree runs a parsed query against the index like Query, explaining
+// the score of every result when explain is set. A nil root matches nothing
+func (idx *InvertedIndex) QueryTree(root query.Node, explain bool) ([]SearchResult, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if root == nil {
+		return []SearchResult{}, nil
+	}
+	result, err := idx.evaluate(root, explain)
+	if err != nil {
+		return nil, err
+	}
+	return idx.rank(result), nil
+}
+
+// evaluate returns the documents matching node, with their scores and
+// match locations. The caller holds the read lock
+func (idx *InvertedIndex) evaluate(node query.Node, explain bool) (*matches, error) {
+	switch n := node.(type) {
+	case *query.QueryTerm:
+		return idx.evaluateTerm(n, explain)
+	case *query.RequiredNode:
+		return idx.evaluate(n.Child, explain)
+	case *query.NotNode:
+		// A lone negation matches every document without its child
+		excluded, err := idx.evaluate(n.Child, explain)
+		if err != nil {
+			return nil, err
+		}
+		all := newMatches(explain)
+		for docID := range idx.docLengths {
+			all.add(docID, 0)
+		}
+		all.subtract(excluded)
+		return all, nil
+	case *query.BooleanNode:
+		return idx.evaluateBoolean(n, explain)
+	}
+	return newMatches(explain), nil
+}
+
+// evaluateBoolean combines the clauses of n. Negated clauses exclude their
+// documents and required clauses restrict the result to theirs, whatever the
+// operator
+func (idx *InvertedIndex) evaluateBoolean(n *query.BooleanNode, explain bool) (*matches, error) {
+	var result, excluded *matches
+	var required []*matches
+	for _, clause := range n.Clauses {
+		switch c := clause.(type) {
+		case *query.NotNode:
+			childMatches, err := idx.evaluate(c.Child, explain)
+			if err != nil {
+				return nil, err
+			}
+			if excluded == nil {
+				excluded = newMatches(explain)
+			}
+			excluded.union(childMatches)
+			continue
+		case *query.RequiredNode:
+			childMatches, err := idx.evaluate(c.Child, explain)
+			if err != nil {
+				return nil, err
+			}
+			required = append(required, childMatches)
+			continue
+		}
+
+		clauseMatches, err := idx.evaluate(clause, explain)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case result == nil:
+			result = clauseMatches
+		case n.Op == query.OpAnd:
+			result.intersect(clauseMatches)
+		default:
+			result.union(clauseMatches)
+		}
+	}
+
+	for _, r := range required {
+		if result == nil {
+			result = r
+			continue
+		}
+		result.intersect(r)
+	}
+	if result == nil {
+		// Only negated clauses: everything but them
+		result = newMatches(explain)
+		for docID := range idx.docLengths {
+			result.add(docID, 0)
+		}
+	}
+	if excluded != nil {
+		result.subtract(excluded)
+	}
+	return result, nil
+}
+
+// evaluateTerm scores a leaf term in its field, or in every field
+func (idx *InvertedIndex) evaluateTerm(term *query.QueryTerm, explain bool) (*matches, error) {
+	fields := []string{term.Field}
+	if term.Field == "" {
+		fields = idx.fields()
+	}
+
+	var result *matches
+	switch {
+	case term.MatchesAll():
+		result = idx.matchAll(term.Field, explain)
+	case term.Type == query.TypePhrase:
+		result = idx.scorePhrase(fields, term.Text, term.Slop, explain)
+	case expand.IsPattern(term):
+		var err error
+		if result, err = idx.scoreExpanded(fields, term, explain); err != nil {
+			return nil, err
+		}
+	default:
+		result = idx.scoreTerms(fields, term.Text, explain)
+	}
+	if term.Boost > 0 {
+		for docID, score := range result.scores {
+			result.scores[docID] = score * term.Boost
+			if explain {
+				result.explanations[docID] = []*ranking.Explanation{ranking.Explain(score*term.Boost,
+					fmt.Sprintf("%s, boosted ^%g, product of:", term, term.Boost),
+					explainSum(result.explanations[docID]),
+					ranking.Explain(term.Boost, "query boost"),
+				)}
+			}
+		}
+	}
+	return result, nil
+}
+
+// matchAll matches every document, or with a field every document with
+// terms in it, all with the same score. The caller holds the read lock
+func (idx *InvertedIndex) matchAll(field string, explain bool) *matches {
+	description := "*, matching every document"
+	if field != "" {
+		description = fmt.Sprintf("%s:*, matching the documents with terms in %s", field, field)
+	}
+
+	result := newMatches(explain)
+	for docID, lengths := range idx.docLengths {
+		if field != "" && lengths[field] == 0 {
+			continue
+		}
+		result.add(docID, 1)
+		if explain {
+			result.explainScore(docID, ranking.Explain(1, description))
+		}
+	}
+	return result
+}
+
+// union adds the documents of other, summing scores
+func (m *matches) union(other *matches) {
+	for docID, score := range other.scores {
+		m.add(docID, score)
+		m.locations[docID] = append(m.locations[docID], other.locations[docID]...)
+		m.explanations[docID] = append(m.explanations[docID], other.explanations[docID]...)
+	}
+}
+
+// intersect keeps the documents also in other, summing scores
+func (m *matches) intersect(other *matches) {
+	for docID := range m.scores {
+		if _, ok := other.scores[docID]; !ok {
+			m.remove(docID)
+		}
+	}
+	for docID, score := range other.scores {
+		if _, ok := m.scores[docID]; ok {
+			m.add(docID, score)
+			m.locations[docID] = append(m.locations[docID], other.locations[docID]...)
+			m.explanations[docID] = append(m.explanations[docID], other.explanations[docID]...)
+		}
+	}
+}
+
+// subtract drops the documents in other
+func (m *matches) subtract(other *matches) {
+	for docID := range other.scores {
+		m.remove(docID)
+	}
+}
+
+func (m *matches) remove(docID string) {
+	delete(m.scores, docID)
+	delete(m.locations, docID)
+	delete(m.explanations, docID)
+}
@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jonesrussell/goprowl/search/engine/indexer"
+	"github.com/jonesrussell/goprowl/search/storage"
+)
+
+// Backend names, for selecting a search backend by configuration
+const (
+	BackendBleve    = "bleve"
+	BackendInverted = "inverted"
+)
+
+// ErrUnsupported is returned for search options a backend cannot apply
+var ErrUnsupported = errors.New("not supported by the search backend")
+
+// invertedFields are the document fields the inverted index searches
+var invertedFields = []string{"title", "content"}
+
+// InvertedSearchEngine searches the in-house inverted index instead of
+// bleve, ranking results with the index's scorer. The index is held in
+// memory: it is built from the storage on the first search, and built again
+// after documents are written through the engine. Every other operation is
+// the BasicSearchEngine's. Filters, facets, sorting, cursors, collapsing and
+// snippets are not supported
+type InvertedSearchEngine struct {
+	*BasicSearchEngine
+	cfg indexer.Config
+
+	// invertedMu guards inverted, nil until the next search builds it
+	invertedMu sync.Mutex
+	inverted   *indexer.InvertedIndex
+}
+
+// NewInverted creates a search engine searching the documents of storage
+// with an inverted index configured by cfg. Queries use the index's
+// MaxExpansions rather than their own
+func NewInverted(storage storage.StorageAdapter, cfg indexer.Config) (*InvertedSearchEngine, error) {
+	basic, err := New(storage)
+	if err != nil {
+		return nil, err
+	}
+	return &InvertedSearchEngine{
+		BasicSearchEngine: basic.(*BasicSearchEngine),
+		cfg:               cfg,
+	}, nil
+}
+
+// NewBackend creates the search engine of the named backend, cfg
+// configuring the inverted index
+func NewBackend(name string, storage storage.StorageAdapter, cfg indexer.Config) (SearchEngine, error) {
+	switch name {
+	case "", BackendBleve:
+		return New(storage)
+	case BackendInverted:
+		return NewInverted(storage, cfg)
+	}
+	return nil, fmt.Errorf("unknown search backend %q (want %s or %s)", name, BackendBleve, BackendInverted)
+}
+
+func (e *InvertedSearchEngine) Search(query Query) (*SearchResults, error) {
+	if err := invertedSupports(query); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	idx, err := e.invertedIndex(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var matches []indexer.SearchResult
+	if root := query.Root(); root != nil {
+		if matches, err = idx.QueryTree(root, query.Explain()); err != nil {
+			return nil, err
+		}
+	}
+
+	page := query.Pagination()
+	from := (page.Page - 1) * page.Size
+	if from < 0 {
+		from = 0
+	}
+	hits := make([]SearchResult, 0, page.Size)
+	for i := from; i < len(matches) && i < from+page.Size; i++ {
+		doc, err := e.Get(matches[i].DocID)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, SearchResult{
+			Content:     doc.Content(),
+			Score:       matches[i].Score,
+			Metadata:    doc.Metadata(),
+			Explanation: matches[i].Explanation,
+		})
+	}
+
+	return &SearchResults{
+		Hits:   hits,
+		Facets: make(map[string][]Facet),
+		Metadata: map[string]interface{}{
+			"total":      int64(len(matches)),
+			"query_time": time.Now(),
+			"took":       time.Since(start),
+			"collapsed":  0,
+		},
+	}, nil
+}
+
+// invertedSupports returns an error wrapping ErrUnsupported for the options
+// of query the inverted index cannot apply
+func invertedSupports(query Query) error {
+	var option string
+	switch {
+	case len(query.Filters()) > 0 || query.Filter() != nil:
+		option = "filters"
+	case len(query.Facets()) > 0:
+		option = "facets"
+	case query.Collapse() != "":
+		option = "collapsing"
+	case len(query.Sort()) > 0:
+		option = "sorting"
+	case query.Cursor() != "":
+		option = "cursors"
+	case query.MaxExpansions() != 0:
+		option = "per-query max expansions"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: %s with the %s backend", ErrUnsupported, option, BackendInverted)
+}
+
+// SearchWithOptions implements the SearchEngine interface
+func (e *InvertedSearchEngine) SearchWithOptions(ctx context.Context, opts SearchOptions) (*SearchResults, error) {
+	query, err := optionsQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+	return e.Search(query)
+}
+
+// GetTotalResults implements the SearchEngine interface
+func (e *InvertedSearchEngine) GetTotalResults(ctx context.Context, queryString string) (int, error) {
+	results, err := e.SearchWithOptions(ctx, SearchOptions{Query: queryString})
+	if err != nil {
+		return 0, err
+	}
+	return int(results.Metadata["total"].(int64)), nil
+}
+
+// invertedIndex returns the inverted index, building it from the storage
+// when documents were written since the last build
+func (e *InvertedSearchEngine) invertedIndex(ctx context.Context) (*indexer.InvertedIndex, error) {
+	e.invertedMu.Lock()
+	defer e.invertedMu.Unlock()
+
+	if e.inverted != nil {
+		return e.inverted, nil
+	}
+
+	docs, err := e.storage.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load documents: %w", err)
+	}
+	idx := indexer.NewWithConfig(e.cfg)
+	for _, doc := range docs {
+		content := documentFromStorage(doc).Content()
+		fields := make(map[string]string, len(invertedFields))
+		for _, field := range invertedFields {
+			if text, _ := content[field].(string); text != "" {
+				fields[field] = text
+			}
+		}
+		idx.IndexFields(doc.URL, fields)
+	}
+	e.inverted = idx
+	return idx, nil
+}
+
+// invalidate drops the inverted index, for the next search to build it
+// again
+func (e *InvertedSearchEngine) invalidate() {
+	e.invertedMu.Lock()
+	defer e.invertedMu.Unlock()
+
+	e.inverted = nil
+}
+
+func (e *InvertedSearchEngine) Index(doc Document) error {
+	defer e.invalidate()
+	return e.BasicSearchEngine.Index(doc)
+}
+
+func (e *InvertedSearchEngine) BatchIndex(docs []Document) error {
+	defer e.invalidate()
+	return e.BasicSearchEngine.BatchIndex(docs)
+}
+
+func (e *InvertedSearchEngine) Delete(id string) error {
+	defer e.invalidate()
+	return e.BasicSearchEngine.Delete(id)
+}
+
+// Reindex implements the SearchEngine interface
+func (e *InvertedSearchEngine) Reindex(ctx context.Context) error {
+	defer e.invalidate()
+	return e.BasicSearchEngine.Reindex(ctx)
+}
+
+// Clear implements the SearchEngine interface by removing all documents
+func (e *InvertedSearchEngine) Clear() error {
+	defer e.invalidate()
+	return e.BasicSearchEngine.Clear()
+}
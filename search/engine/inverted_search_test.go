@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jonesrussell/goprowl/search/engine/indexer"
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
+)
+
+func TestInvertedSearch(t *testing.T) {
+	e, err := NewInverted(newTestStorage(t), indexer.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "crawler", want: []string{article, news}},
+		{query: "crawler -released", want: []string{article}},
+		{query: `"robot d'indexation"`, want: []string{produit}},
+		{query: "*", want: []string{article, news, produit}},
+		{query: "", want: []string{}},
+	}
+	for _, tt := range tests {
+		if got := searchURLs(t, e, tt.query); !equalStrings(got, tt.want) {
+			t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestInvertedSearchExplain(t *testing.T) {
+	e, err := NewInverted(newTestStorage(t), indexer.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := e.SearchWithOptions(context.Background(), SearchOptions{Query: "crawler", Explain: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Hits) == 0 {
+		t.Fatal("no results")
+	}
+	for _, hit := range results.Hits {
+		if hit.Explanation == nil {
+			t.Fatalf("%v: no explanation", hit.Content["url"])
+		}
+		if hit.Explanation.Value != hit.Score {
+			t.Errorf("%v: explanation value %v, want the score %v", hit.Content["url"], hit.Explanation.Value, hit.Score)
+		}
+		if tree := hit.Explanation.Tree(); !strings.Contains(tree, "bm25") {
+			t.Errorf("%v: explanation does not name the scorer:\n%s", hit.Content["url"], tree)
+		}
+	}
+}
+
+func TestInvertedSearchReindexes(t *testing.T) {
+	e, err := NewInverted(newTestStorage(t), indexer.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := searchURLs(t, e, "crawler"); len(got) != 2 {
+		t.Fatalf("search crawler = %v, want 2 results", got)
+	}
+	if err := e.Delete(news); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := searchURLs(t, e, "crawler"), []string{article}; !equalStrings(got, want) {
+		t.Errorf("search crawler after deleting = %v, want %v", got, want)
+	}
+}
+
+func TestInvertedSearchUnsupported(t *testing.T) {
+	e, err := NewInverted(newTestStorage(t), indexer.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []SearchOptions{
+		{Query: "crawler +host:a.example.com"},
+		{Query: "crawler", Filters: map[string]interface{}{"host": []string{"a.example.com"}}},
+		{Query: "crawler", SortBy: "-created"},
+		{Query: "crawler", Collapse: ClusterField},
+	} {
+		if _, err := e.SearchWithOptions(context.Background(), opts); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("search %+v: got error %v, want ErrUnsupported", opts, err)
+		}
+	}
+}
+
+func TestInvertedSearchScorer(t *testing.T) {
+	store := newTestStorage(t)
+	for _, name := range []string{ranking.ScorerBM25, ranking.ScorerBM25F, ranking.ScorerTFIDF} {
+		scorer, err := ranking.NewScorer(name, map[string]float64{"title": 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := NewInverted(store, indexer.Config{Scorer: scorer})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := e.SearchWithOptions(context.Background(), SearchOptions{Query: "crawler", Explain: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := name
+		if name == ranking.ScorerTFIDF {
+			want = "tf-idf"
+		}
+		for _, hit := range results.Hits {
+			if tree := hit.Explanation.Tree(); !strings.Contains(tree, want+",") {
+				t.Errorf("%s: %v explanation does not name the scorer:\n%s", name, hit.Content["url"], tree)
+			}
+		}
+	}
+
+	if _, err := ranking.NewScorer("bm26", nil); err == nil {
+		t.Error("NewScorer accepted an unknown scorer")
+	}
+}
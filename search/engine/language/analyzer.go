@@ -0,0 +1,100 @@
+package language
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/analysis/lang/ar"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ckb"
+	"github.com/blevesearch/bleve/v2/analysis/lang/da"
+	"github.com/blevesearch/bleve/v2/analysis/lang/de"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/lang/es"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fa"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fi"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hi"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hu"
+	"github.com/blevesearch/bleve/v2/analysis/lang/it"
+	"github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	"github.com/blevesearch/bleve/v2/analysis/lang/no"
+	"github.com/blevesearch/bleve/v2/analysis/lang/pl"
+	"github.com/blevesearch/bleve/v2/analysis/lang/pt"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ro"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	"github.com/blevesearch/bleve/v2/analysis/lang/sv"
+	"github.com/blevesearch/bleve/v2/analysis/lang/tr"
+)
+
+// Field is the document field holding the language code, which also
+// selects the document mapping, and so the analyzer, a document is indexed with
+const Field = "language"
+
+// AnalyzedFields are the text fields that documents in a language with an
+// analyzer also index with that analyzer, under AnalyzedField
+var AnalyzedFields = []string{"title", "headings", "content"}
+
+// analyzers maps language codes to the bleve analyzers for them
+var analyzers = map[string]string{
+	"ar":  ar.AnalyzerName,
+	"ckb": ckb.AnalyzerName,
+	"da":  da.AnalyzerName,
+	"de":  de.AnalyzerName,
+	"en":  en.AnalyzerName,
+	"es":  es.AnalyzerName,
+	"fa":  fa.AnalyzerName,
+	"fi":  fi.AnalyzerName,
+	"fr":  fr.AnalyzerName,
+	"hi":  hi.AnalyzerName,
+	"hr":  hr.AnalyzerName,
+	"hu":  hu.AnalyzerName,
+	"it":  it.AnalyzerName,
+	"ja":  cjk.AnalyzerName,
+	"ko":  cjk.AnalyzerName,
+	"nb":  no.AnalyzerName,
+	"nl":  nl.AnalyzerName,
+	"nn":  no.AnalyzerName,
+	"no":  no.AnalyzerName,
+	"pl":  pl.AnalyzerName,
+	"pt":  pt.AnalyzerName,
+	"ro":  ro.AnalyzerName,
+	"ru":  ru.AnalyzerName,
+	"sv":  sv.AnalyzerName,
+	"tr":  tr.AnalyzerName,
+	"zh":  cjk.AnalyzerName,
+}
+
+// Analyzer returns the name of the bleve analyzer for a language code, and
+// whether the language has one
+func Analyzer(lang string) (string, bool) {
+	analyzer, ok := analyzers[strings.ToLower(strings.TrimSpace(lang))]
+	return analyzer, ok
+}
+
+// Languages returns the language codes that have an analyzer, sorted
+func Languages() []string {
+	langs := make([]string, 0, len(analyzers))
+	for lang := range analyzers {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// AnalyzedField returns the name of the field holding the text of field as
+// analyzed for the document's language
+func AnalyzedField(field string) string {
+	return field + "_lang"
+}
+
+// IsAnalyzed reports whether field is one of AnalyzedFields
+func IsAnalyzed(field string) bool {
+	for _, analyzed := range AnalyzedFields {
+		if field == analyzed {
+			return true
+		}
+	}
+	return false
+}
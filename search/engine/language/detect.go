@@ -0,0 +1,184 @@
+// Package language identifies the language of document text and picks the
+// bleve analyzer that stems and removes stop words for it
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// sampleSize caps the bytes of text examined, which is plenty to tell
+	// languages apart and keeps detection cheap on long pages
+	sampleSize = 16 * 1024
+	// minLetters is the least text a language is detected from
+	minLetters = 20
+	// minStopWordShare is the share of words that have to be stop words of
+	// the detected language. Prose runs well above it, while lists of names
+	// and code do not
+	minStopWordShare = 0.08
+)
+
+// stopWords are the most frequent function words of the languages told
+// apart by vocabulary rather than script
+var stopWords = map[string][]string{
+	"en": strings.Fields("the of and to in is that for it as was with be by on not he this are or his from at which but have an they you were her she there been one all we their has would when if will can more its also who what"),
+	"fr": strings.Fields("le la les de des du et est un une que qui dans pour pas sur au aux ne se ce il elle sont avec par plus ou son sa ses nous vous leur été cette être mais comme"),
+	"de": strings.Fields("der die das und ist nicht ein eine zu den von mit sich des auf für im dem auch es an als nach wird bei einer um am sind noch wie einem über so zum aus werden hat oder"),
+	"es": strings.Fields("el la los las de del y en que un una es por con para no se su al lo como más pero sus le ya o este porque esta entre cuando muy sin sobre también"),
+	"it": strings.Fields("il lo la gli le di del della e che è un una per non con sono da nel nella si come anche più ma alla dei delle al questo questa essere"),
+	"pt": strings.Fields("o a os as de do da dos das e que em um uma é para com não por se na no mais como mas ao ele foi são seu sua ou quando muito também já está"),
+	"nl": strings.Fields("de het een en van is dat in te op niet zijn voor met die aan er maar om ook als dan bij nog wel naar worden kan geen heeft door wordt"),
+	"sv": strings.Fields("och att det som en på är av för med till den har de inte om ett han men var jag sig från vi så kan man när"),
+	"da": strings.Fields("og i at det en den til er som på de med af for ikke der var han har sig men et fra vi kan jeg også efter"),
+	"no": strings.Fields("og i det at en på som er til av for med ikke den har de om et var men jeg fra vi kan også etter skal"),
+	"fi": strings.Fields("ja on ei se että hän oli ovat mutta kuin tai jos myös kun niin joka mitä tämä ole olla sen siitä sekä vain vielä"),
+	"hu": strings.Fields("a az és hogy nem is egy van meg de el csak ez mint már volt kell még ki azt lesz vagy ha"),
+	"ro": strings.Fields("și de la în cu pe nu o un a din ca că se mai este sau care pentru fost sunt ale lui"),
+	"tr": strings.Fields("ve bir bu da de için ile çok gibi daha ne ama olan olarak en kadar mi sonra ya her değil şey"),
+	"pl": strings.Fields("i w na z nie się do to że jest o jak ale po co tak za od czy są przez może dla już"),
+	"hr": strings.Fields("i u je se na da za su od s ne a kao što to o iz ali koji ili bi biti"),
+	"ru": strings.Fields("и в не на что с он я как по это она к но они мы из у же за от так было для все его"),
+}
+
+// stopWordIndex maps each stop word to the languages it belongs to
+var stopWordIndex = func() map[string][]string {
+	index := make(map[string][]string)
+	for lang, words := range stopWords {
+		for _, word := range words {
+			index[word] = append(index[word], lang)
+		}
+	}
+	return index
+}()
+
+// Detect returns the ISO 639-1 code of the language text is written in, or
+// "" when there is too little text to tell or no language stands out.
+// Languages with a script of their own are told by the script; the others
+// by how many of their stop words the text uses
+func Detect(text string) string {
+	if len(text) > sampleSize {
+		text = text[:sampleSize]
+	}
+
+	scripts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if script := scriptOf(r); script != "" {
+			scripts[script]++
+		}
+	}
+	if letters < minLetters {
+		return ""
+	}
+
+	// Japanese mixes kana into Han text, so any kana decides it
+	if scripts["kana"] > 0 && scripts["kana"]+scripts["han"] > letters/2 {
+		return "ja"
+	}
+	for script, count := range scripts {
+		if count <= letters/2 {
+			continue
+		}
+		switch script {
+		case "han":
+			return "zh"
+		case "hangul":
+			return "ko"
+		case "devanagari":
+			return "hi"
+		case "arabic":
+			return arabicLanguage(text)
+		case "cyrillic", "latin":
+			return byStopWords(text)
+		}
+	}
+	return ""
+}
+
+func scriptOf(r rune) string {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return "latin"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "cyrillic"
+	case unicode.Is(unicode.Arabic, r):
+		return "arabic"
+	case unicode.Is(unicode.Devanagari, r):
+		return "devanagari"
+	case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+		return "kana"
+	case unicode.Is(unicode.Han, r):
+		return "han"
+	case unicode.Is(unicode.Hangul, r):
+		return "hangul"
+	}
+	return ""
+}
+
+// arabicLanguage tells Arabic from Persian and Sorani Kurdish, which add
+// letters of their own to the Arabic script
+func arabicLanguage(text string) string {
+	switch {
+	case strings.ContainsAny(text, "ڕڵۆێ"):
+		return "ckb"
+	case strings.ContainsAny(text, "پچژگ"):
+		return "fa"
+	}
+	return "ar"
+}
+
+// byStopWords returns the language whose stop words make up the largest
+// share of the words of text, if that share is large enough and no other
+// language matches as many words
+func byStopWords(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	hits := make(map[string]int)
+	for _, word := range words {
+		for _, lang := range stopWordIndex[word] {
+			hits[lang]++
+		}
+	}
+
+	best, bestHits, tied := "", 0, false
+	for lang, n := range hits {
+		switch {
+		case n > bestHits:
+			best, bestHits, tied = lang, n, false
+		case n == bestHits:
+			tied = true
+		}
+	}
+	if tied || float64(bestHits)/float64(len(words)) < minStopWordShare {
+		return ""
+	}
+	return best
+}
+
+// StopWords returns the most frequent function words of a language, or nil
+// for languages told apart by script
+func StopWords(lang string) []string {
+	return stopWords[strings.ToLower(strings.TrimSpace(lang))]
+}
+
+// Resolve returns the language of a document: the language detected in its
+// text, or failing that the primary subtag of the language it declares,
+// such as "en" for "en-US"
+func Resolve(text, declared string) string {
+	if detected := Detect(text); detected != "" {
+		return detected
+	}
+	declared = strings.ToLower(strings.TrimSpace(declared))
+	primary, _, _ := strings.Cut(strings.ReplaceAll(declared, "_", "-"), "-")
+	return primary
+}
@@ -0,0 +1,51 @@
+package language
+
+import (
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
+	"github.com/blevesearch/bleve/v2/registry"
+)
+
+// SortAnalyzer is the bleve analyzer that indexes a whole field value as a
+// single lowercased term, so text fields sort by their value regardless of
+// case rather than by their first word
+const SortAnalyzer = "sort_key"
+
+// SortedFields are the text fields that documents also index with
+// SortAnalyzer, under SortField
+var SortedFields = []string{"title", "url"}
+
+// SortField returns the name of the field holding the sort key of field
+func SortField(field string) string {
+	return field + "_sort"
+}
+
+// IsSorted reports whether field is one of SortedFields
+func IsSorted(field string) bool {
+	for _, sorted := range SortedFields {
+		if field == sorted {
+			return true
+		}
+	}
+	return false
+}
+
+func sortAnalyzer(config map[string]interface{}, cache *registry.Cache) (analysis.Analyzer, error) {
+	tokenizer, err := cache.TokenizerNamed(single.Name)
+	if err != nil {
+		return nil, err
+	}
+	toLower, err := cache.TokenFilterNamed(lowercase.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &analysis.DefaultAnalyzer{
+		Tokenizer:    tokenizer,
+		TokenFilters: []analysis.TokenFilter{toLower},
+	}, nil
+}
+
+func init() {
+	registry.RegisterAnalyzer(SortAnalyzer, sortAnalyzer)
+}
@@ -1,133 +1,164 @@
 package engine
 
 import (
+	"slices"
 	"strings"
+
+	"github.com/jonesrussell/goprowl/search/engine/language"
+	"github.com/jonesrussell/goprowl/search/engine/query"
 )
 
-type QueryType int
+type QueryType = query.QueryType
 
 const (
-	TypeSimple QueryType = iota
-	TypePhrase
-	TypeFuzzy
-	TypeBoolean
+	TypeSimple   = query.TypeSimple
+	TypePhrase   = query.TypePhrase
+	TypeFuzzy    = query.TypeFuzzy
+	TypeBoolean  = query.TypeBoolean
+	TypePrefix   = query.TypePrefix
+	TypeRange    = query.TypeRange
+	TypeWildcard = query.TypeWildcard
+	TypeRegexp   = query.TypeRegexp
 )
 
 // BasicQuery implements the Query interface
 type BasicQuery struct {
-	queryTerms []*QueryTerm
-	filters    map[string]interface{}
-	pagination *Pagination
+	root         query.Node
+	filters      map[string]interface{}
+	typedFilters []*Filter // All have to match
+	pagination   *Pagination
+	highlight    *HighlightOptions
+	facets       []FacetConfig
+	collapse     string
+	explain      bool
+	sort         []SortKey
+	cursor       string
+	// maxExpansions limits the terms a pattern may match in a field
+	maxExpansions int
 }
 
 // QueryProcessor handles advanced query parsing
-type QueryProcessor struct{}
+type QueryProcessor struct {
+	parser *query.QueryProcessor
+}
 
 func NewQueryProcessor() *QueryProcessor {
-	return &QueryProcessor{}
+	return &QueryProcessor{
+		parser: query.NewQueryProcessor(),
+	}
 }
 
-// ParseQuery parses a query string into structured terms
+// ParseQuery parses a query string into a query tree
 func (p *QueryProcessor) ParseQuery(queryStr string) (*BasicQuery, error) {
-	terms := strings.Fields(queryStr)
-	var queryTerms []*QueryTerm
-
-	for i := 0; i < len(terms); i++ {
-		term := terms[i]
-
-		// Handle boolean operators
-		switch strings.ToUpper(term) {
-		case "AND":
-			if i+1 < len(terms) {
-				i++
-				queryTerms = append(queryTerms, &QueryTerm{
-					Text:     terms[i],
-					Type:     TypeSimple,
-					Required: true,
-				})
-			}
-			continue
-		case "NOT":
-			if i+1 < len(terms) {
-				i++
-				queryTerms = append(queryTerms, &QueryTerm{
-					Text:     terms[i],
-					Type:     TypeSimple,
-					Excluded: true,
-				})
-			}
-			continue
+	root, err := p.parser.ParseQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &BasicQuery{
+		filters: make(map[string]interface{}),
+		pagination: &Pagination{
+			Page: 1,
+			Size: 10,
+		},
+	}
+
+	var langs []string
+	q.root, langs = languageFilter(root)
+	switch len(langs) {
+	case 0:
+	case 1:
+		// A single language also selects the analyzer the query text is
+		// analyzed with
+		q.filters[language.Field] = langs
+	default:
+		// Every language has to match, which only the same one repeated can
+		for _, lang := range langs {
+			q.AddFilter(&Filter{Type: FilterTerm, Field: language.Field, Values: []string{lang}})
 		}
+	}
 
-		// Handle phrase matching
-		if strings.HasPrefix(term, "\"") {
-			phrase := []string{strings.TrimPrefix(term, "\"")}
-			for i++; i < len(terms); i++ {
-				phrase = append(phrase, terms[i])
-				if strings.HasSuffix(terms[i], "\"") {
-					phrase[len(phrase)-1] = strings.TrimSuffix(phrase[len(phrase)-1], "\"")
-					break
-				}
-			}
-			queryTerms = append(queryTerms, &QueryTerm{
-				Text: strings.Join(phrase, " "),
-				Type: TypePhrase,
-			})
-			continue
+	var filters []*Filter
+	q.root, filters = fieldFilters(q.root)
+	for _, filter := range filters {
+		q.AddFilter(filter)
+	}
+	return q, nil
+}
+
+// languageFilter takes the lang: terms that every result has to match off
+// the top level of a query tree, returning the rest of the tree and the
+// distinct languages the terms name. Those are the terms joined by AND, or
+// required with +, and results have to be in all of those languages. Optional terms
+// of an OR, and terms nested deeper, match the document language like any
+// other term
+func languageFilter(root query.Node) (query.Node, []string) {
+	var langs []string
+	take := func(n query.Node, all bool) bool {
+		if required, ok := n.(*query.RequiredNode); ok {
+			n, all = required.Child, true
+		}
+		term, ok := n.(*QueryTerm)
+		if !ok || !all || !isLanguageField(term.Field) {
+			return false
 		}
+		if lang := strings.ToLower(term.Text); !slices.Contains(langs, lang) {
+			langs = append(langs, lang)
+		}
+		return true
+	}
 
-		// Handle fuzzy matching
-		if strings.Contains(term, "~") {
-			parts := strings.Split(term, "~")
-			fuzziness := 1 // Default fuzziness
-			if len(parts) > 1 && parts[1] != "" {
-				fuzziness = int(parts[1][0] - '0')
+	switch n := root.(type) {
+	case *query.BooleanNode:
+		clauses := make([]query.Node, 0, len(n.Clauses))
+		for _, clause := range n.Clauses {
+			if !take(clause, n.Op == query.OpAnd) {
+				clauses = append(clauses, clause)
 			}
-			queryTerms = append(queryTerms, &QueryTerm{
-				Text:      parts[0],
-				Type:      TypeFuzzy,
-				Fuzziness: fuzziness,
-			})
-			continue
 		}
-
-		// Handle field-specific search
-		if strings.Contains(term, ":") {
-			parts := strings.Split(term, ":")
-			queryTerms = append(queryTerms, &QueryTerm{
-				Field: parts[0],
-				Text:  parts[1],
-				Type:  TypeSimple,
-			})
-			continue
+		switch len(clauses) {
+		case 0:
+			return nil, langs
+		case 1:
+			return clauses[0], langs
+		}
+		return &query.BooleanNode{Op: n.Op, Clauses: clauses}, langs
+	default:
+		if take(root, true) {
+			return nil, langs
 		}
-
-		// Simple term
-		queryTerms = append(queryTerms, &QueryTerm{
-			Text: term,
-			Type: TypeSimple,
-		})
 	}
-
-	return &BasicQuery{
-		queryTerms: queryTerms,
-		filters:    make(map[string]interface{}),
-		pagination: &Pagination{
-			Page: 1,
-			Size: 10,
-		},
-	}, nil
+	return root, langs
 }
 
 // BasicQuery implementation methods
+func (q *BasicQuery) Root() query.Node {
+	return q.root
+}
+
 func (q *BasicQuery) Terms() []*QueryTerm {
-	return q.queryTerms
+	return query.Terms(q.root)
 }
 
 func (q *BasicQuery) Filters() map[string]interface{} {
 	return q.filters
 }
 
+func (q *BasicQuery) SetFilter(key string, value interface{}) {
+	q.filters[key] = value
+}
+
+func (q *BasicQuery) Filter() *Filter {
+	return allFilters(q.typedFilters...)
+}
+
+// AddFilter restricts the results to documents also matching filter
+func (q *BasicQuery) AddFilter(filter *Filter) {
+	if filter != nil {
+		q.typedFilters = append(q.typedFilters, filter)
+	}
+}
+
 func (q *BasicQuery) Pagination() *Pagination {
 	return q.pagination
 }
@@ -138,3 +169,59 @@ func (q *BasicQuery) SetPagination(page, pageSize int) {
 		Size: pageSize,
 	}
 }
+
+func (q *BasicQuery) Highlight() *HighlightOptions {
+	return q.highlight
+}
+
+func (q *BasicQuery) SetHighlight(opts *HighlightOptions) {
+	q.highlight = opts
+}
+
+func (q *BasicQuery) Facets() []FacetConfig {
+	return q.facets
+}
+
+func (q *BasicQuery) SetFacets(facets []FacetConfig) {
+	q.facets = facets
+}
+
+func (q *BasicQuery) Collapse() string {
+	return q.collapse
+}
+
+func (q *BasicQuery) SetCollapse(field string) {
+	q.collapse = field
+}
+
+func (q *BasicQuery) Explain() bool {
+	return q.explain
+}
+
+func (q *BasicQuery) SetExplain(explain bool) {
+	q.explain = explain
+}
+
+func (q *BasicQuery) Sort() []SortKey {
+	return q.sort
+}
+
+func (q *BasicQuery) SetSort(keys []SortKey) {
+	q.sort = keys
+}
+
+func (q *BasicQuery) Cursor() string {
+	return q.cursor
+}
+
+func (q *BasicQuery) SetCursor(cursor string) {
+	q.cursor = cursor
+}
+
+func (q *BasicQuery) MaxExpansions() int {
+	return q.maxExpansions
+}
+
+func (q *BasicQuery) SetMaxExpansions(limit int) {
+	q.maxExpansions = limit
+}
@@ -0,0 +1,197 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node is an element of a parsed query tree
+type Node interface {
+	String() string
+	node()
+}
+
+// Operator joins the clauses of a BooleanNode
+type Operator int
+
+const (
+	OpOr Operator = iota
+	OpAnd
+)
+
+func (o Operator) String() string {
+	if o == OpAnd {
+		return "AND"
+	}
+	return "OR"
+}
+
+// BooleanNode combines its clauses with AND or OR. NotNode clauses are
+// always excluded and RequiredNode clauses always required, regardless of Op
+type BooleanNode struct {
+	Op      Operator
+	Clauses []Node
+}
+
+// NotNode excludes documents matching its child (NOT x, -x)
+type NotNode struct {
+	Child Node
+}
+
+// RequiredNode marks a clause that must match even inside an OR (+x)
+type RequiredNode struct {
+	Child Node
+}
+
+func (*BooleanNode) node()  {}
+func (*NotNode) node()      {}
+func (*RequiredNode) node() {}
+func (*QueryTerm) node()    {}
+
+func (n *BooleanNode) String() string {
+	parts := make([]string, len(n.Clauses))
+	for i, clause := range n.Clauses {
+		parts[i] = clause.String()
+	}
+	return "(" + strings.Join(parts, " "+n.Op.String()+" ") + ")"
+}
+
+func (n *NotNode) String() string {
+	return "-" + n.Child.String()
+}
+
+func (n *RequiredNode) String() string {
+	return "+" + n.Child.String()
+}
+
+func (t *QueryTerm) String() string {
+	var b strings.Builder
+	if t.Field != "" {
+		b.WriteString(escape(t.Field, false))
+		b.WriteByte(':')
+	}
+
+	switch t.Type {
+	case TypePhrase:
+		b.WriteString(quote(t.Text))
+		if t.Slop > 0 {
+			b.WriteByte('~')
+			b.WriteString(strconv.Itoa(t.Slop))
+		}
+	case TypeFuzzy:
+		b.WriteString(escape(t.Text, t.Field != ""))
+		b.WriteByte('~')
+		b.WriteString(strconv.Itoa(t.Fuzziness))
+	case TypePrefix:
+		b.WriteString(escape(t.Text, t.Field != ""))
+		b.WriteByte('*')
+	case TypeRange:
+		b.WriteString(t.Range.String())
+	case TypeRegexp:
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(t.Text, "/", `\/`))
+		b.WriteByte('/')
+	case TypeWildcard:
+		// The pattern keeps the escapes of its literal characters
+		b.WriteString(t.Text)
+	default:
+		b.WriteString(escape(t.Text, t.Field != ""))
+	}
+
+	if t.Boost != 0 {
+		b.WriteByte('^')
+		b.WriteString(strconv.FormatFloat(t.Boost, 'g', -1, 64))
+	}
+	return b.String()
+}
+
+// escape escapes the characters of a term that the parser would otherwise
+// read as syntax, so the term parses back to itself. Values of fields may
+// hold colons and be keywords, but may not start as ranges and comparisons
+// do
+func escape(text string, value bool) string {
+	var b strings.Builder
+	for i, r := range text {
+		escaped := (isSpecial(r) && !(value && r == ':')) || strings.ContainsRune(`\*?`, r)
+		if i == 0 && value {
+			escaped = escaped || strings.ContainsRune(`/[{<>`, r)
+		} else if i == 0 {
+			// Operators and regular expressions only open clauses
+			escaped = escaped || strings.ContainsRune(`+-/`, r) || keywordKind(text) != tokWord
+		}
+		if escaped {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// quote encloses a phrase in double quotes, escaping the quotes and
+// backslashes in it
+func quote(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	return `"` + strings.ReplaceAll(text, `"`, `\"`) + `"`
+}
+
+func (r *Range) String() string {
+	bound := func(value string) string {
+		if value == "" {
+			return "*"
+		}
+		return value
+	}
+
+	var b strings.Builder
+	if r.MinInclusive {
+		b.WriteByte('[')
+	} else {
+		b.WriteByte('{')
+	}
+	b.WriteString(bound(r.Min) + " TO " + bound(r.Max))
+	if r.MaxInclusive {
+		b.WriteByte(']')
+	} else {
+		b.WriteByte('}')
+	}
+	return b.String()
+}
+
+// Walk visits every node of the tree in depth-first order
+func Walk(n Node, fn func(Node)) {
+	if n == nil {
+		return
+	}
+	fn(n)
+
+	switch n := n.(type) {
+	case *BooleanNode:
+		for _, clause := range n.Clauses {
+			Walk(clause, fn)
+		}
+	case *NotNode:
+		Walk(n.Child, fn)
+	case *RequiredNode:
+		Walk(n.Child, fn)
+	}
+}
+
+// Terms returns the leaf terms of the tree that are not negated
+func Terms(n Node) []*QueryTerm {
+	var terms []*QueryTerm
+	var collect func(Node)
+	collect = func(n Node) {
+		switch n := n.(type) {
+		case *QueryTerm:
+			terms = append(terms, n)
+		case *BooleanNode:
+			for _, clause := range n.Clauses {
+				collect(clause)
+			}
+		case *RequiredNode:
+			collect(n.Child)
+		}
+	}
+	collect(n)
+	return terms
+}
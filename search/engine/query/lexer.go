@@ -0,0 +1,307 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokAnd
+	tokOr
+	tokNot
+	tokPlus
+	tokMinus
+	tokLParen
+	tokRParen
+	tokColon
+	tokTilde
+	tokCaret
+	tokRange
+	tokRegexp
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of query"
+	case tokWord:
+		return "term"
+	case tokPhrase:
+		return "phrase"
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	case tokNot:
+		return "NOT"
+	case tokPlus:
+		return "'+'"
+	case tokMinus:
+		return "'-'"
+	case tokLParen:
+		return "'('"
+	case tokRParen:
+		return "')'"
+	case tokColon:
+		return "':'"
+	case tokTilde:
+		return "'~'"
+	case tokCaret:
+		return "'^'"
+	case tokRange:
+		return "range"
+	case tokRegexp:
+		return "regular expression"
+	default:
+		return "unknown token"
+	}
+}
+
+// token is a lexical unit of a query string. Pos and End are byte offsets
+// into the input, used for error reporting and adjacency checks
+type token struct {
+	kind tokenKind
+	text string
+	raw  string
+	pos  int
+	end  int
+}
+
+// SyntaxError reports a malformed query along with the byte offset at which
+// the problem was detected
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// isSpecial reports whether r terminates a bare word
+func isSpecial(r rune) bool {
+	switch r {
+	case '(', ')', '"', ':', '~', '^':
+		return true
+	}
+	return unicode.IsSpace(r)
+}
+
+// lex splits a query string into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	atClauseStart := true
+
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+
+		if unicode.IsSpace(r) {
+			i += size
+			atClauseStart = true
+			continue
+		}
+
+		start := i
+		switch r {
+		case '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: start, end: start + 1})
+			i++
+			atClauseStart = true
+			continue
+		case ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: start, end: start + 1})
+			i++
+			atClauseStart = false
+			continue
+		case ':':
+			tokens = append(tokens, token{kind: tokColon, text: ":", pos: start, end: start + 1})
+			i++
+			atClauseStart = false
+			continue
+		case '~':
+			tokens = append(tokens, token{kind: tokTilde, text: "~", pos: start, end: start + 1})
+			i++
+			atClauseStart = false
+			continue
+		case '^':
+			tokens = append(tokens, token{kind: tokCaret, text: "^", pos: start, end: start + 1})
+			i++
+			atClauseStart = false
+			continue
+		case '+', '-':
+			// Prefix operators only apply at the start of a clause, so
+			// hyphenated words such as "e-mail" stay intact
+			if atClauseStart && i+1 < len(input) {
+				next, _ := utf8.DecodeRuneInString(input[i+1:])
+				if !unicode.IsSpace(next) {
+					kind := tokPlus
+					if r == '-' {
+						kind = tokMinus
+					}
+					tokens = append(tokens, token{kind: kind, text: string(r), pos: start, end: start + 1})
+					i++
+					continue
+				}
+			}
+		case '[', '{':
+			// Brackets open a range only as the value of a field, so they
+			// stay part of words elsewhere
+			if followsColon(tokens, start) {
+				text, end, err := lexRange(input, start)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, token{kind: tokRange, text: text, raw: input[start:end], pos: start, end: end})
+				i = end
+				atClauseStart = false
+				continue
+			}
+		case '/':
+			// Slashes enclose a regular expression only as a whole clause
+			// or field value, so paths such as /docs/api stay words
+			if atClauseStart || followsColon(tokens, start) {
+				if text, end, ok := lexRegexp(input, start); ok {
+					tokens = append(tokens, token{kind: tokRegexp, text: text, raw: input[start:end], pos: start, end: end})
+					i = end
+					atClauseStart = false
+					continue
+				}
+			}
+		case '"':
+			text, end, err := lexPhrase(input, start)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokPhrase, text: text, pos: start, end: end})
+			i = end
+			atClauseStart = false
+			continue
+		}
+
+		// A field value runs to the end of the word, colons included, so
+		// url:https://go.dev/doc needs no escapes
+		text, end, err := lexWord(input, start, followsColon(tokens, start))
+		if err != nil {
+			return nil, err
+		}
+		raw := input[start:end]
+		tokens = append(tokens, token{kind: keywordKind(raw), text: text, raw: raw, pos: start, end: end})
+		i = end
+		atClauseStart = false
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(input), end: len(input)})
+	return tokens, nil
+}
+
+// followsColon reports whether the last token is a colon ending at pos
+func followsColon(tokens []token, pos int) bool {
+	n := len(tokens)
+	return n > 0 && tokens[n-1].kind == tokColon && tokens[n-1].end == pos
+}
+
+// lexPhrase reads a double-quoted phrase starting at start, honoring
+// backslash escapes, and returns its unquoted text and end offset
+func lexPhrase(input string, start int) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if i+1 < len(input) {
+				i++
+				b.WriteByte(input[i])
+			}
+		case '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(input[i])
+		}
+	}
+	return "", 0, &SyntaxError{Pos: start, Msg: "unterminated phrase"}
+}
+
+// lexRange reads a bracketed range starting at start, up to the closing
+// ']' or '}', and returns the text between the brackets and its end offset
+func lexRange(input string, start int) (string, int, error) {
+	end := strings.IndexAny(input[start+1:], "]}")
+	if end < 0 {
+		return "", 0, &SyntaxError{Pos: start, Msg: "unterminated range"}
+	}
+	end += start + 1
+	return input[start+1 : end], end + 1, nil
+}
+
+// lexRegexp reads a regular expression enclosed in slashes starting at
+// start and returns it without the slashes, and its end offset. Within it
+// "\/" stands for a slash and other escapes are left to the expression. It
+// reports false when there is no closing slash ending a word
+func lexRegexp(input string, start int) (string, int, bool) {
+	var b strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if i+1 < len(input) {
+				i++
+				if input[i] != '/' {
+					b.WriteByte('\\')
+				}
+				b.WriteByte(input[i])
+			}
+		case '/':
+			if i+1 < len(input) {
+				if next, _ := utf8.DecodeRuneInString(input[i+1:]); !isSpecial(next) {
+					return "", 0, false
+				}
+			}
+			return b.String(), i + 1, true
+		default:
+			b.WriteByte(input[i])
+		}
+	}
+	return "", 0, false
+}
+
+// lexWord reads a bare word starting at start, honoring backslash escapes.
+// With colons set, colons do not end the word
+func lexWord(input string, start int, colons bool) (string, int, error) {
+	var b strings.Builder
+	i := start
+	for i < len(input) {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		if r == '\\' {
+			if i+1 >= len(input) {
+				return "", 0, &SyntaxError{Pos: i, Msg: "dangling escape character"}
+			}
+			next, nextSize := utf8.DecodeRuneInString(input[i+1:])
+			b.WriteRune(next)
+			i += 1 + nextSize
+			continue
+		}
+		if isSpecial(r) && !(colons && r == ':') {
+			break
+		}
+		b.WriteRune(r)
+		i += size
+	}
+	return b.String(), i, nil
+}
+
+// keywordKind classifies unescaped boolean keywords, which are case-insensitive
+func keywordKind(word string) tokenKind {
+	switch strings.ToUpper(word) {
+	case "AND":
+		return tokAnd
+	case "OR":
+		return tokOr
+	case "NOT":
+		return tokNot
+	}
+	return tokWord
+}
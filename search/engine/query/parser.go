@@ -0,0 +1,415 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parser is a recursive-descent parser over the token stream produced by lex.
+//
+// Grammar, from lowest to highest precedence:
+//
+//	query   := or EOF
+//	or      := and ( OR and )*
+//	and     := unary ( AND unary )*
+//	unary   := NOT unary | '+' primary | '-' primary | primary
+//	primary := '(' or ')' | field ':' ( value | range ) | value
+//	value   := ( word | phrase | regexp ) modifier*
+//	range   := ( '[' | '{' ) bound TO bound ( ']' | '}' ) | ( '>' | '>=' | '<' | '<=' ) bound
+//	modifier := '~' [number] | '^' number
+//
+// A word ending in an unescaped '*' is a prefix, and one holding other
+// unescaped '*' or '?' characters a wildcard pattern. A regexp is enclosed
+// in slashes, as in /crawl(er|ing)/. A word that is the value of a field
+// may hold colons, as in url:https://go.dev/doc
+//
+// Adjacent clauses without an explicit operator are joined with the
+// parser's default operator at that operator's precedence.
+type parser struct {
+	tokens    []token
+	pos       int
+	defaultOp Operator
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// adjacent reports whether the next token immediately follows tok
+func (p *parser) adjacent(tok token) bool {
+	return p.peek().pos == tok.end
+}
+
+// startsClause reports whether tok can begin a new clause
+func startsClause(tok token) bool {
+	switch tok.kind {
+	case tokWord, tokPhrase, tokRegexp, tokLParen, tokPlus, tokMinus, tokNot:
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parseQuery() (Node, error) {
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		if tok.kind == tokRParen {
+			return nil, p.errorf(tok.pos, "unmatched ')'")
+		}
+		return nil, p.errorf(tok.pos, "unexpected %s", tok.kind)
+	}
+	return node, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	return p.parseBinary(OpOr, tokOr, p.parseAnd)
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	return p.parseBinary(OpAnd, tokAnd, p.parseUnary)
+}
+
+// parseBinary parses a chain of operands joined by the keyword kind, or by
+// adjacency when op is the default operator
+func (p *parser) parseBinary(op Operator, kind tokenKind, operand func() (Node, error)) (Node, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := []Node{first}
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == kind:
+			p.next()
+			if !startsClause(p.peek()) {
+				return nil, p.errorf(p.peek().pos, "expected term after %s, found %s", tok.kind, p.peek().kind)
+			}
+		case op == p.defaultOp && startsClause(tok):
+		default:
+			if len(clauses) == 1 {
+				return first, nil
+			}
+			return flatten(op, clauses), nil
+		}
+
+		clause, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+}
+
+// flatten merges nested boolean nodes sharing the same operator
+func flatten(op Operator, clauses []Node) Node {
+	merged := make([]Node, 0, len(clauses))
+	for _, clause := range clauses {
+		if nested, ok := clause.(*BooleanNode); ok && nested.Op == op {
+			merged = append(merged, nested.Clauses...)
+			continue
+		}
+		merged = append(merged, clause)
+	}
+	return &BooleanNode{Op: op, Clauses: merged}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNot:
+		p.next()
+		if !startsClause(p.peek()) {
+			return nil, p.errorf(p.peek().pos, "expected term after NOT, found %s", p.peek().kind)
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotNode{Child: child}, nil
+	case tokPlus:
+		p.next()
+		child, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &RequiredNode{Child: child}, nil
+	case tokMinus:
+		p.next()
+		child, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotNode{Child: child}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokLParen:
+		return p.parseGroup()
+	case tokWord:
+		p.next()
+		if p.peek().kind == tokColon && p.adjacent(tok) {
+			return p.parseField(tok)
+		}
+		return p.parseModifiers(p.wordTerm(tok))
+	case tokPhrase:
+		p.next()
+		return p.parseModifiers(&QueryTerm{Text: tok.text, Type: TypePhrase, Pos: tok.pos})
+	case tokRegexp:
+		p.next()
+		term, err := p.regexpTerm(tok)
+		if err != nil {
+			return nil, err
+		}
+		return p.parseModifiers(term)
+	case tokEOF:
+		return nil, p.errorf(tok.pos, "unexpected end of query, expected term")
+	case tokRParen:
+		return nil, p.errorf(tok.pos, "unmatched ')'")
+	}
+	return nil, p.errorf(tok.pos, "unexpected %s, expected term", tok.kind)
+}
+
+func (p *parser) parseGroup() (Node, error) {
+	open := p.next()
+	if p.peek().kind == tokRParen {
+		return nil, p.errorf(p.peek().pos, "empty group")
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokRParen {
+		return nil, p.errorf(open.pos, "unclosed '('")
+	}
+	p.next()
+	return node, nil
+}
+
+// parseField parses the value following "field:", which may be a single
+// term, a phrase or a parenthesized group applying the field to each term
+func (p *parser) parseField(name token) (Node, error) {
+	colon := p.next()
+	if name.text == "" {
+		return nil, p.errorf(name.pos, "empty field name")
+	}
+
+	value := p.peek()
+	if !p.adjacent(colon) {
+		return nil, p.errorf(colon.end, "missing value for field %q", name.text)
+	}
+
+	switch value.kind {
+	case tokLParen:
+		group, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		Walk(group, func(n Node) {
+			if term, ok := n.(*QueryTerm); ok && term.Field == "" {
+				term.Field = name.text
+			}
+		})
+		return group, nil
+	case tokRange:
+		p.next()
+		r, err := p.parseRange(value)
+		if err != nil {
+			return nil, err
+		}
+		return p.parseModifiers(&QueryTerm{Field: name.text, Type: TypeRange, Range: r, Pos: name.pos})
+	case tokWord, tokAnd, tokOr, tokNot:
+		// Keywords directly after a colon are plain values (type:not)
+		p.next()
+		if value.kind == tokWord && strings.ContainsAny(value.raw[:1], "<>") {
+			return p.parseComparison(name, value)
+		}
+		term := p.wordTerm(value)
+		term.Field = name.text
+		term.Pos = name.pos
+		return p.parseModifiers(term)
+	case tokPhrase:
+		p.next()
+		return p.parseModifiers(&QueryTerm{Text: value.text, Field: name.text, Type: TypePhrase, Pos: name.pos})
+	case tokRegexp:
+		p.next()
+		term, err := p.regexpTerm(value)
+		if err != nil {
+			return nil, err
+		}
+		term.Field = name.text
+		term.Pos = name.pos
+		return p.parseModifiers(term)
+	}
+	return nil, p.errorf(value.pos, "missing value for field %q", name.text)
+}
+
+// parseRange parses the bounds of a bracketed range. '[' and ']' include
+// the bound next to them, '{' and '}' exclude it, and '*' leaves a side open
+func (p *parser) parseRange(tok token) (*Range, error) {
+	parts := strings.Fields(tok.text)
+	if len(parts) != 3 || !strings.EqualFold(parts[1], "TO") {
+		return nil, p.errorf(tok.pos, "invalid range %s, expected [min TO max]", tok.raw)
+	}
+
+	bound := func(value string) string {
+		if value == "*" {
+			return ""
+		}
+		return value
+	}
+	return &Range{
+		Min:          bound(parts[0]),
+		Max:          bound(parts[2]),
+		MinInclusive: tok.raw[0] == '[',
+		MaxInclusive: tok.raw[len(tok.raw)-1] == ']',
+	}, nil
+}
+
+// parseComparison parses a range bounded on one side, as in >2026-01-01 or
+// <=100. A bound holding special characters can be a phrase directly after
+// the operator, as in >"2026-01-01T12:00:00Z"
+func (p *parser) parseComparison(name, value token) (Node, error) {
+	op, bound := value.text[:1], value.text[1:]
+	if strings.HasPrefix(bound, "=") {
+		op, bound = op+"=", bound[1:]
+	}
+	if phrase := p.peek(); bound == "" && phrase.kind == tokPhrase && p.adjacent(value) {
+		p.next()
+		bound = phrase.text
+	}
+	if bound == "" {
+		return nil, p.errorf(value.end, "missing value after %q", op)
+	}
+
+	r := &Range{}
+	switch op {
+	case ">":
+		r.Min = bound
+	case ">=":
+		r.Min, r.MinInclusive = bound, true
+	case "<":
+		r.Max = bound
+	case "<=":
+		r.Max, r.MaxInclusive = bound, true
+	}
+	return p.parseModifiers(&QueryTerm{Field: name.text, Type: TypeRange, Range: r, Pos: name.pos})
+}
+
+// wordTerm builds a term from a bare word. A single unescaped '*' at its
+// end makes it a prefix query, other unescaped '*' and '?' characters a
+// wildcard query, whose pattern keeps the escapes of the word
+func (p *parser) wordTerm(tok token) *QueryTerm {
+	wildcards := unescapedWildcards(tok.raw)
+	switch {
+	case len(wildcards) == 0:
+		return &QueryTerm{Text: tok.text, Type: TypeSimple, Pos: tok.pos}
+	case tok.raw != "*" && len(wildcards) == 1 && wildcards[0] == len(tok.raw)-1 && tok.raw[wildcards[0]] == '*':
+		return &QueryTerm{Text: strings.TrimSuffix(tok.text, "*"), Type: TypePrefix, Pos: tok.pos}
+	}
+	return &QueryTerm{Text: tok.raw, Type: TypeWildcard, Pos: tok.pos}
+}
+
+// unescapedWildcards returns the offsets of the '*' and '?' characters of a
+// raw word that are not escaped
+func unescapedWildcards(raw string) []int {
+	var offsets []int
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '*', '?':
+			offsets = append(offsets, i)
+		}
+	}
+	return offsets
+}
+
+// regexpTerm builds a term from a regular expression, checking it compiles
+func (p *parser) regexpTerm(tok token) (*QueryTerm, error) {
+	if _, err := regexp.Compile(tok.text); err != nil {
+		return nil, p.errorf(tok.pos, "invalid regular expression %s: %v", tok.raw, err)
+	}
+	return &QueryTerm{Text: tok.text, Type: TypeRegexp, Pos: tok.pos}, nil
+}
+
+// parseModifiers applies the '~' and '^' suffixes directly attached to term
+func (p *parser) parseModifiers(term *QueryTerm) (Node, error) {
+	last := p.tokens[p.pos-1]
+	for p.adjacent(last) {
+		tok := p.peek()
+		switch tok.kind {
+		case tokTilde:
+			p.next()
+			if term.Type == TypePhrase {
+				term.Slop = 1 // Default slop
+				if num := p.peek(); num.kind == tokWord && p.adjacent(tok) {
+					slop, err := strconv.Atoi(num.text)
+					if err != nil || slop < 0 {
+						return nil, p.errorf(num.pos, "invalid slop %q", num.text)
+					}
+					p.next()
+					term.Slop = slop
+				}
+				break
+			}
+			if term.Type != TypeSimple {
+				return nil, p.errorf(tok.pos, "'~' cannot be applied to %s", term)
+			}
+			term.Type = TypeFuzzy
+			term.Fuzziness = 1 // Default fuzziness
+			if num := p.peek(); num.kind == tokWord && p.adjacent(tok) {
+				fuzziness, err := strconv.Atoi(num.text)
+				if err != nil || fuzziness < 0 {
+					return nil, p.errorf(num.pos, "invalid fuzziness %q", num.text)
+				}
+				p.next()
+				term.Fuzziness = fuzziness
+			}
+		case tokCaret:
+			p.next()
+			num := p.peek()
+			if num.kind != tokWord || !p.adjacent(tok) {
+				return nil, p.errorf(tok.end, "missing boost value")
+			}
+			boost, err := strconv.ParseFloat(num.text, 64)
+			if err != nil || boost <= 0 {
+				return nil, p.errorf(num.pos, "invalid boost %q", num.text)
+			}
+			p.next()
+			term.Boost = boost
+		default:
+			return term, nil
+		}
+		last = p.tokens[p.pos-1]
+	}
+	return term, nil
+}
@@ -0,0 +1,229 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"crawler", "crawler"},
+		{"web crawler", "(web OR crawler)"},
+		{"web AND crawler OR index", "((web AND crawler) OR index)"},
+		{"web AND (crawler OR index)", "(web AND (crawler OR index))"},
+		{"NOT spam", "-spam"},
+		{"+go -java", "(+go OR -java)"},
+		{"e-mail", "e-mail"},
+		{`"fast crawler"`, `"fast crawler"`},
+		{`"fast crawler"~3`, `"fast crawler"~3`},
+		{"crawler~", "crawler~1"},
+		{"crawler~2", "crawler~2"},
+		{"crawler^2.5", "crawler^2.5"},
+		{"title:go", "title:go"},
+		{"title:(go rust)", "(title:go OR title:rust)"},
+		{"type:not", "type:not"},
+		{"url:https://go.dev/doc", "url:https://go.dev/doc"},
+		{`url:https\://go.dev/doc`, "url:https://go.dev/doc"},
+		{"url:https://go.dev/doc/*", "url:https://go.dev/doc/*"},
+		{"craw*", "craw*"},
+		{"c?awl*", "c?awl*"},
+		{"*", "*"},
+		{"title:*", "title:*"},
+		{`\*`, `\*`},
+		{`foo\*`, `foo\*`},
+		{`foo\*bar*`, `foo\*bar*`},
+		{"/crawl(er|ing)/", "/crawl(er|ing)/"},
+		{`title:/a\/b/`, `title:/a\/b/`},
+		{"/docs/api", `\/docs/api`},
+		{"size:[1000 TO 50000]", "size:[1000 TO 50000]"},
+		{"size:{* TO 100]", "size:{* TO 100]"},
+		{"created:>2026-01-01", "created:{2026-01-01 TO *}"},
+		{"created:<=now-7d", "created:{* TO now-7d]"},
+		{`created:>"2026-01-01T12:00:00Z"`, "created:{2026-01-01T12:00:00Z TO *}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			node, err := NewQueryProcessor().ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error: %v", tt.query, err)
+			}
+			if got := node.String(); got != tt.want {
+				t.Errorf("ParseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryTypes(t *testing.T) {
+	tests := []struct {
+		query string
+		typ   QueryType
+		text  string
+	}{
+		{"crawler", TypeSimple, "crawler"},
+		{`"fast crawler"`, TypePhrase, "fast crawler"},
+		{"crawler~2", TypeFuzzy, "crawler"},
+		{"craw*", TypePrefix, "craw"},
+		{`craw\*`, TypeSimple, "craw*"},
+		{"c?awl*", TypeWildcard, "c?awl*"},
+		{"*crawl", TypeWildcard, "*crawl"},
+		{"*", TypeWildcard, "*"},
+		{`\*`, TypeSimple, "*"},
+		{"/crawl(er|ing)/", TypeRegexp, "crawl(er|ing)"},
+		{"/docs/api", TypeSimple, "/docs/api"},
+		{"url:https://go.dev/doc", TypeSimple, "https://go.dev/doc"},
+		{"size:[1 TO 2]", TypeRange, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			node, err := NewQueryProcessor().ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error: %v", tt.query, err)
+			}
+			term, ok := node.(*QueryTerm)
+			if !ok {
+				t.Fatalf("ParseQuery(%q) = %s, want a term", tt.query, node)
+			}
+			if term.Type != tt.typ || term.Text != tt.text {
+				t.Errorf("ParseQuery(%q) = type %d text %q, want type %d text %q", tt.query, term.Type, term.Text, tt.typ, tt.text)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"(crawler", 0},
+		{"crawler)", 7},
+		{`"fast crawler`, 0},
+		{"crawler AND", 11},
+		{"NOT", 3},
+		{"title:", 6},
+		{"crawler^", 8},
+		{"crawler^x", 8},
+		{`"fast crawler"~x`, 15},
+		{"craw*~2", 5},
+		{"size:[1 TO]", 5},
+		{"size:[1 TO 2", 5},
+		{"created:>", 9},
+		{"/(/", 0},
+		{`crawler\`, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := NewQueryProcessor().ParseQuery(tt.query)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("ParseQuery(%q) error = %v, want a *SyntaxError", tt.query, err)
+			}
+			if syntaxErr.Pos != tt.pos {
+				t.Errorf("ParseQuery(%q) error at %d, want %d: %v", tt.query, syntaxErr.Pos, tt.pos, err)
+			}
+		})
+	}
+}
+
+func TestParseQueryDefaultOperator(t *testing.T) {
+	processor := NewQueryProcessor()
+	processor.DefaultOperator = OpAnd
+
+	node, err := processor.ParseQuery("web crawler OR index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := node.String(), "((web AND crawler) OR index)"; got != want {
+		t.Errorf("ParseQuery = %s, want %s", got, want)
+	}
+}
+
+// TestStringRoundTrip checks that the string form of a parsed query parses
+// back to the same query
+func TestStringRoundTrip(t *testing.T) {
+	queries := []string{
+		"web crawler",
+		"+go -java NOT rust",
+		`"say \"hi\" \\ now"~2`,
+		`foo\*`,
+		`foo\?bar`,
+		`\AND`,
+		`\-5`,
+		`a\(b\)`,
+		`a\:b`,
+		`a\~b^2`,
+		"crawler~2^3",
+		"craw*",
+		`craw\ ler*`,
+		"c?awl*",
+		`c\?awl*`,
+		"* -spam",
+		"title:*",
+		"/crawl(er|ing)/",
+		`/a\/b/`,
+		`title:\/docs`,
+		`title:\[draft`,
+		`title:\<b`,
+		"url:https://go.dev/doc/*",
+		"size:[1000 TO *] created:<now-7d",
+		"(a OR b) AND (c OR -d)",
+	}
+
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			first, err := NewQueryProcessor().ParseQuery(q)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error: %v", q, err)
+			}
+			printed := first.String()
+			second, err := NewQueryProcessor().ParseQuery(printed)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q), from %q, error: %v", printed, q, err)
+			}
+			if got := second.String(); got != printed {
+				t.Errorf("%q printed as %s, which parses to %s", q, printed, got)
+			}
+			if !sameTree(first, second) {
+				t.Errorf("%q printed as %s, which parses to a different tree", q, printed)
+			}
+		})
+	}
+}
+
+// sameTree reports whether two trees are equal, ignoring positions
+func sameTree(a, b Node) bool {
+	switch a := a.(type) {
+	case *QueryTerm:
+		b, ok := b.(*QueryTerm)
+		if !ok || (a.Range == nil) != (b.Range == nil) || (a.Range != nil && *a.Range != *b.Range) {
+			return false
+		}
+		return a.Text == b.Text && a.Field == b.Field && a.Type == b.Type &&
+			a.Fuzziness == b.Fuzziness && a.Slop == b.Slop && a.Boost == b.Boost
+	case *NotNode:
+		b, ok := b.(*NotNode)
+		return ok && sameTree(a.Child, b.Child)
+	case *RequiredNode:
+		b, ok := b.(*RequiredNode)
+		return ok && sameTree(a.Child, b.Child)
+	case *BooleanNode:
+		b, ok := b.(*BooleanNode)
+		if !ok || a.Op != b.Op || len(a.Clauses) != len(b.Clauses) {
+			return false
+		}
+		for i := range a.Clauses {
+			if !sameTree(a.Clauses[i], b.Clauses[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -1,9 +1,5 @@
 package query
 
-import (
-	"strings"
-)
-
 type QueryType int
 
 const (
@@ -11,109 +7,62 @@ const (
 	TypePhrase
 	TypeFuzzy
 	TypeBoolean
+	TypePrefix
+	TypeRange
+	TypeWildcard
+	TypeRegexp
 )
 
+// QueryTerm is a leaf of the query tree
 type QueryTerm struct {
-	Text      string
+	Text      string // For wildcards and regular expressions, the pattern
 	Field     string
 	Type      QueryType
 	Fuzziness int     // For fuzzy matching
-	Required  bool    // For boolean AND
-	Excluded  bool    // For boolean NOT
-	Boost     float64 // Term importance
+	Slop      int     // For phrases, how far apart their terms may be
+	Boost     float64 // Term importance, zero when unset
+	Pos       int     // Byte offset of the term in the query string
+	Range     *Range  // For ranges, the bounds of the field's value
 }
 
-type QueryProcessor struct {
-	// Remove unused fields and add any necessary state here
+// MatchesAll reports whether the term is a bare "*", which matches every
+// document, or with a field every document with a value for it
+func (t *QueryTerm) MatchesAll() bool {
+	return t.Type == TypeWildcard && t.Text == "*"
 }
 
-func NewQueryProcessor() *QueryProcessor {
-	return &QueryProcessor{}
+// Range bounds the value of a field, as in size:[1000 TO 50000] or
+// created:>2026-01-01. Bounds are numbers or dates, left for the search
+// engine to interpret, and an empty bound leaves that side open
+type Range struct {
+	Min          string
+	Max          string
+	MinInclusive bool
+	MaxInclusive bool
 }
 
-// ParseQuery is a more descriptive name than just Parse
-func (p *QueryProcessor) ParseQuery(queryString string) ([]*QueryTerm, error) {
-	terms := strings.Fields(queryString)
-	var queryTerms []*QueryTerm
-
-	for i := 0; i < len(terms); i++ {
-		term := terms[i]
-
-		// Handle boolean operators
-		switch strings.ToUpper(term) {
-		case "AND":
-			if i+1 < len(terms) {
-				i++
-				queryTerms = append(queryTerms, &QueryTerm{
-					Text:     terms[i],
-					Required: true,
-					Type:     TypeSimple,
-				})
-			}
-			continue
-		case "OR":
-			continue
-		case "NOT":
-			if i+1 < len(terms) {
-				i++
-				queryTerms = append(queryTerms, &QueryTerm{
-					Text:     terms[i],
-					Excluded: true,
-					Type:     TypeSimple,
-				})
-			}
-			continue
-		}
-
-		// Handle phrase matching
-		if strings.HasPrefix(term, "\"") {
-			phrase := []string{strings.TrimPrefix(term, "\"")}
-			for i++; i < len(terms); i++ {
-				phrase = append(phrase, terms[i])
-				if strings.HasSuffix(terms[i], "\"") {
-					phrase[len(phrase)-1] = strings.TrimSuffix(phrase[len(phrase)-1], "\"")
-					break
-				}
-			}
-			queryTerms = append(queryTerms, &QueryTerm{
-				Text: strings.Join(phrase, " "),
-				Type: TypePhrase,
-			})
-			continue
-		}
-
-		// Handle fuzzy matching
-		if strings.Contains(term, "~") {
-			parts := strings.Split(term, "~")
-			fuzziness := 1 // Default fuzziness
-			if len(parts) > 1 && parts[1] != "" {
-				fuzziness = int(parts[1][0] - '0')
-			}
-			queryTerms = append(queryTerms, &QueryTerm{
-				Text:      parts[0],
-				Type:      TypeFuzzy,
-				Fuzziness: fuzziness,
-			})
-			continue
-		}
+type QueryProcessor struct {
+	// DefaultOperator joins adjacent clauses that have no explicit operator
+	DefaultOperator Operator
+}
 
-		// Handle field-specific search
-		if strings.Contains(term, ":") {
-			parts := strings.Split(term, ":")
-			queryTerms = append(queryTerms, &QueryTerm{
-				Field: parts[0],
-				Text:  parts[1],
-				Type:  TypeSimple,
-			})
-			continue
-		}
+func NewQueryProcessor() *QueryProcessor {
+	return &QueryProcessor{
+		DefaultOperator: OpOr,
+	}
+}
 
-		// Simple term
-		queryTerms = append(queryTerms, &QueryTerm{
-			Text: term,
-			Type: TypeSimple,
-		})
+// ParseQuery parses a query string into a query tree. An empty query yields
+// a nil tree; malformed queries return a *SyntaxError
+func (p *QueryProcessor) ParseQuery(queryString string) (Node, error) {
+	tokens, err := lex(queryString)
+	if err != nil {
+		return nil, err
 	}
 
-	return queryTerms, nil
+	parser := &parser{
+		tokens:    tokens,
+		defaultOp: p.DefaultOperator,
+	}
+	return parser.parseQuery()
 }
@@ -0,0 +1,30 @@
+package engine
+
+import "testing"
+
+func TestLanguageFilter(t *testing.T) {
+	e := newTestEngine(t)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"+lang:fr", []string{produit}},
+		{"crawler +lang:en", []string{article, news}},
+		{"crawler AND lang:en", []string{article, news}},
+		// Every required language has to match
+		{"+lang:en +lang:fr", []string{}},
+		{"lang:en AND lang:fr", []string{}},
+		{"+lang:fr +lang:FR", []string{produit}},
+		// Optional language terms rank rather than filter
+		{"crawler lang:fr", []string{article, news, produit}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := searchURLs(t, e, tt.query); !equalStrings(got, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
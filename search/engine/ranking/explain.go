@@ -0,0 +1,83 @@
+package ranking
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Explanation is a node of the tree showing how a score was computed: its
+// value, what the value is, and the values it was computed from
+type Explanation struct {
+	Value       float64        `json:"value"`
+	Description string         `json:"description"`
+	Children    []*Explanation `json:"children,omitempty"`
+}
+
+// Explain creates an explanation node
+func Explain(value float64, description string, children ...*Explanation) *Explanation {
+	return &Explanation{Value: value, Description: description, Children: children}
+}
+
+// Sum explains a score that is the sum of parts
+func Sum(description string, parts []*Explanation) *Explanation {
+	total := 0.0
+	for _, part := range parts {
+		total += part.Value
+	}
+	return Explain(total, description, parts...)
+}
+
+// Tree renders the explanation as an indented tree, one node per line
+func (e *Explanation) Tree() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return b.String()
+}
+
+func (e *Explanation) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%s %s\n", strings.Repeat("  ", depth), formatValue(e.Value), e.Description)
+	for _, child := range e.Children {
+		child.write(b, depth+1)
+	}
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// Explain explains the BM25 score of a document the way Score computes it
+func (r *Ranker) Explain(tf float64, docLength, avgDocLength float64,
+	docsWithTerm, totalDocs int64) *Explanation {
+	idf := r.explainIDF(docsWithTerm, totalDocs)
+	norm := r.explainNorm(docLength, avgDocLength)
+	return Explain(r.Score(tf, docLength, avgDocLength, docsWithTerm, totalDocs),
+		fmt.Sprintf("bm25, idf * tf * (k1 + 1) / (tf + k1 * norm), k1 %g", r.k1),
+		idf,
+		Explain(tf, "tf, term frequency"),
+		norm,
+	)
+}
+
+func (r *Ranker) explainIDF(docsWithTerm, totalDocs int64) *Explanation {
+	return Explain(r.IDF(docsWithTerm, totalDocs),
+		fmt.Sprintf("idf, log(1 + (N - n + 0.5) / (n + 0.5)), n %d documents with the term of N %d", docsWithTerm, totalDocs))
+}
+
+func (r *Ranker) explainNorm(length, avgLength float64) *Explanation {
+	return Explain(1-r.b+r.b*lengthRatio(length, avgLength),
+		fmt.Sprintf("norm, length normalization 1 - b + b * length / average, b %g, length %g, average %s", r.b, length, formatValue(avgLength)))
+}
+
+// ExplainBoosts explains BoostScore: the boosted score as the product of
+// the score and the boosts applied to it
+func ExplainBoosts(score *Explanation, boosted float64, boosts []Boost) *Explanation {
+	if len(boosts) == 0 {
+		return score
+	}
+	children := []*Explanation{score}
+	for _, boost := range boosts {
+		children = append(children, Explain(boost.Factor, "boost "+boost.Name))
+	}
+	return Explain(boosted, "boosted score, product of:", children...)
+}
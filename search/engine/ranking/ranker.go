@@ -2,6 +2,7 @@ package ranking
 
 import (
 	"math"
+	"sort"
 )
 
 // Ranker handles document scoring and ranking
@@ -18,24 +19,75 @@ func New() *Ranker {
 	}
 }
 
+// IDF returns the BM25 inverse document frequency of a term
+func (r *Ranker) IDF(docsWithTerm, totalDocs int64) float64 {
+	return math.Log(1 + (float64(totalDocs)-float64(docsWithTerm)+0.5)/
+		(float64(docsWithTerm)+0.5))
+}
+
 // Score calculates BM25 score for a document
-func (r *Ranker) Score(tf int, docLength, avgDocLength float64,
+func (r *Ranker) Score(tf float64, docLength, avgDocLength float64,
 	docsWithTerm, totalDocs int64) float64 {
 	// BM25 scoring formula
-	idf := math.Log(1 + (float64(totalDocs)-float64(docsWithTerm)+0.5)/
-		(float64(docsWithTerm)+0.5))
+	idf := r.IDF(docsWithTerm, totalDocs)
 
-	numerator := float64(tf) * (r.k1 + 1)
-	denominator := float64(tf) + r.k1*(1-r.b+r.b*docLength/avgDocLength)
+	numerator := tf * (r.k1 + 1)
+	denominator := tf + r.k1*(1-r.b+r.b*lengthRatio(docLength, avgDocLength))
 
 	return idf * numerator / denominator
 }
 
-// BoostScore applies custom boosting factors
-func (r *Ranker) BoostScore(score float64, boostFactors map[string]float64) float64 {
+// Boost is a named factor applied to a score
+type Boost struct {
+	Name   string  `json:"name"`
+	Factor float64 `json:"factor"`
+}
+
+// BoostScore applies custom boosting factors and returns the boosted score
+// with the boosts that changed it, ordered by name
+func (r *Ranker) BoostScore(score float64, boostFactors map[string]float64) (float64, []Boost) {
 	finalScore := score
-	for _, boost := range boostFactors {
+	var applied []Boost
+	for name, boost := range boostFactors {
+		if boost == 1 {
+			continue
+		}
 		finalScore *= boost
+		applied = append(applied, Boost{Name: name, Factor: boost})
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Name < applied[j].Name
+	})
+	return finalScore, applied
+}
+
+// Freshness returns a boost factor for a document of the given age that
+// starts at 1+weight and halves its excess over 1 every halfLife days
+func Freshness(ageDays, halfLifeDays, weight float64) float64 {
+	if ageDays < 0 {
+		ageDays = 0
+	}
+	if halfLifeDays <= 0 {
+		return 1
+	}
+	return 1 + weight*math.Pow(0.5, ageDays/halfLifeDays)
+}
+
+// Authority returns a boost factor for a document linked to from inlinks
+// pages, growing logarithmically so heavily linked pages do not drown out
+// relevance
+func Authority(inlinks int, weight float64) float64 {
+	if inlinks <= 0 {
+		return 1
+	}
+	return 1 + weight*math.Log1p(float64(inlinks))
+}
+
+// lengthRatio returns how long a field is against the average, 1 when
+// there is no average to compare with
+func lengthRatio(length, avgLength float64) float64 {
+	if avgLength <= 0 {
+		return 1
 	}
-	return finalScore
+	return length / avgLength
 }
@@ -0,0 +1,184 @@
+package ranking
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FieldStats describes the occurrences of a query term in one field of a
+// document
+type FieldStats struct {
+	Field string
+	// Frequency is how often the term occurs. Sloppy phrase matches count
+	// for less than one
+	Frequency float64
+	// Length is the length of the field in tokens
+	Length float64
+	// AvgLength is the average length of the field over the documents
+	// that have it
+	AvgLength float64
+}
+
+// TermStats describes the occurrences of a query term in a document
+type TermStats struct {
+	// Fields are the searched fields the term occurs in
+	Fields []FieldStats
+	// DocsWithTerm is the number of documents the term occurs in
+	DocsWithTerm int64
+	// TotalDocs is the number of documents in the index
+	TotalDocs int64
+}
+
+// Scorer scores how well a document matches a query term. The score of a
+// document is the sum of the scores of the query terms it matches
+type Scorer interface {
+	Score(stats TermStats) float64
+	// Explain returns how Score computes the score of stats
+	Explain(stats TermStats) *Explanation
+}
+
+// Scorer names, for selecting a scorer by configuration
+const (
+	ScorerBM25  = "bm25"
+	ScorerBM25F = "bm25f"
+	ScorerTFIDF = "tfidf"
+)
+
+// NewScorer returns the scorer with the given name. fieldWeights are the
+// BM25F field weights and are ignored by the other scorers
+func NewScorer(name string, fieldWeights map[string]float64) (Scorer, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", ScorerBM25:
+		return NewBM25(), nil
+	case ScorerBM25F:
+		return NewBM25F(fieldWeights), nil
+	case ScorerTFIDF:
+		return TFIDF{}, nil
+	}
+	return nil, fmt.Errorf("unknown scorer %q (want %s, %s or %s)", name, ScorerBM25, ScorerBM25F, ScorerTFIDF)
+}
+
+// BM25 scores every field on its own with the Okapi BM25 formula and adds
+// the field scores up
+type BM25 struct {
+	Ranker *Ranker
+}
+
+// NewBM25 creates a BM25 scorer with the default parameters
+func NewBM25() *BM25 {
+	return &BM25{Ranker: New()}
+}
+
+func (s *BM25) Score(stats TermStats) float64 {
+	score := 0.0
+	for _, field := range stats.Fields {
+		score += s.Ranker.Score(field.Frequency, field.Length, field.AvgLength,
+			stats.DocsWithTerm, stats.TotalDocs)
+	}
+	return score
+}
+
+func (s *BM25) Explain(stats TermStats) *Explanation {
+	fields := make([]*Explanation, len(stats.Fields))
+	for i, field := range stats.Fields {
+		fields[i] = s.Ranker.Explain(field.Frequency, field.Length, field.AvgLength,
+			stats.DocsWithTerm, stats.TotalDocs)
+		fields[i].Description = "field " + field.Field + ", " + fields[i].Description
+	}
+	return Sum("bm25, sum of fields:", fields)
+}
+
+// BM25F combines the length-normalized frequencies of a term in all fields,
+// each multiplied by the field's weight, before saturating them once. A term
+// repeated across fields so counts for less than under BM25, while a match
+// in a heavily weighted field such as the title counts for more
+type BM25F struct {
+	Ranker *Ranker
+	// Weights are the field weights; fields not listed weigh 1
+	Weights map[string]float64
+}
+
+// NewBM25F creates a BM25F scorer with the default parameters
+func NewBM25F(weights map[string]float64) *BM25F {
+	return &BM25F{Ranker: New(), Weights: weights}
+}
+
+func (s *BM25F) Score(stats TermStats) float64 {
+	r := s.Ranker
+	tf := 0.0
+	for _, field := range stats.Fields {
+		tf += s.weight(field.Field) * field.Frequency / (1 - r.b + r.b*lengthRatio(field.Length, field.AvgLength))
+	}
+	if tf == 0 {
+		return 0
+	}
+	return r.IDF(stats.DocsWithTerm, stats.TotalDocs) * tf * (r.k1 + 1) / (r.k1 + tf)
+}
+
+func (s *BM25F) Explain(stats TermStats) *Explanation {
+	r := s.Ranker
+	fields := make([]*Explanation, len(stats.Fields))
+	for i, field := range stats.Fields {
+		weight := s.weight(field.Field)
+		norm := r.explainNorm(field.Length, field.AvgLength)
+		fields[i] = Explain(weight*field.Frequency/norm.Value,
+			"field "+field.Field+", weight * tf / norm",
+			Explain(weight, "weight"),
+			Explain(field.Frequency, "tf, term frequency"),
+			norm,
+		)
+	}
+	tf := Sum("tf, weighted and normalized term frequency, sum of fields:", fields)
+	return Explain(s.Score(stats),
+		fmt.Sprintf("bm25f, idf * tf * (k1 + 1) / (k1 + tf), k1 %g", r.k1),
+		r.explainIDF(stats.DocsWithTerm, stats.TotalDocs),
+		tf,
+	)
+}
+
+func (s *BM25F) weight(field string) float64 {
+	if weight, ok := s.Weights[field]; ok {
+		return weight
+	}
+	return 1
+}
+
+// TFIDF is the classic vector space weighting: the square root of the term
+// frequency, normalized by the square root of the field length, times the
+// inverse document frequency, summed over fields
+type TFIDF struct{}
+
+func (TFIDF) Score(stats TermStats) float64 {
+	idf := tfidfIDF(stats)
+	score := 0.0
+	for _, field := range stats.Fields {
+		if field.Length <= 0 {
+			continue
+		}
+		score += math.Sqrt(field.Frequency) / math.Sqrt(field.Length) * idf
+	}
+	return score
+}
+
+func (TFIDF) Explain(stats TermStats) *Explanation {
+	idf := Explain(tfidfIDF(stats),
+		fmt.Sprintf("idf, 1 + log(N / (n + 1)), n %d documents with the term of N %d", stats.DocsWithTerm, stats.TotalDocs))
+	var fields []*Explanation
+	for _, field := range stats.Fields {
+		if field.Length <= 0 {
+			continue
+		}
+		fields = append(fields, Explain(math.Sqrt(field.Frequency)/math.Sqrt(field.Length)*idf.Value,
+			"field "+field.Field+", sqrt(tf) * norm * idf",
+			Explain(field.Frequency, "tf, term frequency"),
+			Explain(1/math.Sqrt(field.Length), fmt.Sprintf("norm, 1 / sqrt(length), length %g", field.Length)),
+			idf,
+		))
+	}
+	return Sum("tf-idf, sum of fields:", fields)
+}
+
+func tfidfIDF(stats TermStats) float64 {
+	return 1 + math.Log(float64(stats.TotalDocs)/float64(stats.DocsWithTerm+1))
+}
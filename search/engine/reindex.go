@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/jonesrussell/goprowl/search/storage"
+	blevestorage "github.com/jonesrussell/goprowl/search/storage/bleve"
+)
+
+// reindexBatchSize is the number of documents indexed per bleve batch
+const reindexBatchSize = 500
+
+// ReindexingStorage is implemented by storage adapters that maintain their
+// own index and can rebuild it in place
+type ReindexingStorage interface {
+	Reindex(ctx context.Context) error
+}
+
+// ConsistencyReport lists the documents storage and the search index
+// disagree on
+type ConsistencyReport struct {
+	StorageDocuments   int      `json:"storage_documents"`
+	IndexDocuments     int      `json:"index_documents"`
+	MissingFromIndex   []string `json:"missing_from_index"`   // Stored but not searchable
+	MissingFromStorage []string `json:"missing_from_storage"` // Searchable but no longer stored
+}
+
+// Consistent reports whether storage and the index hold the same documents
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.MissingFromIndex) == 0 && len(r.MissingFromStorage) == 0
+}
+
+// Reindex rebuilds the search index from storage under the current mapping.
+// Searches are answered by the old index until the new one is complete, and
+// writes made in the meantime are replayed into it before the swap
+func (e *BasicSearchEngine) Reindex(ctx context.Context) error {
+	if reindexing, ok := e.storage.(ReindexingStorage); ok {
+		if err := reindexing.Reindex(ctx); err != nil {
+			return fmt.Errorf("failed to reindex storage: %w", err)
+		}
+		e.stats.LastIndexed = time.Now()
+		return nil
+	}
+
+	e.mu.Lock()
+	if e.pending != nil {
+		e.mu.Unlock()
+		return storage.ErrReindexInProgress
+	}
+	e.pending = make(map[string]struct{})
+	e.mu.Unlock()
+
+	index, err := e.buildIndex(ctx)
+	if err != nil {
+		e.mu.Lock()
+		e.pending = nil
+		e.mu.Unlock()
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pending := e.pending
+	e.pending = nil
+
+	if err := e.replay(ctx, index, pending); err != nil {
+		index.Close()
+		return err
+	}
+
+	old := e.index
+	e.index = index
+	if err := old.Close(); err != nil {
+		return fmt.Errorf("failed to close old index: %w", err)
+	}
+
+	e.stats.LastIndexed = time.Now()
+	return nil
+}
+
+// buildIndex indexes every stored document into a new in-memory index
+func (e *BasicSearchEngine) buildIndex(ctx context.Context) (bleve.Index, error) {
+	docs, err := e.storage.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	index, err := bleve.NewMemOnly(blevestorage.NewMapping())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	for start := 0; start < len(docs); start += reindexBatchSize {
+		if err := ctx.Err(); err != nil {
+			index.Close()
+			return nil, err
+		}
+
+		batch := index.NewBatch()
+		for _, doc := range docs[start:min(start+reindexBatchSize, len(docs))] {
+			if err := batch.Index(doc.URL, blevestorage.DocumentFields(doc)); err != nil {
+				index.Close()
+				return nil, fmt.Errorf("failed to add document %s to batch: %w", doc.URL, err)
+			}
+		}
+		if err := index.Batch(batch); err != nil {
+			index.Close()
+			return nil, fmt.Errorf("failed to index documents: %w", err)
+		}
+	}
+
+	return index, nil
+}
+
+// replay brings documents written during a rebuild up to date in index
+func (e *BasicSearchEngine) replay(ctx context.Context, index bleve.Index, ids map[string]struct{}) error {
+	batch := index.NewBatch()
+	for id := range ids {
+		doc, err := e.storage.Get(ctx, id)
+		switch {
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			batch.Delete(id)
+		case err != nil:
+			return fmt.Errorf("failed to read document %s: %w", id, err)
+		default:
+			if err := batch.Index(id, blevestorage.DocumentFields(doc)); err != nil {
+				return fmt.Errorf("failed to add document %s to batch: %w", id, err)
+			}
+		}
+	}
+
+	if err := index.Batch(batch); err != nil {
+		return fmt.Errorf("failed to replay writes made during reindex: %w", err)
+	}
+	return nil
+}
+
+// CheckConsistency compares the documents in storage with those in the
+// search index. A storage adapter with its own index answers both sides from
+// it, so only documents stored without a URL can show up there
+func (e *BasicSearchEngine) CheckConsistency(ctx context.Context) (*ConsistencyReport, error) {
+	docs, err := e.storage.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	indexed, err := e.indexedIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		stored[doc.URL] = true
+	}
+
+	report := &ConsistencyReport{
+		StorageDocuments:   len(stored),
+		IndexDocuments:     len(indexed),
+		MissingFromIndex:   []string{},
+		MissingFromStorage: []string{},
+	}
+	for id := range stored {
+		if !indexed[id] {
+			report.MissingFromIndex = append(report.MissingFromIndex, id)
+		}
+	}
+	for id := range indexed {
+		if !stored[id] {
+			report.MissingFromStorage = append(report.MissingFromStorage, id)
+		}
+	}
+	sort.Strings(report.MissingFromIndex)
+	sort.Strings(report.MissingFromStorage)
+
+	return report, nil
+}
+
+// indexedIDs returns the ID of every document in the search index
+func (e *BasicSearchEngine) indexedIDs(ctx context.Context) (map[string]bool, error) {
+	ids := make(map[string]bool)
+
+	var after []string
+	for {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), reindexBatchSize, 0, false)
+		req.SortBy([]string{"_id"})
+		if after != nil {
+			req.SetSearchAfter(after)
+		}
+
+		result, err := e.searchIndex(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexed documents: %w", err)
+		}
+
+		for _, hit := range result.Hits {
+			ids[hit.ID] = true
+		}
+
+		if len(result.Hits) < reindexBatchSize {
+			return ids, nil
+		}
+		after = []string{result.Hits[len(result.Hits)-1].ID}
+	}
+}
@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/jonesrussell/goprowl/search/engine/language"
+)
+
+// Sort fields that are not document fields
+const (
+	SortScore = "_score" // Relevance
+	SortID    = "_id"    // Document ID, the final tie-breaker of every sort
+)
+
+// ErrInvalidSort is returned when a sort names no field or an unknown order
+var ErrInvalidSort = errors.New("invalid sort")
+
+// ErrInvalidCursor is returned when a cursor is malformed, was returned by a
+// search with a different sort, or is used with collapsed results
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortAliases maps the names sorts may use for fields to the fields sorted on.
+// Titles and URLs sort on their whole lowercased value
+var sortAliases = map[string]string{
+	"score":         SortScore,
+	"relevance":     SortScore,
+	"id":            SortID,
+	"created":       "created_at",
+	"modified":      "modified_at",
+	"last_modified": "modified_at",
+	"last-modified": "modified_at",
+	"title":         language.SortField("title"),
+	"url":           language.SortField("url"),
+}
+
+// SortKey orders results by the value of a field. Documents without a
+// value come last in either direction
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// String returns the key the way ParseSort accepts it
+func (k SortKey) String() string {
+	if k.Desc {
+		return "-" + k.Field
+	}
+	return k.Field
+}
+
+// ParseSort parses a comma-separated list of sort keys, the first deciding
+// the order and each next one breaking ties left by those before it. A key
+// is a field name, such as created_at or a numeric metadata field, or one of
+// score, id, created, modified, title and url. A "-" prefix or ":desc"
+// suffix sorts a key in descending order, a "+" prefix or ":asc" suffix in
+// ascending order. Keys without either sort in order, "asc" or "desc", or
+// when order is empty, score descending and every other field ascending
+func ParseSort(spec, order string) ([]SortKey, error) {
+	defaultDesc, hasDefault := false, strings.TrimSpace(order) != ""
+	if hasDefault {
+		var err error
+		if defaultDesc, err = sortDirection(order); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var keys []SortKey
+	for _, part := range strings.Split(spec, ",") {
+		name := strings.TrimSpace(part)
+		desc, explicit := false, true
+		switch {
+		case strings.HasPrefix(name, "-"):
+			desc, name = true, name[1:]
+		case strings.HasPrefix(name, "+"):
+			name = name[1:]
+		default:
+			field, dir, ok := strings.Cut(name, ":")
+			if !ok {
+				explicit = false
+				break
+			}
+			var err error
+			if desc, err = sortDirection(dir); err != nil {
+				return nil, err
+			}
+			name = field
+		}
+
+		field := strings.ToLower(strings.TrimSpace(name))
+		if alias, ok := sortAliases[field]; ok {
+			field = alias
+		}
+		if !isSortField(field) {
+			return nil, fmt.Errorf("%w: %q is not a field", ErrInvalidSort, part)
+		}
+
+		if !explicit {
+			desc = field == SortScore
+			if hasDefault {
+				desc = defaultDesc
+			}
+		}
+		keys = append(keys, SortKey{Field: field, Desc: desc})
+	}
+	return keys, nil
+}
+
+// sortDirection parses "asc" or "desc", reporting whether it is descending
+func sortDirection(dir string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(dir)) {
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	}
+	return false, fmt.Errorf("%w: unknown order %q (want asc or desc)", ErrInvalidSort, dir)
+}
+
+// isSortField reports whether field is a usable field name
+func isSortField(field string) bool {
+	if field == "" {
+		return false
+	}
+	for _, r := range field {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// sortKeys completes the sort of a query: by score when it has none, and
+// always ending with the document ID so every result has a fixed place
+// that a cursor can resume after
+func sortKeys(keys []SortKey) []SortKey {
+	if len(keys) == 0 {
+		keys = []SortKey{{Field: SortScore, Desc: true}}
+	}
+	for _, key := range keys {
+		if key.Field == SortID {
+			return keys
+		}
+	}
+	return append(keys[:len(keys):len(keys)], SortKey{Field: SortID})
+}
+
+// sortOrder converts sort keys to a bleve sort order
+func sortOrder(keys []SortKey) search.SortOrder {
+	order := make(search.SortOrder, len(keys))
+	for i, key := range keys {
+		switch key.Field {
+		case SortScore:
+			order[i] = &search.SortScore{Desc: key.Desc}
+		case SortID:
+			order[i] = &search.SortDocID{Desc: key.Desc}
+		default:
+			order[i] = &search.SortField{
+				Field:   key.Field,
+				Desc:    key.Desc,
+				Missing: search.SortFieldMissingLast,
+			}
+		}
+	}
+	return order
+}
+
+// cursor is the decoded form of the opaque cursors handed out with search
+// results: the sort they belong to and the sort values of the last result
+// returned, which the next page starts after. Sort values of numbers and
+// dates are binary, hence bytes
+type cursor struct {
+	Sort  string   `json:"sort"`
+	After [][]byte `json:"after"`
+}
+
+// encodeCursor returns the cursor of the page after hit
+func encodeCursor(keys []SortKey, hit *search.DocumentMatch) string {
+	c := cursor{Sort: sortSpec(keys), After: make([][]byte, len(keys))}
+	for i, key := range keys {
+		value := hit.Sort[i]
+		if key.Field == SortScore {
+			// bleve holds a placeholder in the sort values for the score
+			value = strconv.FormatFloat(hit.Score, 'g', -1, 64)
+		}
+		c.After[i] = []byte(value)
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the sort values a cursor resumes after, checking it
+// was made for keys
+func decodeCursor(s string, keys []SortKey) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if spec := sortSpec(keys); c.Sort != spec || len(c.After) != len(keys) {
+		return nil, fmt.Errorf("%w: cursor is for sort %q, not %q", ErrInvalidCursor, c.Sort, spec)
+	}
+
+	after := make([]string, len(c.After))
+	for i, value := range c.After {
+		after[i] = string(value)
+	}
+	return after, nil
+}
+
+func sortSpec(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key.String()
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,287 @@
+package suggest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minTermLength is the shortest term, in runes, kept in the dictionary
+const minTermLength = 2
+
+// Suggestion is a completion for a prefix
+type Suggestion struct {
+	Text         string  `json:"text"`
+	DocFrequency int     `json:"doc_frequency"`        // Documents containing the term or title
+	Popularity   int     `json:"popularity,omitempty"` // Times the text was searched for
+	Score        float64 `json:"score"`
+}
+
+// Dictionary holds the terms and titles of indexed documents for prefix
+// completion. Single-word prefixes complete terms from titles and content;
+// prefixes of several words complete whole titles
+type Dictionary struct {
+	mu     sync.RWMutex
+	terms  map[string]int           // term -> document frequency
+	titles map[string]*titleEntry   // normalized title -> entry
+	docs   map[string]dictionaryDoc // document ID -> what it contributed
+	sorted []string                 // terms in order, nil when stale
+}
+
+type titleEntry struct {
+	text  string // Title as first indexed
+	count int    // Documents with this title
+}
+
+type dictionaryDoc struct {
+	terms []string
+	title string
+}
+
+// NewDictionary creates an empty dictionary
+func NewDictionary() *Dictionary {
+	return &Dictionary{
+		terms:  make(map[string]int),
+		titles: make(map[string]*titleEntry),
+		docs:   make(map[string]dictionaryDoc),
+	}
+}
+
+// Add records the terms and title of a document, replacing any earlier
+// version of the same document
+func (d *Dictionary) Add(docID, title, content string) {
+	terms := uniqueTerms(title, content)
+	key := titleKey(title)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.remove(docID)
+
+	for _, term := range terms {
+		if d.terms[term] == 0 {
+			d.sorted = nil
+		}
+		d.terms[term]++
+	}
+
+	if key != "" {
+		entry, ok := d.titles[key]
+		if !ok {
+			entry = &titleEntry{text: strings.Join(strings.Fields(title), " ")}
+			d.titles[key] = entry
+		}
+		entry.count++
+	}
+
+	d.docs[docID] = dictionaryDoc{terms: terms, title: key}
+}
+
+// Remove forgets a document
+func (d *Dictionary) Remove(docID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.remove(docID)
+}
+
+func (d *Dictionary) remove(docID string) {
+	doc, ok := d.docs[docID]
+	if !ok {
+		return
+	}
+	delete(d.docs, docID)
+
+	for _, term := range doc.terms {
+		if d.terms[term]--; d.terms[term] <= 0 {
+			delete(d.terms, term)
+			d.sorted = nil
+		}
+	}
+
+	if entry, ok := d.titles[doc.title]; ok {
+		if entry.count--; entry.count <= 0 {
+			delete(d.titles, doc.title)
+		}
+	}
+}
+
+// Clear removes every document
+func (d *Dictionary) Clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.terms = make(map[string]int)
+	d.titles = make(map[string]*titleEntry)
+	d.docs = make(map[string]dictionaryDoc)
+	d.sorted = nil
+}
+
+// Len returns the number of documents in the dictionary
+func (d *Dictionary) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.docs)
+}
+
+// Complete returns up to limit completions of prefix ordered by document
+// frequency. A limit of 0 returns every completion
+func (d *Dictionary) Complete(prefix string, limit int) []Suggestion {
+	prefix = normalizePrefix(prefix)
+	if prefix == "" {
+		return nil
+	}
+
+	var suggestions []Suggestion
+	if strings.Contains(prefix, " ") {
+		key := titleKey(prefix)
+		if strings.HasSuffix(prefix, " ") {
+			key += " "
+		}
+		suggestions = d.completeTitles(key)
+	} else {
+		suggestions = d.completeTerms(prefix)
+	}
+
+	sortSuggestions(suggestions)
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+func (d *Dictionary) completeTerms(prefix string) []Suggestion {
+	// The sorted term list is rebuilt here, so this takes the write lock
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.sorted == nil {
+		d.sorted = make([]string, 0, len(d.terms))
+		for term := range d.terms {
+			d.sorted = append(d.sorted, term)
+		}
+		sort.Strings(d.sorted)
+	}
+
+	var suggestions []Suggestion
+	for i := sort.SearchStrings(d.sorted, prefix); i < len(d.sorted); i++ {
+		term := d.sorted[i]
+		if !strings.HasPrefix(term, prefix) {
+			break
+		}
+		df := d.terms[term]
+		suggestions = append(suggestions, Suggestion{Text: term, DocFrequency: df, Score: float64(df)})
+	}
+	return suggestions
+}
+
+// completeTitles matches the prefix against the start of any word in a title
+func (d *Dictionary) completeTitles(prefix string) []Suggestion {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var suggestions []Suggestion
+	for key, entry := range d.titles {
+		if !matchesWordPrefix(key, prefix) {
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{
+			Text:         entry.text,
+			DocFrequency: entry.count,
+			Score:        float64(entry.count),
+		})
+	}
+	return suggestions
+}
+
+// matchesWordPrefix reports whether prefix starts at a word boundary of text
+func matchesWordPrefix(text, prefix string) bool {
+	for i := 0; i < len(text); {
+		if strings.HasPrefix(text[i:], prefix) {
+			return true
+		}
+		next := strings.IndexByte(text[i:], ' ')
+		if next < 0 {
+			return false
+		}
+		i += next + 1
+	}
+	return false
+}
+
+// sortSuggestions orders by score, then alphabetically for stable output
+func sortSuggestions(suggestions []Suggestion) {
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+}
+
+// uniqueTerms returns the distinct dictionary terms of the given texts
+func uniqueTerms(texts ...string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, text := range texts {
+		for _, term := range tokenize(text) {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// tokenize splits text into lowercase words, dropping numbers and words
+// shorter than minTermLength
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := words[:0]
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < minTermLength || isNumber(word) {
+			continue
+		}
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+func isNumber(word string) bool {
+	for _, r := range word {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// titleKey reduces a title to its lowercase words separated by single
+// spaces, so punctuation does not get in the way of matching
+func titleKey(title string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// normalize lowercases text and collapses runs of whitespace
+func normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// normalizePrefix is normalize but keeps a single trailing space, which
+// means the last word is complete and the next one should be suggested
+func normalizePrefix(prefix string) string {
+	normalized := normalize(prefix)
+	if normalized != "" && strings.TrimRightFunc(prefix, unicode.IsSpace) != prefix {
+		normalized += " "
+	}
+	return normalized
+}
@@ -0,0 +1,102 @@
+package suggest
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// maxQueries caps the distinct queries a QueryLog keeps
+const maxQueries = 10000
+
+// QueryLog counts the queries users run, so popular queries can be weighted
+// up in suggestions. Once it holds maxQueries queries, recording a new one
+// halves every count, forgetting the queries run only once
+type QueryLog struct {
+	mu     sync.RWMutex
+	counts map[string]int
+}
+
+// NewQueryLog creates an empty query log
+func NewQueryLog() *QueryLog {
+	return &QueryLog{counts: make(map[string]int)}
+}
+
+// Record counts one run of query
+func (l *QueryLog) Record(query string) {
+	query = normalize(query)
+	if query == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.counts[query]; !ok {
+		for len(l.counts) >= maxQueries {
+			l.decay()
+		}
+	}
+	l.counts[query]++
+}
+
+// decay halves every count, dropping the queries that reach zero. The
+// caller holds the write lock
+func (l *QueryLog) decay() {
+	for query, count := range l.counts {
+		if count /= 2; count == 0 {
+			delete(l.counts, query)
+		} else {
+			l.counts[query] = count
+		}
+	}
+}
+
+// Count returns how many times query was recorded
+func (l *QueryLog) Count(query string) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.counts[normalize(query)]
+}
+
+// Clear forgets every recorded query
+func (l *QueryLog) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.counts = make(map[string]int)
+}
+
+// WithPopularity reranks dictionary suggestions by query log popularity and
+// adds past queries that complete prefix. Popularity is damped
+// logarithmically and scaled by weight, so a handful of searches does not
+// outrank terms found in many documents
+func (l *QueryLog) WithPopularity(prefix string, suggestions []Suggestion, weight float64, limit int) []Suggestion {
+	prefix = normalizePrefix(prefix)
+
+	l.mu.RLock()
+	known := make(map[string]bool, len(suggestions))
+	for i := range suggestions {
+		key := normalize(suggestions[i].Text)
+		known[key] = true
+		suggestions[i].Popularity = l.counts[key]
+	}
+	for query, count := range l.counts {
+		if !known[query] && strings.HasPrefix(query, prefix) {
+			suggestions = append(suggestions, Suggestion{Text: query, Popularity: count})
+		}
+	}
+	l.mu.RUnlock()
+
+	for i := range suggestions {
+		suggestions[i].Score = float64(suggestions[i].DocFrequency) +
+			weight*math.Log1p(float64(suggestions[i].Popularity))
+	}
+
+	sortSuggestions(suggestions)
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
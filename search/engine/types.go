@@ -3,24 +3,47 @@ package engine
 import (
 	"context"
 	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/jonesrussell/goprowl/search/engine/highlight"
+	"github.com/jonesrussell/goprowl/search/engine/query"
+	"github.com/jonesrussell/goprowl/search/engine/ranking"
+	"github.com/jonesrussell/goprowl/search/engine/suggest"
 )
 
 // Query interface defines the contract for all query types
 type Query interface {
+	// Root returns the parsed query tree, nil for an empty query
+	Root() query.Node
+	// Terms returns the non-negated leaf terms of the query tree
 	Terms() []*QueryTerm
 	Filters() map[string]interface{}
+	// Filter returns the typed filter results also have to match, nil for
+	// none
+	Filter() *Filter
 	Pagination() *Pagination
+	// Highlight returns the snippet options, nil when no snippets are wanted
+	Highlight() *HighlightOptions
+	// Facets returns the facets to compute over the matching documents
+	Facets() []FacetConfig
+	// Collapse returns the field whose value groups results, of which only
+	// the best scoring is returned, or "" to return every result
+	Collapse() string
+	// Explain reports whether results carry an explanation of their score
+	Explain() bool
+	// Sort returns the keys results are ordered by, nil to order them by
+	// score
+	Sort() []SortKey
+	// Cursor returns the cursor of the page to return, which takes the
+	// place of the page number, or "" to use the page number
+	Cursor() string
+	// MaxExpansions returns how many terms of a field a prefix, wildcard,
+	// regular expression or fuzzy term may match, 0 for the default
+	MaxExpansions() int
 }
 
 // QueryTerm represents a structured query term
-type QueryTerm struct {
-	Text      string
-	Type      QueryType
-	Field     string
-	Fuzziness int
-	Required  bool
-	Excluded  bool
-}
+type QueryTerm = query.QueryTerm
 
 // Pagination holds pagination information
 type Pagination struct {
@@ -28,21 +51,57 @@ type Pagination struct {
 	Size int
 }
 
+// HighlightOptions controls snippet generation for search results
+type HighlightOptions struct {
+	Formatter    highlight.Formatter
+	FragmentSize int // Approximate snippet fragment length, 0 for the default
+	MaxFragments int // Maximum fragments per field, 0 for the default
+}
+
 // SearchOptions represents options for search operations
 type SearchOptions struct {
-	Query     string
-	Filters   map[string]interface{}
-	Page      int
-	PageSize  int
+	Query   string
+	Filters map[string]interface{}
+	// Filter is a typed filter results also have to match, such as one
+	// returned by ParseFilter
+	Filter   *Filter
+	Page     int
+	PageSize int
+	// SortBy is a comma-separated list of sort keys, as parsed by ParseSort,
+	// and SortOrder the order of the keys that do not give their own
 	SortBy    string
 	SortOrder string
+	// Cursor continues a search from the "next_cursor" metadata of the
+	// previous page of results with the same query and sort, in place of Page
+	Cursor    string
+	Highlight *HighlightOptions
+	// Facets to compute over the matching documents. Filters whose key is
+	// the name of a facet select one of its values or buckets
+	Facets []FacetConfig
+	// Collapse groups results by the value of a field, such as ClusterField,
+	// returning only the best scoring result of each group. Groups are formed
+	// from at most the top 1000 matches: pages end there, and the "total"
+	// metadata counts the groups among them, with "total_approximate" set
+	// when it is an upper bound because not all of them were fetched.
+	// Collapsed results cannot be paged by cursor
+	Collapse string
+	// Explain sets the Explanation of every result
+	Explain bool
+	// MaxExpansions is how many terms of a field a prefix, wildcard,
+	// regular expression or fuzzy term may match before the search fails
+	// with expand.ErrTooManyTerms, 0 for expand.DefaultMaxExpansions
+	MaxExpansions int
 }
 
 // SearchResult represents a single search result
 type SearchResult struct {
-	Content  map[string]interface{} // Contains URL, Title, Snippet, etc.
-	Score    float64
-	Metadata map[string]interface{}
+	Content    map[string]interface{} // Contains URL, Title, Snippet, etc.
+	Score      float64
+	Metadata   map[string]interface{}
+	Highlights map[string][]string // Highlighted fragments per field
+	// Explanation is the tree of values Score was computed from, when
+	// explaining was asked for
+	Explanation *ranking.Explanation
 }
 
 // SearchResults represents a collection of search results with metadata
@@ -58,6 +117,25 @@ type Facet struct {
 	Count int64
 }
 
+// Suggestion is a completion returned by SuggestWithOptions
+type Suggestion = suggest.Suggestion
+
+// SuggestOptions controls suggestion lookups
+type SuggestOptions struct {
+	Limit int // Maximum suggestions returned, 0 for the default
+	// Popularity weights suggestions by how often they were searched for
+	Popularity bool
+}
+
+// DocumentPage is a page of the indexed documents, in ID order
+type DocumentPage struct {
+	// Documents hold the fields of ListedFields, without their content
+	Documents []Document
+	Total     int64 // Documents in the index
+	// Next is the ID the page after this one starts after, "" on the last
+	Next string
+}
+
 // SearchStats holds search engine statistics
 type SearchStats struct {
 	DocumentCount int64
@@ -89,21 +167,40 @@ type SearchEngine interface {
 
 	// Searching operations
 	Search(query Query) (*SearchResults, error)
-	SearchWithOptions(ctx context.Context, opts SearchOptions) ([]SearchResult, error)
+	SearchWithOptions(ctx context.Context, opts SearchOptions) (*SearchResults, error)
 	GetTotalResults(ctx context.Context, query string) (int, error)
 	Suggest(prefix string) []string
+	SuggestWithOptions(ctx context.Context, prefix string, opts SuggestOptions) ([]Suggestion, error)
 
 	// Management operations
-	Reindex() error
+	Reindex(ctx context.Context) error
+	CheckConsistency(ctx context.Context) (*ConsistencyReport, error)
 	Stats() *SearchStats
 
-	// List operation
+	// Document operations
 	List() ([]Document, error)
+	ListPage(ctx context.Context, after string, limit int) (*DocumentPage, error)
+	Get(id string) (Document, error)
 
 	// Cleanup operation
 	Clear() error
 }
 
+// IndexedStorage is implemented by storage adapters that maintain their own
+// bleve index, allowing the engine to query it directly instead of scanning
+type IndexedStorage interface {
+	SearchIndex(ctx context.Context, req *bleve.SearchRequest) (*bleve.SearchResult, error)
+	// FieldTerms calls visit with the terms indexed in field, in order,
+	// until it returns false
+	FieldTerms(ctx context.Context, field string, visit func(term string) bool) error
+}
+
+// SuggestingStorage is implemented by storage adapters that keep their own
+// suggestion dictionary current as documents are stored and deleted
+type SuggestingStorage interface {
+	Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error)
+}
+
 // Searcher defines the interface for search operations
 type Searcher interface {
 	// Search performs a search using the given query
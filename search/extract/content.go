@@ -0,0 +1,222 @@
+// Package extract finds the main content of HTML pages, leaving out the
+// navigation, footers, banners and other boilerplate repeated across a site
+package extract
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	// minParagraphLength is the shortest text a block needs to count as
+	// content when scoring its ancestors
+	minParagraphLength = 25
+	// minSiblingScore is the lowest score a sibling of the best block needs
+	// to be kept with it, however low the best block scores
+	minSiblingScore = 10
+	// siblingScoreRatio is the fraction of the best block's score its
+	// siblings need to be kept with it
+	siblingScoreRatio = 0.2
+	// maxLinkDensity is the largest share of link text a block inside the
+	// main content may have before it is dropped as a link list
+	maxLinkDensity = 0.5
+)
+
+var (
+	// unlikelyPattern matches the class or ID of boilerplate blocks
+	unlikelyPattern = regexp.MustCompile(`(?i)ad-break|advert|banner|breadcrumb|combx|comment|community|consent|cookie|disqus|footer|gdpr|header|menu|modal|navbar|navigation|pager|pagination|popup|promo|related|remark|rss|share|shoutbox|sidebar|skip|social|sponsor|subscribe|toolbar|tweet|twitter|widget`)
+	// likelyPattern matches the class or ID of blocks that hold content,
+	// rescuing blocks that unlikelyPattern also matches
+	likelyPattern = regexp.MustCompile(`(?i)article|body|column|content|entry|main|post|shadow|story|text`)
+	// hiddenStyle matches inline styles that hide an element
+	hiddenStyle = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden`)
+)
+
+// skippedTags hold no readable content
+var skippedTags = map[string]bool{
+	"aside": true, "button": true, "canvas": true, "dialog": true,
+	"embed": true, "footer": true, "form": true, "head": true,
+	"iframe": true, "input": true, "nav": true, "noscript": true,
+	"object": true, "script": true, "select": true, "style": true,
+	"svg": true, "template": true, "textarea": true,
+}
+
+// skippedRoles are ARIA landmarks of page furniture
+var skippedRoles = map[string]bool{
+	"alert": true, "banner": true, "complementary": true, "contentinfo": true,
+	"dialog": true, "menu": true, "menubar": true, "navigation": true,
+	"search": true,
+}
+
+// Content is the main content of a page
+type Content struct {
+	Text     string   // Main content, with paragraphs separated by blank lines
+	Headings []string // Headings within the main content, in document order
+}
+
+// Main extracts the main content of a parsed page. Blocks are scored by the
+// amount of prose they hold, with commas and length counting for them and
+// link text against them; the best scoring block is kept together with
+// siblings that score nearly as well. Pages without a block of prose, such
+// as landing pages, keep all of their body that is not boilerplate.
+// The document is not modified
+func Main(doc *goquery.Selection) *Content {
+	var root *html.Node
+	for _, n := range doc.Nodes {
+		if body := findBody(n); body != nil {
+			root = body
+			break
+		}
+	}
+	if root == nil {
+		if len(doc.Nodes) == 0 {
+			return &Content{}
+		}
+		root = doc.Nodes[0]
+	}
+
+	s := &scorer{scores: make(map[*html.Node]float64)}
+	s.walk(root, false)
+
+	r := &renderer{}
+	if best := s.best(); best != nil {
+		for _, n := range s.withSiblings(best) {
+			r.block(n)
+		}
+	} else {
+		r.block(root)
+	}
+	return r.content()
+}
+
+// findBody returns the body element under n, or nil
+func findBody(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode && n.Data == "body" {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if body := findBody(child); body != nil {
+			return body
+		}
+	}
+	return nil
+}
+
+// isBoilerplate reports whether an element is page furniture rather than
+// content. Headers are only furniture outside an article or main element,
+// where they introduce the content instead
+func isBoilerplate(n *html.Node, inArticle bool) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if skippedTags[n.Data] || (n.Data == "header" && !inArticle) {
+		return true
+	}
+
+	if _, hidden := attr(n, "hidden"); hidden {
+		return true
+	}
+	if v, _ := attr(n, "aria-hidden"); v == "true" {
+		return true
+	}
+	if style, _ := attr(n, "style"); hiddenStyle.MatchString(style) {
+		return true
+	}
+	if role, _ := attr(n, "role"); skippedRoles[strings.ToLower(role)] {
+		return true
+	}
+
+	switch n.Data {
+	case "body", "article", "main":
+		return false
+	}
+	ident := classAndID(n)
+	return unlikelyPattern.MatchString(ident) && !likelyPattern.MatchString(ident)
+}
+
+// opensArticle reports whether n starts the content of a page, inside which
+// headers belong to the content
+func opensArticle(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if n.Data == "article" || n.Data == "main" {
+		return true
+	}
+	role, _ := attr(n, "role")
+	return role == "main" || role == "article"
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func classAndID(n *html.Node) string {
+	class, _ := attr(n, "class")
+	id, _ := attr(n, "id")
+	return class + " " + id
+}
+
+// insideArticle reports whether an ancestor of n opens an article
+func insideArticle(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if opensArticle(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// readableText returns the text under n that is not boilerplate, with
+// whitespace collapsed, and how many of its bytes are link text
+func readableText(n *html.Node, inArticle bool) (string, int) {
+	var b strings.Builder
+	links := 0
+
+	var walk func(n *html.Node, inLink, inArticle bool)
+	walk = func(n *html.Node, inLink, inArticle bool) {
+		switch n.Type {
+		case html.TextNode:
+			text := strings.Join(strings.Fields(n.Data), " ")
+			if text == "" {
+				return
+			}
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(text)
+			if inLink {
+				links += len(text)
+			}
+			return
+		case html.ElementNode:
+			if isBoilerplate(n, inArticle) {
+				return
+			}
+			inLink = inLink || n.Data == "a"
+			inArticle = inArticle || opensArticle(n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, inLink, inArticle)
+		}
+	}
+	walk(n, false, inArticle)
+	return b.String(), links
+}
+
+// linkDensity returns the share of the readable text under n that is link text
+func linkDensity(n *html.Node, inArticle bool) float64 {
+	text, links := readableText(n, inArticle)
+	if text == "" {
+		return 0
+	}
+	return float64(links) / float64(len(text))
+}
@@ -0,0 +1,282 @@
+package extract
+
+import (
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Metadata is the structured data a page declares about itself in its meta
+// tags, OpenGraph and Twitter card tags, and schema.org JSON-LD or microdata
+type Metadata struct {
+	Description string
+	Keywords    []string
+	Author      string
+	Language    string    // Language tag of <html lang> or the Content-Language meta tag
+	Published   time.Time // Zero when the page does not say
+	Modified    time.Time // Zero when the page does not say
+
+	OpenGraph OpenGraph
+	Twitter   TwitterCard
+
+	// schema.org items found in JSON-LD blocks and microdata
+	Articles    []Article
+	Products    []Product
+	Breadcrumbs []BreadcrumbList
+}
+
+// OpenGraph holds the og:* properties of a page
+type OpenGraph struct {
+	Title       string
+	Description string
+	Type        string
+	URL         string
+	Image       string
+	SiteName    string
+	Locale      string
+}
+
+// TwitterCard holds the twitter:* properties of a page
+type TwitterCard struct {
+	Card        string
+	Title       string
+	Description string
+	Image       string
+	Site        string
+	Creator     string
+}
+
+// Article is a schema.org Article or one of its subtypes, such as
+// BlogPosting or NewsArticle
+type Article struct {
+	Type        string
+	Headline    string
+	Description string
+	Authors     []string
+	Keywords    []string
+	Published   time.Time
+	Modified    time.Time
+}
+
+// Product is a schema.org Product
+type Product struct {
+	Name        string
+	Description string
+	Brand       string
+	SKU         string
+	Offers      []Offer
+}
+
+// Offer is a price a Product is sold at
+type Offer struct {
+	Price        float64
+	Currency     string
+	Availability string // schema.org ItemAvailability, such as "InStock"
+}
+
+// BreadcrumbList is a schema.org BreadcrumbList, the trail from the site's
+// root to a page
+type BreadcrumbList struct {
+	Items []Breadcrumb
+}
+
+// Breadcrumb is one step of a BreadcrumbList
+type Breadcrumb struct {
+	Position int
+	Name     string
+	URL      string
+}
+
+// Types returns the schema.org types the page declares items of
+func (m *Metadata) Types() []string {
+	var types []string
+	seen := make(map[string]bool)
+	add := func(t string) {
+		if t != "" && !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	for _, article := range m.Articles {
+		add(article.Type)
+	}
+	if len(m.Products) > 0 {
+		add("Product")
+	}
+	if len(m.Breadcrumbs) > 0 {
+		add("BreadcrumbList")
+	}
+	return types
+}
+
+// Summary returns the page's own description of itself: its meta
+// description, or failing that its OpenGraph, Twitter card or article
+// description
+func (m *Metadata) Summary() string {
+	candidates := []string{m.Description, m.OpenGraph.Description, m.Twitter.Description}
+	for _, article := range m.Articles {
+		candidates = append(candidates, article.Description)
+	}
+	for _, candidate := range candidates {
+		if candidate != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// ParseMetadata reads the structured data of a parsed page. Values missing
+// from the meta tags are taken from the page's first schema.org Article
+func ParseMetadata(doc *goquery.Selection) *Metadata {
+	m := &Metadata{}
+
+	root := doc.Filter("html").AddSelection(doc.Find("html")).First()
+	m.Language = strings.TrimSpace(root.AttrOr("lang", ""))
+
+	var articleAuthor string
+	doc.Find("meta").Each(func(_ int, meta *goquery.Selection) {
+		content := strings.TrimSpace(meta.AttrOr("content", ""))
+		if content == "" {
+			return
+		}
+
+		if equiv := meta.AttrOr("http-equiv", ""); strings.EqualFold(equiv, "content-language") {
+			if m.Language == "" {
+				m.Language, _, _ = strings.Cut(content, ",")
+				m.Language = strings.TrimSpace(m.Language)
+			}
+			return
+		}
+
+		name := meta.AttrOr("property", "")
+		if name == "" {
+			name = meta.AttrOr("name", "")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		switch name {
+		case "description":
+			m.Description = content
+		case "keywords":
+			m.Keywords = splitKeywords(content)
+		case "author":
+			m.Author = content
+		case "article:author":
+			articleAuthor = content
+		case "article:published_time":
+			m.Published = parseDate(content)
+		case "article:modified_time", "og:updated_time":
+			m.Modified = parseDate(content)
+		}
+
+		if property, ok := strings.CutPrefix(name, "og:"); ok {
+			setOpenGraph(&m.OpenGraph, property, content)
+		}
+		if property, ok := strings.CutPrefix(name, "twitter:"); ok {
+			setTwitterCard(&m.Twitter, property, content)
+		}
+	})
+
+	if m.Language == "" {
+		m.Language = strings.ReplaceAll(m.OpenGraph.Locale, "_", "-")
+	}
+
+	for _, item := range schemaItems(doc) {
+		m.addItem(item)
+	}
+
+	// article:author is often a profile URL, which makes a poor author name
+	if m.Author == "" && articleAuthor != "" && !strings.Contains(articleAuthor, "://") {
+		m.Author = articleAuthor
+	}
+	if len(m.Articles) > 0 {
+		article := m.Articles[0]
+		if m.Author == "" && len(article.Authors) > 0 {
+			m.Author = article.Authors[0]
+		}
+		if m.Published.IsZero() {
+			m.Published = article.Published
+		}
+		if m.Modified.IsZero() {
+			m.Modified = article.Modified
+		}
+	}
+
+	return m
+}
+
+func setOpenGraph(og *OpenGraph, property, content string) {
+	switch property {
+	case "title":
+		og.Title = content
+	case "description":
+		og.Description = content
+	case "type":
+		og.Type = content
+	case "url":
+		og.URL = content
+	case "image", "image:url":
+		if og.Image == "" {
+			og.Image = content
+		}
+	case "site_name":
+		og.SiteName = content
+	case "locale":
+		og.Locale = content
+	}
+}
+
+func setTwitterCard(card *TwitterCard, property, content string) {
+	switch property {
+	case "card":
+		card.Card = content
+	case "title":
+		card.Title = content
+	case "description":
+		card.Description = content
+	case "image", "image:src":
+		if card.Image == "" {
+			card.Image = content
+		}
+	case "site":
+		card.Site = content
+	case "creator":
+		card.Creator = content
+	}
+}
+
+// splitKeywords splits a comma separated keyword list
+func splitKeywords(s string) []string {
+	var keywords []string
+	for _, keyword := range strings.Split(s, ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+// dateLayouts are the date formats found in meta tags and schema.org data
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// parseDate reads a date in any of dateLayouts, returning the zero time
+// for anything else
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
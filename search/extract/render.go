@@ -0,0 +1,141 @@
+package extract
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// linkListTags are containers dropped from the main content when most of
+// their text is links, such as tables of contents and related-page lists
+var linkListTags = map[string]bool{
+	"div": true, "dl": true, "figure": true, "ol": true, "section": true,
+	"table": true, "ul": true,
+}
+
+// renderer writes the text of content blocks as paragraphs, collecting
+// their headings on the way
+type renderer struct {
+	paragraphs []string
+	headings   []string
+	line       strings.Builder // Text of the paragraph being written
+	pre        bool            // The paragraph keeps its whitespace
+}
+
+// block renders a block chosen as main content
+func (r *renderer) block(n *html.Node) {
+	r.render(n, insideArticle(n), true)
+	r.flush()
+}
+
+func (r *renderer) render(n *html.Node, inArticle, root bool) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if isBoilerplate(n, inArticle) {
+		return
+	}
+	inArticle = inArticle || opensArticle(n)
+
+	switch {
+	case n.Data == "br":
+		r.line.WriteByte('\n')
+		return
+	case isHeading(n):
+		r.flush()
+		if text, _ := readableText(n, inArticle); text != "" {
+			r.headings = append(r.headings, text)
+			r.paragraphs = append(r.paragraphs, text)
+		}
+		return
+	case !root && linkListTags[n.Data] && linkDensity(n, inArticle) > maxLinkDensity:
+		return
+	case n.Data == "pre":
+		r.flush()
+		r.pre = true
+		r.children(n, inArticle)
+		r.flush()
+		r.pre = false
+		return
+	case blockTags[n.Data]:
+		r.flush()
+		r.children(n, inArticle)
+		r.flush()
+		return
+	}
+	r.children(n, inArticle)
+}
+
+func (r *renderer) children(n *html.Node, inArticle bool) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		r.render(child, inArticle, false)
+	}
+}
+
+// text appends a text node to the paragraph, collapsing its whitespace
+// unless the paragraph is preformatted
+func (r *renderer) text(data string) {
+	if r.pre {
+		r.line.WriteString(data)
+		return
+	}
+
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		if data != "" {
+			r.space()
+		}
+		return
+	}
+	if strings.TrimLeft(data, " \t\r\n\f") != data {
+		r.space()
+	}
+	r.line.WriteString(strings.Join(fields, " "))
+	if strings.TrimRight(data, " \t\r\n\f") != data {
+		r.space()
+	}
+}
+
+// space separates the next text from the previous on the same line
+func (r *renderer) space() {
+	text := r.line.String()
+	if text != "" && !strings.HasSuffix(text, " ") && !strings.HasSuffix(text, "\n") {
+		r.line.WriteByte(' ')
+	}
+}
+
+// flush ends the paragraph being written
+func (r *renderer) flush() {
+	text := r.line.String()
+	r.line.Reset()
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if r.pre {
+			line = strings.TrimRight(line, " \t\r")
+		} else {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if paragraph := strings.Trim(strings.Join(lines, "\n"), "\n"); paragraph != "" {
+		r.paragraphs = append(r.paragraphs, paragraph)
+	}
+}
+
+func (r *renderer) content() *Content {
+	return &Content{
+		Text:     strings.Join(r.paragraphs, "\n\n"),
+		Headings: r.headings,
+	}
+}
@@ -0,0 +1,312 @@
+package extract
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// item is a schema.org item, decoded from JSON-LD or read from microdata
+// into the same shape
+type item = map[string]interface{}
+
+// articleTypes are the schema.org types read as an Article
+var articleTypes = map[string]bool{
+	"Article": true, "AdvertiserContentArticle": true, "AnalysisNewsArticle": true,
+	"APIReference": true, "BlogPosting": true, "LiveBlogPosting": true,
+	"NewsArticle": true, "OpinionNewsArticle": true, "Report": true,
+	"ReportageNewsArticle": true, "ReviewNewsArticle": true,
+	"ScholarlyArticle": true, "SocialMediaPosting": true, "TechArticle": true,
+}
+
+// schemaItems returns the top-level schema.org items of a page, from its
+// JSON-LD blocks followed by its microdata. Malformed JSON-LD is ignored
+func schemaItems(doc *goquery.Selection) []item {
+	var items []item
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, script *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(script.Text()), &data); err != nil {
+			return
+		}
+		items = append(items, jsonLDItems(data)...)
+	})
+
+	doc.Find("[itemscope]:not([itemprop])").Each(func(_ int, scope *goquery.Selection) {
+		items = append(items, microdataItem(scope))
+	})
+
+	return items
+}
+
+// jsonLDItems flattens a decoded JSON-LD value, which may be a single item,
+// an array of them, or a graph
+func jsonLDItems(data interface{}) []item {
+	switch v := data.(type) {
+	case []interface{}:
+		var items []item
+		for _, element := range v {
+			items = append(items, jsonLDItems(element)...)
+		}
+		return items
+	case item:
+		if graph, ok := v["@graph"]; ok {
+			return jsonLDItems(graph)
+		}
+		return []item{v}
+	}
+	return nil
+}
+
+// microdataItem reads the properties of an itemscope element. Nested items
+// become property values and their own properties stay with them
+func microdataItem(scope *goquery.Selection) item {
+	it := item{}
+	if itemType, ok := scope.Attr("itemtype"); ok {
+		it["@type"] = itemType
+	}
+
+	var properties func(parent *goquery.Selection)
+	properties = func(parent *goquery.Selection) {
+		parent.Children().Each(func(_ int, child *goquery.Selection) {
+			_, nested := child.Attr("itemscope")
+			if names, ok := child.Attr("itemprop"); ok {
+				var value interface{}
+				if nested {
+					value = microdataItem(child)
+				} else {
+					value = microdataValue(child)
+				}
+				for _, name := range strings.Fields(names) {
+					addProperty(it, name, value)
+				}
+			}
+			if !nested {
+				properties(child)
+			}
+		})
+	}
+	properties(scope)
+
+	return it
+}
+
+// microdataValue returns the value of an itemprop element, which depends on
+// the element the way the microdata specification lays out
+func microdataValue(s *goquery.Selection) string {
+	if content, ok := s.Attr("content"); ok {
+		return strings.TrimSpace(content)
+	}
+
+	var attr string
+	switch goquery.NodeName(s) {
+	case "a", "area", "link":
+		attr = "href"
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		attr = "src"
+	case "object":
+		attr = "data"
+	case "data", "meter":
+		attr = "value"
+	case "time":
+		attr = "datetime"
+	}
+	if value, ok := s.Attr(attr); attr != "" && ok {
+		return strings.TrimSpace(value)
+	}
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
+// addProperty sets a property, collecting repeated properties into a list
+func addProperty(it item, name string, value interface{}) {
+	existing, ok := it[name]
+	if !ok {
+		it[name] = value
+		return
+	}
+	if values, ok := existing.([]interface{}); ok {
+		it[name] = append(values, value)
+		return
+	}
+	it[name] = []interface{}{existing, value}
+}
+
+// addItem records a schema.org item of a type the metadata knows
+func (m *Metadata) addItem(it item) {
+	for _, t := range itemTypes(it) {
+		switch {
+		case articleTypes[t]:
+			m.Articles = append(m.Articles, Article{
+				Type:        t,
+				Headline:    text(it["headline"]),
+				Description: text(it["description"]),
+				Authors:     texts(it["author"]),
+				Keywords:    keywords(it["keywords"]),
+				Published:   parseDate(text(it["datePublished"])),
+				Modified:    parseDate(text(it["dateModified"])),
+			})
+		case t == "Product":
+			m.Products = append(m.Products, Product{
+				Name:        text(it["name"]),
+				Description: text(it["description"]),
+				Brand:       text(it["brand"]),
+				SKU:         text(it["sku"]),
+				Offers:      offers(it["offers"]),
+			})
+		case t == "BreadcrumbList":
+			m.Breadcrumbs = append(m.Breadcrumbs, breadcrumbs(it["itemListElement"]))
+		default:
+			continue
+		}
+		return
+	}
+}
+
+// itemTypes returns the short schema.org type names of an item, so
+// "https://schema.org/Article" and "schema:Article" both read "Article"
+func itemTypes(it item) []string {
+	var types []string
+	for _, t := range texts(it["@type"]) {
+		for _, name := range strings.Fields(t) {
+			if i := strings.LastIndexAny(name, "/#:"); i >= 0 {
+				name = name[i+1:]
+			}
+			types = append(types, name)
+		}
+	}
+	return types
+}
+
+func offers(v interface{}) []Offer {
+	var result []Offer
+	for _, o := range values(v) {
+		offer, ok := o.(item)
+		if !ok {
+			continue
+		}
+		// Aggregate offers carry a price range instead of a price
+		price, ok := number(offer["price"])
+		if !ok {
+			price, ok = number(offer["lowPrice"])
+		}
+		if !ok {
+			continue
+		}
+		availability := text(offer["availability"])
+		if i := strings.LastIndexAny(availability, "/#:"); i >= 0 {
+			availability = availability[i+1:]
+		}
+		result = append(result, Offer{
+			Price:        price,
+			Currency:     text(offer["priceCurrency"]),
+			Availability: availability,
+		})
+	}
+	return result
+}
+
+func breadcrumbs(v interface{}) BreadcrumbList {
+	var list BreadcrumbList
+	for i, element := range values(v) {
+		crumb, ok := element.(item)
+		if !ok {
+			continue
+		}
+
+		position := i + 1
+		if p, ok := number(crumb["position"]); ok {
+			position = int(p)
+		}
+
+		name, link := text(crumb["name"]), ""
+		switch target := crumb["item"].(type) {
+		case string:
+			link = target
+		case item:
+			if name == "" {
+				name = text(target["name"])
+			}
+			link = text(target["@id"])
+			if link == "" {
+				link = text(target["url"])
+			}
+		}
+
+		list.Items = append(list.Items, Breadcrumb{Position: position, Name: name, URL: link})
+	}
+	return list
+}
+
+// values returns a property value as a list, whether or not it repeats
+func values(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	}
+	return []interface{}{v}
+}
+
+// text returns the text of a property value: a string as it is, the name
+// of an item such as a Person or Brand, or the first of a list
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case item:
+		for _, key := range []string{"name", "@value", "@id"} {
+			if s := text(v[key]); s != "" {
+				return s
+			}
+		}
+	case []interface{}:
+		for _, element := range v {
+			if s := text(element); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// texts returns the text of every value of a property
+func texts(v interface{}) []string {
+	var result []string
+	for _, element := range values(v) {
+		if s := text(element); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// keywords reads schema.org keywords, given as a list or a comma
+// separated string
+func keywords(v interface{}) []string {
+	var result []string
+	for _, s := range texts(v) {
+		result = append(result, splitKeywords(s)...)
+	}
+	return result
+}
+
+// number reads a numeric property, which JSON-LD often gives as a string
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
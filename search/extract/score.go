@@ -0,0 +1,177 @@
+package extract
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// blockTags are the elements that start a new paragraph of text
+var blockTags = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "dd": true,
+	"details": true, "div": true, "dl": true, "dt": true, "figcaption": true,
+	"figure": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "li": true, "main": true,
+	"ol": true, "p": true, "pre": true, "section": true, "summary": true,
+	"table": true, "tbody": true, "td": true, "tfoot": true, "th": true,
+	"thead": true, "tr": true, "ul": true,
+}
+
+// scorer rates blocks by the prose in the paragraphs directly below them
+type scorer struct {
+	scores     map[*html.Node]float64
+	candidates []*html.Node // Scored blocks in document order
+}
+
+// walk scores the paragraphs under n into their parents and grandparents
+func (s *scorer) walk(n *html.Node, inArticle bool) {
+	if n.Type != html.ElementNode {
+		return
+	}
+	if isBoilerplate(n, inArticle) {
+		return
+	}
+	inArticle = inArticle || opensArticle(n)
+
+	if isParagraph(n) {
+		text, _ := readableText(n, inArticle)
+		if len(text) < minParagraphLength {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		s.add(n.Parent, score)
+		if n.Parent != nil {
+			s.add(n.Parent.Parent, score/2)
+		}
+		return
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		s.walk(child, inArticle)
+	}
+}
+
+// add credits a block with score, rating it by its tag and class first
+func (s *scorer) add(n *html.Node, score float64) {
+	if n == nil || n.Type != html.ElementNode {
+		return
+	}
+	if _, ok := s.scores[n]; !ok {
+		s.scores[n] = tagScore(n) + classWeight(n)
+		s.candidates = append(s.candidates, n)
+	}
+	s.scores[n] += score
+}
+
+// best returns the block with the highest score once link text is
+// discounted, or nil when no paragraph was long enough to score. Scores
+// are left discounted for withSiblings
+func (s *scorer) best() *html.Node {
+	var best *html.Node
+	for _, n := range s.candidates {
+		s.scores[n] *= 1 - linkDensity(n, insideArticle(n))
+		if best == nil || s.scores[n] > s.scores[best] {
+			best = n
+		}
+	}
+	return best
+}
+
+// withSiblings returns best along with the siblings that belong to the same
+// content: blocks scoring close to it, headings, and paragraphs of prose
+func (s *scorer) withSiblings(best *html.Node) []*html.Node {
+	if best.Parent == nil {
+		return []*html.Node{best}
+	}
+
+	threshold := max(minSiblingScore, s.scores[best]*siblingScoreRatio)
+	inArticle := insideArticle(best)
+
+	var nodes []*html.Node
+	for sibling := best.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Type != html.ElementNode {
+			continue
+		}
+		if sibling == best {
+			nodes = append(nodes, sibling)
+			continue
+		}
+		if isBoilerplate(sibling, inArticle) {
+			continue
+		}
+		if score, ok := s.scores[sibling]; ok && score >= threshold {
+			nodes = append(nodes, sibling)
+			continue
+		}
+
+		switch {
+		case isHeading(sibling):
+			nodes = append(nodes, sibling)
+		case sibling.Data == "p":
+			text, _ := readableText(sibling, inArticle)
+			density := linkDensity(sibling, inArticle)
+			if (len(text) > 80 && density < 0.25) ||
+				(len(text) > 0 && density == 0 && strings.HasSuffix(text, ".")) {
+				nodes = append(nodes, sibling)
+			}
+		}
+	}
+	return nodes
+}
+
+// isParagraph reports whether n holds a run of text: a paragraph, a
+// preformatted block or table cell, or a block with only inline children
+func isParagraph(n *html.Node) bool {
+	switch n.Data {
+	case "p", "pre", "td":
+		return true
+	case "div", "section":
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.ElementNode && blockTags[child.Data] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isHeading(n *html.Node) bool {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		return true
+	}
+	return false
+}
+
+// tagScore is the starting score of a block, favouring elements that
+// usually wrap prose over lists and headings
+func tagScore(n *html.Node) float64 {
+	switch n.Data {
+	case "article", "main":
+		return 10
+	case "div", "section":
+		return 5
+	case "pre", "td", "blockquote":
+		return 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		return -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		return -5
+	}
+	return 0
+}
+
+// classWeight rates a block by whether its class and ID name content
+// or boilerplate
+func classWeight(n *html.Node) float64 {
+	ident := classAndID(n)
+	weight := 0.0
+	if likelyPattern.MatchString(ident) {
+		weight += 25
+	}
+	if unlikelyPattern.MatchString(ident) {
+		weight -= 25
+	}
+	return weight
+}
@@ -0,0 +1,170 @@
+package bleve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/jonesrussell/goprowl/search/storage"
+)
+
+// Reindex rebuilds the index under the current mapping from the stored
+// fields of every document. The new index is built beside the old one, which
+// keeps serving searches and writes; writes made meanwhile are replayed into
+// the new index before it replaces the old one on disk
+func (s *BleveStorage) Reindex(ctx context.Context) error {
+	s.mu.Lock()
+	if s.pending != nil {
+		s.mu.Unlock()
+		return storage.ErrReindexInProgress
+	}
+	s.pending = make(map[string]struct{})
+	old := s.index
+	s.mu.Unlock()
+
+	buildPath := s.path + ".reindex"
+	index, err := s.buildIndex(ctx, old, buildPath)
+	if err != nil {
+		s.mu.Lock()
+		s.pending = nil
+		s.mu.Unlock()
+		os.RemoveAll(buildPath)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.pending
+	s.pending = nil
+
+	if err := replay(ctx, old, index, pending); err != nil {
+		index.Close()
+		os.RemoveAll(buildPath)
+		return err
+	}
+
+	return s.swap(index, buildPath)
+}
+
+// buildIndex copies every document of old into a new index at path
+func (s *BleveStorage) buildIndex(ctx context.Context, old bleve.Index, path string) (bleve.Index, error) {
+	if err := os.RemoveAll(path); err != nil {
+		return nil, fmt.Errorf("failed to remove stale reindex directory: %w", err)
+	}
+
+	index, err := bleve.New(path, NewMapping())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new index: %w", err)
+	}
+
+	const batchSize = 500
+	batch := index.NewBatch()
+	err = eachStored(ctx, old, nil, func(id string, fields map[string]interface{}) error {
+		// Documents indexed before languages were detected get theirs now
+		resolveLanguage(fields)
+		if err := batch.Index(id, fields); err != nil {
+			return fmt.Errorf("failed to add document %s to batch: %w", id, err)
+		}
+		if batch.Size() < batchSize {
+			return nil
+		}
+		if err := index.Batch(batch); err != nil {
+			return fmt.Errorf("failed to index documents: %w", err)
+		}
+		batch.Reset()
+		return nil
+	})
+	if err == nil {
+		err = index.Batch(batch)
+	}
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// replay copies the current version of each ID from old into index,
+// deleting those that no longer exist
+func replay(ctx context.Context, old, index bleve.Index, ids map[string]struct{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	docIDs := make([]string, 0, len(ids))
+	for id := range ids {
+		docIDs = append(docIDs, id)
+	}
+
+	req := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(docIDs), len(docIDs), 0, false)
+	req.Fields = []string{"*"}
+	result, err := old.SearchInContext(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to read documents written during reindex: %w", err)
+	}
+
+	batch := index.NewBatch()
+	for _, hit := range result.Hits {
+		if err := batch.Index(hit.ID, hit.Fields); err != nil {
+			return fmt.Errorf("failed to add document %s to batch: %w", hit.ID, err)
+		}
+		delete(ids, hit.ID)
+	}
+	for id := range ids {
+		batch.Delete(id)
+	}
+
+	if err := index.Batch(batch); err != nil {
+		return fmt.Errorf("failed to replay writes made during reindex: %w", err)
+	}
+	return nil
+}
+
+// swap replaces the index on disk with the one built at buildPath. Callers
+// hold mu. If the new index cannot be moved into place the old one is reopened
+func (s *BleveStorage) swap(index bleve.Index, buildPath string) error {
+	backupPath := s.path + ".old"
+
+	if err := index.Close(); err != nil {
+		return fmt.Errorf("failed to close new index: %w", err)
+	}
+	if err := s.index.Close(); err != nil {
+		return fmt.Errorf("failed to close old index: %w", err)
+	}
+
+	if err := os.RemoveAll(backupPath); err != nil {
+		return s.reopen(fmt.Errorf("failed to remove stale backup: %w", err))
+	}
+	if err := os.Rename(s.path, backupPath); err != nil {
+		return s.reopen(fmt.Errorf("failed to move old index aside: %w", err))
+	}
+	if err := os.Rename(buildPath, s.path); err != nil {
+		if restoreErr := os.Rename(backupPath, s.path); restoreErr != nil {
+			err = errors.Join(err, restoreErr)
+		}
+		return s.reopen(fmt.Errorf("failed to move new index into place: %w", err))
+	}
+
+	if err := s.reopen(nil); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(backupPath); err != nil {
+		return fmt.Errorf("failed to remove old index: %w", err)
+	}
+	return nil
+}
+
+// reopen opens the index at the storage path after a swap, returning cause
+// together with any error opening it
+func (s *BleveStorage) reopen(cause error) error {
+	index, err := bleve.Open(s.path)
+	if err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to reopen index: %w", err))
+	}
+	s.index = index
+	return cause
+}
@@ -2,15 +2,17 @@ package bleve
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/document"
 	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/jonesrussell/goprowl/search/engine/language"
+	"github.com/jonesrussell/goprowl/search/engine/suggest"
 	"github.com/jonesrussell/goprowl/search/storage"
 )
 
@@ -18,6 +20,15 @@ type BleveStorage struct {
 	index bleve.Index
 	path  string
 	mu    sync.RWMutex
+
+	// dictionary backs Suggest. It is built from the index on first use and
+	// kept current by Store, BatchStore, Delete and Clear afterwards
+	dictionary       *suggest.Dictionary
+	dictionaryLoaded bool
+
+	// pending collects IDs written while Reindex builds a new index, nil
+	// when no reindex is running
+	pending map[string]struct{}
 }
 
 type BleveDocument struct {
@@ -33,40 +44,143 @@ func New(path string) (*BleveStorage, error) {
 	// Open or create index
 	index, err := bleve.Open(path)
 	if err == bleve.ErrorIndexPathDoesNotExist {
-		mapping := createMapping()
+		mapping := NewMapping()
 		index, err = bleve.New(path, mapping)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create/open bleve index: %w", err)
 	}
-	return &BleveStorage{index: index, path: path}, nil
+	return &BleveStorage{index: index, path: path, dictionary: suggest.NewDictionary()}, nil
 }
 
-func createMapping() mapping.IndexMapping {
+// PresenceField lists the names of the fields a document has a value for,
+// so filters can select the documents with or without a field without
+// expanding its terms
+const PresenceField = "present_fields"
+
+// NewMapping builds the mapping of a document index. The storage's index and
+// the search engine's in-memory one are both built from it
+func NewMapping() mapping.IndexMapping {
 	indexMapping := bleve.NewIndexMapping()
 
+	// Documents are mapped by their language, so those in a language with
+	// an analyzer also have their text indexed stemmed and without stop words
+	indexMapping.TypeField = language.Field
+	indexMapping.DefaultMapping = documentMapping("")
+	for _, lang := range language.Languages() {
+		analyzer, _ := language.Analyzer(lang)
+		indexMapping.AddDocumentMapping(lang, documentMapping(analyzer))
+	}
+
+	return indexMapping
+}
+
+// documentMapping maps the fields of a document. With an analyzer, the
+// language's text fields are also indexed with it under their analyzed names
+func documentMapping(analyzer string) *mapping.DocumentMapping {
 	docMapping := bleve.NewDocumentMapping()
 
 	// Add field mappings
 	textFieldMapping := bleve.NewTextFieldMapping()
+	keywordFieldMapping := bleve.NewKeywordFieldMapping()
+	numericFieldMapping := bleve.NewNumericFieldMapping()
 	dateFieldMapping := bleve.NewDateTimeFieldMapping()
 
 	docMapping.AddFieldMappingsAt("url", textFieldMapping)
 	docMapping.AddFieldMappingsAt("title", textFieldMapping)
 	docMapping.AddFieldMappingsAt("content", textFieldMapping)
-	docMapping.AddFieldMappingsAt("type", textFieldMapping)
+	docMapping.AddFieldMappingsAt("headings", textFieldMapping)
 	docMapping.AddFieldMappingsAt("created_at", dateFieldMapping)
 
-	indexMapping.AddDocumentMapping("_default", docMapping)
+	// Facet fields are matched whole; indexes created before they were
+	// mapped pick them up with 'goprowl reindex'
+	docMapping.AddFieldMappingsAt("type", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("host", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("language", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("content_type", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("job", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("content_length", numericFieldMapping)
+	docMapping.AddFieldMappingsAt("modified_at", dateFieldMapping)
+
+	// Indexes created before the presence field was mapped pick it up with
+	// 'goprowl reindex'
+	presence := bleve.NewKeywordFieldMapping()
+	presence.Store = false
+	presence.IncludeInAll = false
+	presence.IncludeTermVectors = false
+	docMapping.AddFieldMappingsAt(PresenceField, presence)
+
+	// URLs a page was found as before canonicalization are matched whole
+	docMapping.AddFieldMappingsAt("url_variants", keywordFieldMapping)
+
+	// Near-duplicate fingerprints and the clusters they form
+	docMapping.AddFieldMappingsAt("simhash", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("cluster_id", keywordFieldMapping)
+
+	// Structured data declared by pages: descriptive text is searchable,
+	// identifiers and categories are matched whole
+	for _, field := range []string{
+		"description", "author", "headline", "breadcrumbs", "product_name",
+		"og_title", "og_description", "twitter_title", "twitter_description",
+	} {
+		docMapping.AddFieldMappingsAt(field, textFieldMapping)
+	}
+	for _, field := range []string{
+		"keywords", "schema_types", "og_type", "og_url", "og_image", "og_site_name",
+		"twitter_card", "twitter_site", "twitter_creator", "twitter_image",
+		"product_brand", "product_sku", "product_currency", "product_availability",
+	} {
+		docMapping.AddFieldMappingsAt(field, keywordFieldMapping)
+	}
+	docMapping.AddFieldMappingsAt("product_price", numericFieldMapping)
+	docMapping.AddFieldMappingsAt("published_at", dateFieldMapping)
+
+	// Titles and URLs are also indexed whole and lowercased to sort by;
+	// indexes created before pick them up with 'goprowl reindex'
+	for _, field := range language.SortedFields {
+		sortKey := bleve.NewTextFieldMapping()
+		sortKey.Name = language.SortField(field)
+		sortKey.Analyzer = language.SortAnalyzer
+		sortKey.Store = false
+		sortKey.IncludeInAll = false
+		sortKey.IncludeTermVectors = false
+		docMapping.AddFieldMappingsAt(field, sortKey)
+	}
 
-	return indexMapping
+	if analyzer != "" {
+		for _, field := range language.AnalyzedFields {
+			analyzed := bleve.NewTextFieldMapping()
+			analyzed.Name = language.AnalyzedField(field)
+			analyzed.Analyzer = analyzer
+			analyzed.Store = false
+			docMapping.AddFieldMappingsAt(field, analyzed)
+		}
+	}
+
+	return docMapping
 }
 
 func (s *BleveStorage) Store(ctx context.Context, doc *storage.Document) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Create a map of all fields to store
+	// Store the document
+	if err := s.index.Index(doc.URL, DocumentFields(doc)); err != nil {
+		return fmt.Errorf("failed to index document: %w", err)
+	}
+	s.markPending(doc.URL)
+
+	if s.dictionaryLoaded {
+		s.dictionary.Add(doc.URL, doc.Title, doc.Content)
+	}
+
+	return nil
+}
+
+// DocumentFields returns the fields indexed for a document, with metadata
+// flattened alongside the core fields and the names of those with a value
+// under PresenceField
+func DocumentFields(doc *storage.Document) map[string]interface{} {
 	fields := map[string]interface{}{
 		"url":        doc.URL,
 		"title":      doc.Title,
@@ -75,22 +189,70 @@ func (s *BleveStorage) Store(ctx context.Context, doc *storage.Document) error {
 		"created_at": doc.CreatedAt.Format(time.RFC3339),
 	}
 
-	// Add metadata fields
 	for key, value := range doc.Metadata {
 		if !isReservedField(key) {
 			fields[key] = value
 		}
 	}
+	resolveLanguage(fields)
 
-	// Store the document
-	if err := s.index.Index(doc.URL, fields); err != nil {
-		return fmt.Errorf("failed to index document: %w", err)
+	present := make([]string, 0, len(fields))
+	for key, value := range fields {
+		if hasValue(value) {
+			present = append(present, key)
+		}
 	}
+	sort.Strings(present)
+	fields[PresenceField] = present
 
-	return nil
+	return fields
+}
+
+// hasValue reports whether a field value is set: not nil, nor an empty
+// string or list
+func hasValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case []string:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// resolveLanguage sets the language field to the language detected in the
+// title and content, keeping the declared language when none is detected.
+// The language selects the analyzer the document's text is indexed with
+func resolveLanguage(fields map[string]interface{}) {
+	title, _ := fields["title"].(string)
+	content, _ := fields["content"].(string)
+	declared, _ := fields[language.Field].(string)
+
+	if lang := language.Resolve(title+"\n"+content, declared); lang != "" {
+		fields[language.Field] = lang
+	}
+}
+
+// markPending records a write made while a reindex is running. Callers hold mu
+func (s *BleveStorage) markPending(id string) {
+	if s.pending != nil {
+		s.pending[id] = struct{}{}
+	}
 }
 
 func (s *BleveStorage) Get(ctx context.Context, id string) (*storage.Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.get(id)
+}
+
+// get reads a document from the index. Callers hold mu
+func (s *BleveStorage) get(id string) (*storage.Document, error) {
 	doc, err := s.index.Document(id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get document: %w", err)
@@ -100,91 +262,156 @@ func (s *BleveStorage) Get(ctx context.Context, id string) (*storage.Document, e
 		return nil, storage.ErrDocumentNotFound
 	}
 
-	bleveDoc := &BleveDocument{}
 	docData := make(map[string]interface{})
 
+	// Repeated fields (e.g. metadata arrays) are collected into a slice
+	addValue := func(name string, value interface{}) {
+		existing, ok := docData[name]
+		if !ok {
+			docData[name] = value
+			return
+		}
+		if values, ok := existing.([]interface{}); ok {
+			docData[name] = append(values, value)
+			return
+		}
+		docData[name] = []interface{}{existing, value}
+	}
+
 	// Convert document fields to map
 	if doc, ok := doc.(*document.Document); ok {
 		for _, field := range doc.Fields {
 			switch field := field.(type) {
 			case *document.TextField:
-				docData[field.Name()] = field.Value()
+				addValue(field.Name(), field.Text())
 			case *document.DateTimeField:
-				docData[field.Name()] = field.Value()
+				dt, _, err := field.DateTime()
+				if err != nil {
+					return nil, fmt.Errorf("failed to get datetime field value: %w", err)
+				}
+				addValue(field.Name(), dt)
 			case *document.NumericField:
 				num, err := field.Number()
 				if err != nil {
 					return nil, fmt.Errorf("failed to get numeric field value: %w", err)
 				}
-				docData[field.Name()] = num
+				addValue(field.Name(), num)
 			}
 		}
 	}
 
-	// Marshal and unmarshal to convert the map to struct
-	jsonData, err := json.Marshal(docData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal document data: %w", err)
+	stringField := func(name string) string {
+		value, _ := docData[name].(string)
+		return value
 	}
 
-	if err := json.Unmarshal(jsonData, bleveDoc); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal document: %w", err)
+	result := &storage.Document{
+		URL:      stringField("url"),
+		Title:    stringField("title"),
+		Content:  stringField("content"),
+		Type:     stringField("type"),
+		Metadata: make(map[string]interface{}),
+	}
+	if created, ok := docData["created_at"].(time.Time); ok {
+		result.CreatedAt = created
+	}
+	for key, value := range docData {
+		if !isReservedField(key) {
+			result.Metadata[key] = value
+		}
 	}
 
-	return &storage.Document{
-		URL:       bleveDoc.URL,
-		Title:     bleveDoc.Title,
-		Content:   bleveDoc.Content,
-		Type:      bleveDoc.Type,
-		Metadata:  bleveDoc.Metadata,
-		CreatedAt: bleveDoc.CreatedAt,
-	}, nil
+	return result, nil
 }
 
 func (s *BleveStorage) List(ctx context.Context) ([]*storage.Document, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Create a match all query
-	query := bleve.NewMatchAllQuery()
-	searchRequest := bleve.NewSearchRequest(query)
-	searchRequest.Size = 1000            // Adjust based on your needs
-	searchRequest.Fields = []string{"*"} // Request all stored fields
-
-	searchResult, err := s.index.Search(searchRequest)
+	var docs []*storage.Document
+	err := eachStored(ctx, s.index, nil, func(id string, fields map[string]interface{}) error {
+		docs = append(docs, documentFromFields(fields))
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to search index: %w", err)
+		return nil, err
 	}
 
-	docs := make([]*storage.Document, 0, len(searchResult.Hits))
-	for _, hit := range searchResult.Hits {
-		// Get the stored fields directly from the hit
-		doc := &storage.Document{
-			URL:     hit.Fields["url"].(string),
-			Title:   hit.Fields["title"].(string),
-			Content: hit.Fields["content"].(string),
-			Type:    hit.Fields["type"].(string),
+	return docs, nil
+}
+
+// ListFields implements storage.FieldLister
+func (s *BleveStorage) ListFields(ctx context.Context, names []string, fn func(id string, fields map[string]interface{}) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return eachStored(ctx, s.index, names, fn)
+}
+
+// eachStored calls fn with the stored fields of every document in index,
+// in ID order. It loads the named fields, or all of them when names is nil
+func eachStored(ctx context.Context, index bleve.Index, names []string, fn func(id string, fields map[string]interface{}) error) error {
+	const pageSize = 500
+
+	if names == nil {
+		names = []string{"*"} // Request all stored fields
+	}
+
+	var after []string
+	for {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), pageSize, 0, false)
+		req.Fields = names
+		req.SortBy([]string{"_id"})
+		if after != nil {
+			req.SetSearchAfter(after)
 		}
 
-		// Handle created_at conversion
-		if createdStr, ok := hit.Fields["created_at"].(string); ok {
-			if created, err := time.Parse(time.RFC3339, createdStr); err == nil {
-				doc.CreatedAt = created
-			}
+		result, err := index.SearchInContext(ctx, req)
+		if err != nil {
+			return fmt.Errorf("failed to search index: %w", err)
 		}
 
-		// Handle metadata
-		doc.Metadata = make(map[string]interface{})
-		for key, value := range hit.Fields {
-			if !isReservedField(key) {
-				doc.Metadata[key] = value
+		for _, hit := range result.Hits {
+			if err := fn(hit.ID, hit.Fields); err != nil {
+				return err
 			}
 		}
 
-		docs = append(docs, doc)
+		if len(result.Hits) < pageSize {
+			return nil
+		}
+		after = []string{result.Hits[len(result.Hits)-1].ID}
 	}
+}
 
-	return docs, nil
+// documentFromFields converts the stored fields of a search hit to a document
+func documentFromFields(fields map[string]interface{}) *storage.Document {
+	stringField := func(name string) string {
+		value, _ := fields[name].(string)
+		return value
+	}
+
+	doc := &storage.Document{
+		URL:      stringField("url"),
+		Title:    stringField("title"),
+		Content:  stringField("content"),
+		Type:     stringField("type"),
+		Metadata: make(map[string]interface{}),
+	}
+
+	// Handle created_at conversion
+	if created, err := time.Parse(time.RFC3339, stringField("created_at")); err == nil {
+		doc.CreatedAt = created
+	}
+
+	// Handle metadata
+	for key, value := range fields {
+		if !isReservedField(key) {
+			doc.Metadata[key] = value
+		}
+	}
+
+	return doc
 }
 
 // Helper function to check if a field name is reserved
@@ -203,14 +430,17 @@ func (s *BleveStorage) Search(ctx context.Context, query string) ([]*storage.Doc
 	q := bleve.NewQueryStringQuery(query)
 	searchRequest := bleve.NewSearchRequest(q)
 
-	searchResult, err := s.index.Search(searchRequest)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	searchResult, err := s.index.SearchInContext(ctx, searchRequest)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search documents: %w", err)
 	}
 
 	docs := make([]*storage.Document, 0, len(searchResult.Hits))
 	for _, hit := range searchResult.Hits {
-		doc, err := s.Get(ctx, hit.ID)
+		doc, err := s.get(hit.ID)
 		if err != nil {
 			continue
 		}
@@ -220,63 +450,107 @@ func (s *BleveStorage) Search(ctx context.Context, query string) ([]*storage.Doc
 	return docs, nil
 }
 
+// SearchIndex runs a bleve search request directly against the underlying index
+func (s *BleveStorage) SearchIndex(ctx context.Context, req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, err := s.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search index: %w", err)
+	}
+
+	return result, nil
+}
+
+// FieldTerms calls visit with the terms indexed in field, in order, until it
+// returns false
+func (s *BleveStorage) FieldTerms(ctx context.Context, field string, visit func(term string) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dict, err := s.index.FieldDict(field)
+	if err != nil {
+		return fmt.Errorf("failed to read terms of %s: %w", field, err)
+	}
+	defer dict.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entry, err := dict.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read terms of %s: %w", field, err)
+		}
+		if entry == nil || !visit(entry.Term) {
+			return nil
+		}
+	}
+}
+
 func (s *BleveStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	return s.index.Close()
 }
 
 func (s *BleveStorage) BatchStore(ctx context.Context, docs []*storage.Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Index the same field layout as Store, so stored documents read back
+	// the same way however they were written
 	batch := s.index.NewBatch()
 	for _, doc := range docs {
-		bleveDoc := BleveDocument{
-			URL:       doc.URL,
-			Title:     doc.Title,
-			Content:   doc.Content,
-			Type:      doc.Type,
-			Metadata:  doc.Metadata,
-			CreatedAt: doc.CreatedAt,
-		}
-		if err := batch.Index(doc.URL, bleveDoc); err != nil {
+		if err := batch.Index(doc.URL, DocumentFields(doc)); err != nil {
 			return fmt.Errorf("failed to add document to batch: %w", err)
 		}
 	}
-	return s.index.Batch(batch)
+	if err := s.index.Batch(batch); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		s.markPending(doc.URL)
+	}
+
+	if s.dictionaryLoaded {
+		for _, doc := range docs {
+			s.dictionary.Add(doc.URL, doc.Title, doc.Content)
+		}
+	}
+	return nil
 }
 
 func (s *BleveStorage) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	err := s.index.Delete(id)
 	if err != nil {
 		return fmt.Errorf("failed to delete document: %w", err)
 	}
+	s.markPending(id)
+
+	s.dictionary.Remove(id)
 	return nil
 }
 
+// GetAll returns every document, reading the index page by page
 func (s *BleveStorage) GetAll(ctx context.Context) ([]*storage.Document, error) {
-	// Create a match all query
-	query := bleve.NewMatchAllQuery()
-	searchRequest := bleve.NewSearchRequest(query)
-	// Set a high size to get all documents
-	searchRequest.Size = 10000 // Consider implementing pagination for large datasets
-
-	searchResult, err := s.index.Search(searchRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get all documents: %w", err)
-	}
-
-	docs := make([]*storage.Document, 0, len(searchResult.Hits))
-	for _, hit := range searchResult.Hits {
-		doc, err := s.Get(ctx, hit.ID)
-		if err != nil {
-			// Log error but continue with other documents
-			continue
-		}
-		docs = append(docs, doc)
-	}
-
-	return docs, nil
+	return s.List(ctx)
 }
 
 // Clear implements the StorageAdapter interface
 func (s *BleveStorage) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil {
+		return storage.ErrReindexInProgress
+	}
+
 	// Close the current index
 	if err := s.index.Close(); err != nil {
 		return fmt.Errorf("failed to close index: %w", err)
@@ -288,12 +562,49 @@ func (s *BleveStorage) Clear(ctx context.Context) error {
 	}
 
 	// Create a new empty index
-	mapping := createMapping()
+	mapping := NewMapping()
 	index, err := bleve.New(s.path, mapping)
 	if err != nil {
 		return fmt.Errorf("failed to create new index: %w", err)
 	}
 	s.index = index
 
+	// The new index is empty, so the dictionary is complete without a scan
+	s.dictionary.Clear()
+	s.dictionaryLoaded = true
+
+	return nil
+}
+
+// Suggest returns completions of prefix from the terms and titles of the
+// stored documents
+func (s *BleveStorage) Suggest(ctx context.Context, prefix string, limit int) ([]suggest.Suggestion, error) {
+	if err := s.loadDictionary(ctx); err != nil {
+		return nil, err
+	}
+	return s.dictionary.Complete(prefix, limit), nil
+}
+
+// loadDictionary builds the suggestion dictionary from every stored document
+// the first time it is needed
+func (s *BleveStorage) loadDictionary(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dictionaryLoaded {
+		return nil
+	}
+
+	err := eachStored(ctx, s.index, []string{"title", "content"}, func(id string, fields map[string]interface{}) error {
+		title, _ := fields["title"].(string)
+		content, _ := fields["content"].(string)
+		s.dictionary.Add(id, title, content)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build suggestion dictionary: %w", err)
+	}
+
+	s.dictionaryLoaded = true
 	return nil
 }
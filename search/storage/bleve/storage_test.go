@@ -0,0 +1,144 @@
+package bleve
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonesrussell/goprowl/search/storage"
+)
+
+func newTestStorage(t *testing.T, count int) *BleveStorage {
+	t.Helper()
+
+	s, err := New(filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	docs := make([]*storage.Document, count)
+	for i := range docs {
+		docs[i] = &storage.Document{
+			URL:       fmt.Sprintf("https://example.com/%05d", i),
+			Title:     fmt.Sprintf("Page %d", i),
+			Content:   "web crawler",
+			Type:      "webpage",
+			CreatedAt: time.Now(),
+		}
+	}
+	if err := s.BatchStore(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestGetAll checks that every document is returned, over several pages
+func TestGetAll(t *testing.T) {
+	const count = 1234
+	s := newTestStorage(t, count)
+
+	docs, err := s.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != count {
+		t.Fatalf("GetAll returned %d documents, want %d", len(docs), count)
+	}
+	seen := make(map[string]bool, count)
+	for _, doc := range docs {
+		seen[doc.URL] = true
+	}
+	if len(seen) != count {
+		t.Errorf("GetAll returned %d distinct documents, want %d", len(seen), count)
+	}
+}
+
+// TestListFields checks that only the named fields are loaded, metadata
+// included
+func TestListFields(t *testing.T) {
+	s := newTestStorage(t, 3)
+	doc := &storage.Document{
+		URL:      "https://example.com/00001",
+		Title:    "Page 1",
+		Content:  "web crawler",
+		Type:     "webpage",
+		Metadata: map[string]interface{}{"simhash": "00ff00ff00ff00ff", "cluster_id": "c1"},
+	}
+	if err := s.Store(context.Background(), doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	err := s.ListFields(context.Background(), []string{"simhash", "cluster_id"}, func(id string, fields map[string]interface{}) error {
+		ids = append(ids, id)
+		if _, ok := fields["content"]; ok {
+			t.Errorf("%s: content loaded", id)
+		}
+		if id == doc.URL && (fields["simhash"] != "00ff00ff00ff00ff" || fields["cluster_id"] != "c1") {
+			t.Errorf("%s: fields %v, want its simhash and cluster_id", id, fields)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != "https://example.com/00000" || ids[2] != "https://example.com/00002" {
+		t.Errorf("listed %v, want the 3 documents in ID order", ids)
+	}
+}
+
+// TestReadsDuringReindex reads documents while the index is rebuilt and
+// swapped; run with -race
+func TestReadsDuringReindex(t *testing.T) {
+	s := newTestStorage(t, 50)
+	ctx := context.Background()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	read := func(name string, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := fn(); err != nil {
+					errs <- fmt.Errorf("%s: %w", name, err)
+					return
+				}
+			}
+		}()
+	}
+	read("Get", func() error {
+		_, err := s.Get(ctx, "https://example.com/00007")
+		return err
+	})
+	read("Search", func() error {
+		_, err := s.Search(ctx, "crawler")
+		return err
+	})
+	read("GetAll", func() error {
+		_, err := s.GetAll(ctx)
+		return err
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := s.Reindex(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
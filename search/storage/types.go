@@ -51,5 +51,18 @@ type StorageAdapter interface {
 	Clear(ctx context.Context) error
 }
 
+// FieldLister is implemented by storage that can list documents with only
+// some of their fields loaded
+type FieldLister interface {
+	// ListFields calls fn with the ID and the named fields of every
+	// document, in ID order, until fn returns an error. Metadata fields are
+	// named by their key. fn must not call back into the storage
+	ListFields(ctx context.Context, names []string, fn func(id string, fields map[string]interface{}) error) error
+}
+
 // ErrDocumentNotFound is returned when a document cannot be found in storage
 var ErrDocumentNotFound = fmt.Errorf("document not found")
+
+// ErrReindexInProgress is returned when a reindex is started, or the index
+// cleared, while another reindex is still running
+var ErrReindexInProgress = fmt.Errorf("reindex already in progress")